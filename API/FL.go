@@ -1,29 +1,23 @@
 package API
 
 import (
+	"Capstone_go/privacy"
+	"Capstone_go/store"
+	"Capstone_go/tensor"
 	"bytes"
-	"crypto/x509"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"github.com/hyperledger/fabric-gateway/pkg/client"
-	"github.com/hyperledger/fabric-gateway/pkg/identity"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/status"
 	"io/ioutil"
-	"log"
+	"math"
 	"os"
 	"path"
-	"time"
-)
-
-const (
-	mspID        = "Org1MSP"
-	cryptoPath   = "E:/fabric-test/fabric-samples-main/test-network/organizations/peerOrganizations/org1.example.com"
-	certPath     = cryptoPath + "/users/User1@org1.example.com/msp/signcerts/User1@org1.example.com-cert.pem"
-	keyPath      = cryptoPath + "/users/User1@org1.example.com/msp/keystore/"
-	tlsCertPath  = cryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt"
-	peerEndpoint = "localhost:7051"
-	gatewayPeer  = "peer0.org1.example.com"
+	"strconv"
+	"strings"
 )
 
 type MyModelParams struct {
@@ -46,145 +40,215 @@ type ModelParam struct {
 }
 
 type ModelParamDy struct {
-	Params  map[string]interface{} `json:"params"`
-	UserID  string                 `json:"userID"`
-	RoundID string                 `json:"roundID"`
+	Params      map[string]interface{} `json:"params"`
+	UserID      string                 `json:"userID"`
+	RoundID     string                 `json:"roundID"`
+	NumSamples  int                    `json:"numSamples"`
+	LocalEpochs int                    `json:"localEpochs,omitempty"`
+	// Tensors is the base64 encoded tensor container of binary uploads, it is decoded into Params
+	Tensors string `json:"tensors,omitempty"`
+	// Upload describes params uploaded in chunks, they are fetched and verified into Params
+	Upload *ChunkedUpload `json:"upload,omitempty"`
+	// Ref points to the params in groups that keep them off chain, they are downloaded and verified into Params
+	Ref *ParamRef `json:"ref,omitempty"`
+	// Private points to the params in groups that keep them in a private data collection, members read them into Params
+	Private *PrivateRef `json:"private,omitempty"`
+	// Aggregation is the rule that produced an aggregated param, it is empty for user uploads
+	Aggregation *AggregationConfig `json:"aggregation,omitempty"`
 }
 
 type ExistGroups struct {
 	GroupsName []string `json:"groupsName"`
 }
 
-func ResigerUser(groupname string, userId string) error {
-	// The gRPC client connection should be shared by all Gateway connections to this endpoint
-	clientConnection := newGrpcConnection()
+// GroupConfig holds the settings of a group in the dynamic chaincode
+type GroupConfig struct {
+	Aggregation AggregationConfig `json:"aggregation"`
+	Optimizer   OptimizerConfig   `json:"optimizer"`
+	Policy      GroupPolicy       `json:"policy"`
+	// Storage is "onchain" (default), "offchain" or "private", off-chain groups only take uploads through UploadModelParamRef
+	// and private groups only through UploadModelParamPrivate
+	Storage string `json:"storage,omitempty"`
+	// Collection is the private data collection of private groups, "flParamCollection" by default.
+	// Groups with secure aggregation keep the revealed shares in it
+	Collection string `json:"collection,omitempty"`
+	// SecAgg hides the individual uploads from the chaincode, it needs the fedavg rule, no server optimizer and on-chain storage
+	SecAgg SecAggConfig `json:"secureAggregation"`
+}
 
-	id := newIdentity()
-	sign := newSign()
+// ParamRef points to params kept in the content-addressed store
+type ParamRef = store.Object
 
-	// Create a Gateway connection for a specific client identity
-	gw, err := client.Connect(
-		id,
-		client.WithSign(sign),
-		client.WithClientConnection(clientConnection),
-		// Default timeouts for different gRPC calls
-		client.WithEvaluateTimeout(5*time.Second),
-		client.WithEndorseTimeout(15*time.Second),
-		client.WithSubmitTimeout(5*time.Second),
-		client.WithCommitStatusTimeout(1*time.Minute),
-	)
-	if err != nil {
-		panic(err)
-	}
-	defer gw.Close()
-
-	// Override default values for chaincode and channel name as they may differ in testing contexts.
-	chaincodeName := "FL"
-	if ccname := os.Getenv("CHAINCODE_NAME"); ccname != "" {
-		chaincodeName = ccname
+// PrivateRef points to params kept in a private data collection, Hash is the hex encoded SHA-256 of the private value
+type PrivateRef struct {
+	Collection string `json:"collection"`
+	Hash       string `json:"hash"`
+}
 
-	}
+// GroupPolicy decides when the params of a round are aggregated: once the larger of MinCount and
+// MinFraction of the users uploaded, either right away ("eager") or on FinalizeRound ("finalize").
+// With a RoundTimeoutSeconds a round that expires is aggregated if MinCount users uploaded, otherwise it fails
+type GroupPolicy struct {
+	MinCount            int     `json:"minCount"`
+	MinFraction         float64 `json:"minFraction"`
+	Mode                string  `json:"mode"`
+	RoundTimeoutSeconds int64   `json:"roundTimeoutSeconds,omitempty"`
+}
 
-	channelName := "mychannel"
-	if cname := os.Getenv("CHANNEL_NAME"); cname != "" {
-		channelName = cname
-	}
+// AggregationConfig selects the rule the chaincode uses to combine the params of a round,
+// Rule is one of "fedavg", "median", "trimmedmean", "krum" or "multikrum"
+type AggregationConfig struct {
+	Rule           string  `json:"rule"`
+	TrimRatio      float64 `json:"trimRatio,omitempty"`
+	ByzantineCount int     `json:"byzantineCount,omitempty"`
+	KrumSelect     int     `json:"krumSelect,omitempty"`
+}
 
-	network := gw.GetNetwork(channelName)
-	contract := network.GetContract(chaincodeName)
+// OptimizerConfig selects the server optimizer the chaincode applies on top of the aggregated params,
+// Name is one of "none", "fedavgm", "fedadam" or "fedyogi". Nil values fall back to the chaincode defaults,
+// a server learning rate of 1 for fedavgm and 1e-2 for fedadam and fedyogi, betas of 0.9 and 0.99 and a tau of 1e-3
+type OptimizerConfig struct {
+	Name         string   `json:"name"`
+	LearningRate *float64 `json:"learningRate,omitempty"`
+	Beta1        *float64 `json:"beta1,omitempty"`
+	Beta2        *float64 `json:"beta2,omitempty"`
+	Tau          *float64 `json:"tau,omitempty"`
+}
 
-	fmt.Printf("\n--> Submit Transaction: RegisterUser \n")
+// AggregationReport lists the users whose params went into the aggregation of a round
+type AggregationReport struct {
+	RoundID  string             `json:"roundID"`
+	Rule     string             `json:"rule"`
+	Selected []string           `json:"selected"`
+	Rejected []string           `json:"rejected"`
+	Scores   map[string]float64 `json:"scores,omitempty"`
+	// Optimizer is the server optimizer applied on top of the rule
+	Optimizer string `json:"optimizer,omitempty"`
+}
 
-	_, err = contract.SubmitTransaction("RegisterUser", groupname, userId)
+// CreateGroup creates a group in the dynamic chaincode with the given config
+func (c *Client) CreateGroup(ctx context.Context, groupname string, config GroupConfig) error {
+	configJSON, err := json.Marshal(config)
 	if err != nil {
-		panic(fmt.Errorf("failed to submit transaction: %w", err))
-		return err
+		return fmt.Errorf("failed to marshal group config: %w", err)
 	}
+	return c.submitTransaction(ctx, "CreateGroup", groupname, string(configJSON))
+}
 
-	fmt.Printf("*** Transaction committed successfully\n")
-	return err
+// RegisterUser adds a user bound to the identity of the caller, only the group owner may submit it
+func (c *Client) RegisterUser(ctx context.Context, groupname string, userId string) error {
+	return c.submitTransaction(ctx, "RegisterUser", groupname, userId)
 }
 
 // Upload model parameters to fabric
-func UploadModelParam(filepath string, groupname string, roundId string, userId string) error {
+func (c *Client) UploadModelParam(ctx context.Context, filepath string, groupname string, roundId string, userId string) error {
 	var param MyModelParams
 	//Open JSON file
 	file, err := os.Open(filepath)
 	if err != nil {
-		fmt.Println("Error opening JSON file:", err)
-		return err
+		return fmt.Errorf("failed to open params: %w", err)
 	}
 	defer file.Close()
 
 	// Parse JSON into map
 	// Map[string]interface{} is used because we don’t know the JSON structure in advance
 	if err := json.NewDecoder(file).Decode(&param); err != nil {
-		fmt.Println("Error decoding JSON:", err)
-		return err
+		return fmt.Errorf("failed to decode params: %w", err)
 	}
 
 	// Convert structure data to JSON string
 	paramsJSON, err := json.Marshal(param)
-	fmt.Println("the length of data is ", len(paramsJSON))
 	if err != nil {
-		log.Fatalf("Failed to marshal MyModelParams to JSON: %v", err)
+		return fmt.Errorf("failed to marshal MyModelParams to JSON: %w", err)
 	}
+	c.logf("the length of data is %d", len(paramsJSON))
 
-	// The gRPC client connection should be shared by all Gateway connections to this endpoint
-	clientConnection := newGrpcConnection()
+	return c.submitTransaction(ctx, "UploadModelParam", groupname, roundId, userId, string(paramsJSON))
+}
 
-	id := newIdentity()
-	sign := newSign()
+// UploadOption changes how UploadModelParamDy sends the params
+type UploadOption func(*uploadOptions)
 
-	// Create a Gateway connection for a specific client identity
-	gw, err := client.Connect(
-		id,
-		client.WithSign(sign),
-		client.WithClientConnection(clientConnection),
-		// Default timeouts for different gRPC calls
-		client.WithEvaluateTimeout(5*time.Second),
-		client.WithEndorseTimeout(15*time.Second),
-		client.WithSubmitTimeout(5*time.Second),
-		client.WithCommitStatusTimeout(1*time.Minute),
-	)
-	if err != nil {
-		panic(err)
-	}
-	defer gw.Close()
-
-	// Override default values for chaincode and channel name as they may differ in testing contexts.
-	chaincodeName := "FL"
-	if ccname := os.Getenv("CHAINCODE_NAME"); ccname != "" {
-		chaincodeName = ccname
+type uploadOptions struct {
+	tensorEncoding bool
+	dtype          tensor.DType
+	compression    tensor.Compression
+	privacy        *privacy.Config
+	globalParams   map[string]interface{}
+}
 
+// WithTensorEncoding sends the params as a binary tensor container instead of JSON,
+// the default JSON upload stays available for the Python scripts
+func WithTensorEncoding(dtype tensor.DType, compression tensor.Compression) UploadOption {
+	return func(options *uploadOptions) {
+		options.tensorEncoding = true
+		options.dtype = dtype
+		options.compression = compression
 	}
+}
 
-	channelName := "mychannel"
-	if cname := os.Getenv("CHANNEL_NAME"); cname != "" {
-		channelName = cname
+// WithDifferentialPrivacy clips the update of the params against the previous global params and adds Gaussian noise before the upload.
+// The privacy spent is recorded in the accountant of the user, uploads beyond the budget fail with privacy.ErrBudgetExceeded.
+// globalParams may be nil in the first round, the whole params then count as the update
+func WithDifferentialPrivacy(config privacy.Config, globalParams map[string]interface{}) UploadOption {
+	return func(options *uploadOptions) {
+		options.privacy = &config
+		options.globalParams = globalParams
 	}
+}
 
-	network := gw.GetNetwork(channelName)
-	contract := network.GetContract(chaincodeName)
-
-	fmt.Printf("\n--> Submit Transaction: UploadModelParam \n")
-
-	_, err = contract.SubmitTransaction("UploadModelParam", groupname, roundId, userId, string(paramsJSON))
+// LoadParamsFile reads params from a JSON file such as the ones in modelData
+func LoadParamsFile(filepath string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filepath)
 	if err != nil {
-		panic(fmt.Errorf("failed to submit transaction: %w", err))
-		return err
+		return nil, fmt.Errorf("failed to read params file: %w", err)
 	}
+	var params map[string]interface{}
+	err = json.Unmarshal(data, &params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON params: %w", err)
+	}
+	return params, nil
+}
 
-	fmt.Printf("*** Transaction committed successfully\n")
-	return err
+// privatizeParams applies the differential privacy option, the step is charged to the user's accountant before the params leave the client
+func (c *Client) privatizeParams(params map[string]interface{}, groupname string, roundId string, userId string, options uploadOptions) (map[string]interface{}, error) {
+	if options.privacy == nil {
+		return params, nil
+	}
+	config := *options.privacy
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	accountant, err := privacy.LoadAccountant(config.AccountantDir, userId)
+	if err != nil {
+		return nil, err
+	}
+	noised, norm, err := privacy.Privatize(params, options.globalParams, config)
+	if err != nil {
+		return nil, err
+	}
+	spent, err := accountant.Spend(privacy.Step{GroupName: groupname, RoundID: roundId, NoiseMultiplier: config.NoiseMultiplier, SampleRate: config.SampleRate}, config)
+	if err != nil {
+		return nil, err
+	}
+	c.logf("user %s update norm %.4f clipped to %.4f, epsilon spent %.4f of %.4f", userId, norm, math.Min(norm, config.ClipNorm), spent, config.Budget)
+	return noised, nil
 }
 
-func UploadModelParamDy(filepath string, groupname string, roundId string, userId string) error {
+// UploadModelParamDy uploads the model parameters to the dynamic chaincode,
+// numSamples is the number of samples the parameters were trained on and weights them in the aggregation
+func (c *Client) UploadModelParamDy(ctx context.Context, filepath string, groupname string, roundId string, userId string, numSamples int, localEpochs int, opts ...UploadOption) error {
+	var options uploadOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	//Open JSON file
 	file, err := os.Open(filepath)
 	if err != nil {
-		fmt.Println("Error opening JSON file:", err)
-		return err
+		return fmt.Errorf("failed to open params: %w", err)
 	}
 	defer file.Close()
 
@@ -192,382 +256,650 @@ func UploadModelParamDy(filepath string, groupname string, roundId string, userI
 	// Parse the JSON into a map
 	var params map[string]interface{}
 	if err := json.NewDecoder(file).Decode(&params); err != nil {
-		fmt.Println("Error decoding JSON:", err)
+		return fmt.Errorf("failed to decode params: %w", err)
+	}
+	params, err = c.privatizeParams(params, groupname, roundId, userId, options)
+	if err != nil {
 		return err
 	}
 
-	// Convert the map data to a JSON string
-	paramsJSON, err := json.Marshal(params)
-	fmt.Println("the length of data is ", len(paramsJSON))
+	// Convert the map data to a JSON string or a tensor container
+	transaction := "UploadModelParam"
+	var paramsJSON []byte
+	if options.tensorEncoding {
+		transaction = "UploadModelParamTensor"
+		paramsJSON, err = encodeTensors(params, options.dtype, options.compression)
+		if err != nil {
+			return err
+		}
+	} else {
+		paramsJSON, err = json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal params to JSON: %w", err)
+		}
+	}
+	c.logf("the length of data is %d", len(paramsJSON))
+
+	return c.submitTransaction(ctx, transaction, groupname, roundId, userId, string(paramsJSON), strconv.Itoa(numSamples), strconv.Itoa(localEpochs))
+}
+
+// Read model parameters based on roundID
+func (c *Client) ReadModelParam(ctx context.Context, groupname string, roundId string) error {
+	c.logf("--> Evaluate Transaction: GetAggregatedParams")
+	evaluateResult, err := c.evaluate(ctx, "GetAggregatedParams", groupname, roundId)
 	if err != nil {
-		log.Fatalf("Failed to marshal params to JSON: %v", err)
+		return err
+	}
+	var param ModelParam
+	err = json.Unmarshal(evaluateResult, &param)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON data: %w", err)
 	}
 
-	// The gRPC client connection should be shared by all Gateway connections to this endpoint
-	clientConnection := newGrpcConnection()
-
-	id := newIdentity()
-	sign := newSign()
+	prettyJSON, err := json.MarshalIndent(param.Params, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal params: %w", err)
+	}
+	if err = ioutil.WriteFile(groupname+"_AllUser_Round"+param.RoundID+".json", prettyJSON, 0644); err != nil {
+		return fmt.Errorf("failed to write params: %w", err)
+	}
+	return nil
+}
 
-	// Create a Gateway connection for a specific client identity
-	gw, err := client.Connect(
-		id,
-		client.WithSign(sign),
-		client.WithClientConnection(clientConnection),
-		// Default timeouts for different gRPC calls
-		client.WithEvaluateTimeout(5*time.Second),
-		client.WithEndorseTimeout(15*time.Second),
-		client.WithSubmitTimeout(5*time.Second),
-		client.WithCommitStatusTimeout(1*time.Minute),
-	)
+func (c *Client) ReadUserModel(ctx context.Context, key string) error {
+	evaluateResult, err := c.evaluate(ctx, "GetParam", key)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	var param ModelParam
+	err = json.Unmarshal(evaluateResult, &param)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON data: %w", err)
 	}
-	defer gw.Close()
 
-	// Override default values for chaincode and channel name as they may differ in testing contexts.
-	chaincodeName := "FL"
-	if ccname := os.Getenv("CHAINCODE_NAME"); ccname != "" {
-		chaincodeName = ccname
+	prettyJSON, err := json.MarshalIndent(param.Params, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal params: %w", err)
+	}
+	if err = ioutil.WriteFile(param.UserID+"_"+param.RoundID+".json", prettyJSON, 0644); err != nil {
+		return fmt.Errorf("failed to write params: %w", err)
+	}
+	return nil
+}
 
+// ReadUserModel_Dy writes the params stored under the key to "<key>_Dy.json" in dir
+func (c *Client) ReadUserModel_Dy(ctx context.Context, key string, dir string) error {
+	modelParam, err := c.GetModelParamDy(ctx, key)
+	if err != nil {
+		return err
 	}
 
-	channelName := "mychannel"
-	if cname := os.Getenv("CHANNEL_NAME"); cname != "" {
-		channelName = cname
+	// Marshal only the Params field of the ModelParam
+	prettyJSON, err := json.MarshalIndent(modelParam.Params, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal params: %w", err)
 	}
+	if err = ioutil.WriteFile(path.Join(dir, key+"_Dy.json"), prettyJSON, 0644); err != nil {
+		return fmt.Errorf("failed to write params: %w", err)
+	}
+	c.logf("file successfully saved to %s", path.Join(dir, key+"_Dy.json"))
+	return nil
+}
 
-	network := gw.GetNetwork(channelName)
-	contract := network.GetContract(chaincodeName)
+// GetGroupPolicy reads the quorum policy of a group
+func (c *Client) GetGroupPolicy(ctx context.Context, groupname string) (*GroupPolicy, error) {
+	evaluateResult, err := c.evaluate(ctx, "GetGroupPolicy", groupname)
+	if err != nil {
+		return nil, err
+	}
+	var policy GroupPolicy
+	err = json.Unmarshal(evaluateResult, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %v", err)
+	}
+	return &policy, nil
+}
 
-	fmt.Printf("\n--> Submit Transaction: UploadModelParam \n")
+// RoundStatus is the state of a round in the dynamic chaincode, Status is "open", "aggregating", "closed" or "failed"
+type RoundStatus struct {
+	RoundID  string   `json:"roundID"`
+	Status   string   `json:"status"`
+	Uploaded []string `json:"uploaded"`
+	// Deadline is the unix time in seconds after which the round expires, 0 means no deadline
+	Deadline int64 `json:"deadline,omitempty"`
+	Attempt  int   `json:"attempt,omitempty"`
+}
 
-	_, err = contract.SubmitTransaction("UploadModelParam", groupname, roundId, userId, string(paramsJSON))
+// GetRoundStatus reads the state of a round and the users that uploaded params for it
+func (c *Client) GetRoundStatus(ctx context.Context, groupname string, roundId string) (*RoundStatus, error) {
+	evaluateResult, err := c.evaluate(ctx, "GetRoundStatus", groupname, roundId)
 	if err != nil {
-		panic(fmt.Errorf("failed to submit transaction: %w", err))
-		return err
+		return nil, err
+	}
+	var status RoundStatus
+	err = json.Unmarshal(evaluateResult, &status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %v", err)
 	}
+	return &status, nil
+}
 
-	fmt.Printf("*** Transaction committed successfully\n")
-	return err
+// CloseExpiredRound ends a round after its deadline, it is aggregated or marked failed. The owner and the active members may call it
+func (c *Client) CloseExpiredRound(ctx context.Context, groupname string, roundId string) error {
+	return c.submitTransaction(ctx, "CloseExpiredRound", groupname, roundId)
 }
 
-// Read model parameters based on roundID
-func ReadModelParam(groupname string, roundId string) error {
-	// The gRPC client connection should be shared by all Gateway connections to this endpoint
-	clientConnection := newGrpcConnection()
+// RestartRound reopens a failed round, the users have to upload their params again. Only the group owner may restart it
+func (c *Client) RestartRound(ctx context.Context, groupname string, roundId string) error {
+	return c.submitTransaction(ctx, "RestartRound", groupname, roundId)
+}
 
-	id := newIdentity()
-	sign := newSign()
+// FinalizeRound asks the chaincode to aggregate and close an open round that reached its quorum, only the group owner may finalize
+func (c *Client) FinalizeRound(ctx context.Context, groupname string, roundId string) error {
+	return c.submitTransaction(ctx, "FinalizeRound", groupname, roundId)
+}
 
-	// Create a Gateway connection for a specific client identity
-	gw, err := client.Connect(
-		id,
-		client.WithSign(sign),
-		client.WithClientConnection(clientConnection),
-		// Default timeouts for different gRPC calls
-		client.WithEvaluateTimeout(5*time.Second),
-		client.WithEndorseTimeout(15*time.Second),
-		client.WithSubmitTimeout(5*time.Second),
-		client.WithCommitStatusTimeout(1*time.Minute),
-	)
+// GetAggregationReport reads which users were selected and rejected by the aggregation of a round
+func (c *Client) GetAggregationReport(ctx context.Context, groupname string, roundId string) (*AggregationReport, error) {
+	evaluateResult, err := c.evaluate(ctx, "GetAggregationReport", groupname, roundId)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	defer gw.Close()
-
-	// Override default values for chaincode and channel name as they may differ in testing contexts.
-	chaincodeName := "FL"
-	if ccname := os.Getenv("CHAINCODE_NAME"); ccname != "" {
-		chaincodeName = ccname
-
+	var report AggregationReport
+	err = json.Unmarshal(evaluateResult, &report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %v", err)
 	}
+	return &report, nil
+}
 
-	channelName := "mychannel"
-	if cname := os.Getenv("CHANNEL_NAME"); cname != "" {
-		channelName = cname
+// UploadModelParamRef writes the params of the JSON file to the store and records their digest, size and URI on chain,
+// only the differential privacy option applies as the store keeps JSON
+func (c *Client) UploadModelParamRef(ctx context.Context, filepath string, groupname string, roundId string, userId string, numSamples int, localEpochs int, paramStore store.Store, opts ...UploadOption) error {
+	var options uploadOptions
+	for _, opt := range opts {
+		opt(&options)
 	}
-
-	network := gw.GetNetwork(channelName)
-	contract := network.GetContract(chaincodeName)
-
-	fmt.Printf("\n--> Submit Transaction: GetAggregatedParams \n")
-	//EvaluateTransaction is Query,SubmitTransaction is Modify
-	evaluateResult, err := contract.EvaluateTransaction("GetAggregatedParams", groupname, roundId)
+	params, err := LoadParamsFile(filepath)
 	if err != nil {
-		panic(fmt.Errorf("failed to evaluate transaction: %w", err))
+		return err
 	}
-	fmt.Printf("*** Transaction committed successfully\n")
-	var param ModelParam
-	err = json.Unmarshal(evaluateResult, &param)
+	params, err = c.privatizeParams(params, groupname, roundId, userId, options)
 	if err != nil {
-		log.Fatalf("Error occurred during unmarshalling. Error: %s", err.Error())
+		return err
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal params to JSON: %w", err)
+	}
+	object, err := paramStore.Put(paramsJSON)
+	if err != nil {
+		return err
 	}
 
-	prettyJSON, err := json.MarshalIndent(param.Params, "", "    ")
+	return c.submitTransaction(ctx, "UploadParamRef", groupname, roundId, userId, object.Digest, strconv.FormatInt(object.Size, 10), object.URI, strconv.Itoa(numSamples), strconv.Itoa(localEpochs))
+}
+
+// UploadModelParamPrivate uploads the params of a user to the private data collection of the group. The params travel
+// as transient data, so only the collection members see them and the public ledger only records their hash
+func (c *Client) UploadModelParamPrivate(ctx context.Context, filepath string, groupname string, roundId string, userId string, numSamples int, localEpochs int, opts ...UploadOption) error {
+	var options uploadOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	params, err := LoadParamsFile(filepath)
 	if err != nil {
-		fmt.Println("Error encoding JSON:", err)
 		return err
 	}
-	if err = ioutil.WriteFile(groupname+"_AllUser_Round"+param.RoundID+".json", prettyJSON, 0644); err != nil {
-		fmt.Println("Error writing output JSON file:", err)
+	params, err = c.privatizeParams(params, groupname, roundId, userId, options)
+	if err != nil {
 		return err
 	}
-	return nil
+	transient := make(map[string][]byte)
+	if options.tensorEncoding {
+		tensors, err := tensor.FromParams(params, options.dtype)
+		if err != nil {
+			return err
+		}
+		transient["tensors"], err = tensor.Encode(tensors, options.compression)
+		if err != nil {
+			return err
+		}
+	} else {
+		transient["params"], err = json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal params to JSON: %w", err)
+		}
+	}
+
+	_, err = c.submit(ctx, "UploadPrivateParam",
+		client.WithArguments(groupname, roundId, userId, strconv.Itoa(numSamples), strconv.Itoa(localEpochs)),
+		client.WithTransient(transient))
+	return err
 }
 
-func ReadUserModel(key string) error {
-	// The gRPC client connection should be shared by all Gateway connections to this endpoint
-	clientConnection := newGrpcConnection()
+// SubmitAggregate posts the params aggregated off-chain for a round, only the group owner may submit it
+func (c *Client) SubmitAggregate(ctx context.Context, groupname string, roundId string, object store.Object) error {
+	return c.submitTransaction(ctx, "SubmitAggregate", groupname, roundId, object.Digest, strconv.FormatInt(object.Size, 10), object.URI)
+}
 
-	id := newIdentity()
-	sign := newSign()
+// AccessDeniedError is returned when the chaincode refuses to let the caller read a key,
+// user params are only readable by the user and the group owner and aggregated params by the group members
+type AccessDeniedError struct {
+	Key    string
+	Reason string
+}
 
-	// Create a Gateway connection for a specific client identity
-	gw, err := client.Connect(
-		id,
-		client.WithSign(sign),
-		client.WithClientConnection(clientConnection),
-		// Default timeouts for different gRPC calls
-		client.WithEvaluateTimeout(5*time.Second),
-		client.WithEndorseTimeout(15*time.Second),
-		client.WithSubmitTimeout(5*time.Second),
-		client.WithCommitStatusTimeout(1*time.Minute),
-	)
-	if err != nil {
-		panic(err)
-	}
-	defer gw.Close()
+func (e *AccessDeniedError) Error() string {
+	return fmt.Sprintf("access to %s denied: %s", e.Key, e.Reason)
+}
 
-	// Override default values for chaincode and channel name as they may differ in testing contexts.
-	chaincodeName := "FL"
-	if ccname := os.Getenv("CHAINCODE_NAME"); ccname != "" {
-		chaincodeName = ccname
+// accessDeniedPrefix starts the message of reads the chaincode refuses
+const accessDeniedPrefix = "access denied: "
+
+// readError turns a refused read of the key into an AccessDeniedError, other errors are classified by transactionError
+func readError(name string, err error, key string) error {
+	messages := []string{}
+	grpcStatus := status.Convert(err)
+	messages = append(messages, grpcStatus.Message())
+	for _, detail := range grpcStatus.Details() {
+		if errorDetail, ok := detail.(*gateway.ErrorDetail); ok {
+			messages = append(messages, errorDetail.GetMessage())
+		}
+	}
+	for _, message := range messages {
+		index := strings.Index(message, accessDeniedPrefix)
+		if index < 0 {
+			continue
+		}
+		reason := strings.TrimPrefix(message[index+len(accessDeniedPrefix):], key+": ")
+		return &AccessDeniedError{Key: key, Reason: reason}
+	}
+	return transactionError(name, err)
+}
 
+// readParam evaluates a read of the params under the key, refused reads fail with an AccessDeniedError
+func (c *Client) readParam(ctx context.Context, name string, key string, args ...string) ([]byte, error) {
+	evaluateResult, err := c.contract.EvaluateWithContext(ctx, name, client.WithArguments(append([]string{key}, args...)...))
+	if err != nil {
+		return nil, readError(name, err, key)
 	}
+	return evaluateResult, nil
+}
 
-	channelName := "mychannel"
-	if cname := os.Getenv("CHANNEL_NAME"); cname != "" {
-		channelName = cname
+// GetModelParamDy reads the param stored under the key, params kept off chain are downloaded and verified against their digest
+func (c *Client) GetModelParamDy(ctx context.Context, key string) (*ModelParamDy, error) {
+	evaluateResult, err := c.readParam(ctx, "GetParam", key)
+	if err != nil {
+		return nil, err
 	}
+	var modelParam ModelParamDy
+	err = json.Unmarshal(evaluateResult, &modelParam)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %v", err)
+	}
+	err = c.resolveParams(ctx, key, &modelParam)
+	if err != nil {
+		return nil, err
+	}
+	return &modelParam, nil
+}
 
-	network := gw.GetNetwork(channelName)
-	contract := network.GetContract(chaincodeName)
-
-	//EvaluateTransaction is Query,SubmitTransaction is Modify
-	evaluateResult, err := contract.EvaluateTransaction("GetParam", key)
+// encodeTensors converts JSON params into a base64 encoded tensor container
+func encodeTensors(params map[string]interface{}, dtype tensor.DType, compression tensor.Compression) ([]byte, error) {
+	tensors, err := tensor.FromParams(params, dtype)
 	if err != nil {
-		panic(fmt.Errorf("failed to evaluate transaction: %w", err))
+		return nil, err
 	}
-	var param ModelParam
-	err = json.Unmarshal(evaluateResult, &param)
+	data, err := tensor.Encode(tensors, compression)
 	if err != nil {
-		log.Fatalf("Error occurred during unmarshalling. Error: %s", err.Error())
+		return nil, err
 	}
+	return []byte(base64.StdEncoding.EncodeToString(data)), nil
+}
 
-	prettyJSON, err := json.MarshalIndent(param.Params, "", "    ")
+// resolveParams fills Params of a ModelParamDy kept privately, as chunks, as a tensor container or off chain,
+// chunked and stored params are checked against the recorded digest
+func (c *Client) resolveParams(ctx context.Context, key string, modelParam *ModelParamDy) error {
+	if modelParam.Private != nil {
+		evaluateResult, err := c.readParam(ctx, "GetPrivateParam", key)
+		if err != nil {
+			return err
+		}
+		*modelParam = ModelParamDy{}
+		err = json.Unmarshal(evaluateResult, modelParam)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal JSON data: %v", err)
+		}
+	}
+	if modelParam.Upload != nil {
+		err := c.fetchChunks(ctx, key, modelParam)
+		if err != nil {
+			return err
+		}
+	}
+	if modelParam.Tensors != "" {
+		data, err := base64.StdEncoding.DecodeString(modelParam.Tensors)
+		if err != nil {
+			return fmt.Errorf("failed to decode tensors: %v", err)
+		}
+		tensors, err := tensor.Decode(data)
+		if err != nil {
+			return err
+		}
+		modelParam.Params = tensor.ToParams(tensors)
+		modelParam.Tensors = ""
+		return nil
+	}
+	if modelParam.Ref == nil {
+		return nil
+	}
+	data, err := store.Get(*modelParam.Ref)
 	if err != nil {
-		fmt.Println("Error encoding JSON:", err)
 		return err
 	}
-	if err = ioutil.WriteFile(param.UserID+"_"+param.RoundID+".json", prettyJSON, 0644); err != nil {
-		fmt.Println("Error writing output JSON file:", err)
-		return err
+	err = json.Unmarshal(data, &modelParam.Params)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal stored params: %v", err)
 	}
 	return nil
 }
 
-func ReadUserModel_Dy(key string) error {
-	// The gRPC client connection should be shared by all Gateway connections to this endpoint
-	clientConnection := newGrpcConnection()
-
-	id := newIdentity()
-	sign := newSign()
+// UploadSession is an unfinished chunked upload, ChunkDigests holds the SHA-256 of the acknowledged chunks
+type UploadSession struct {
+	UploadID     string   `json:"uploadID"`
+	RoundID      string   `json:"roundID"`
+	UserID       string   `json:"userID"`
+	Format       string   `json:"format"`
+	NumSamples   int      `json:"numSamples"`
+	LocalEpochs  int      `json:"localEpochs"`
+	ChunkDigests []string `json:"chunkDigests"`
+	Size         int64    `json:"size"`
+}
 
-	// Create a Gateway connection for a specific client identity
-	gw, err := client.Connect(
-		id,
-		client.WithSign(sign),
-		client.WithClientConnection(clientConnection),
-		// Default timeouts for different gRPC calls
-		client.WithEvaluateTimeout(5*time.Second),
-		client.WithEndorseTimeout(15*time.Second),
-		client.WithSubmitTimeout(5*time.Second),
-		client.WithCommitStatusTimeout(1*time.Minute),
-	)
-	if err != nil {
-		panic(err)
-	}
-	defer gw.Close()
+// ChunkedUpload describes params that were uploaded in chunks
+type ChunkedUpload struct {
+	UploadID string `json:"uploadID"`
+	Format   string `json:"format"`
+	Chunks   int    `json:"chunks"`
+	Size     int64  `json:"size"`
+	Digest   string `json:"digest"`
+}
 
-	// Override default values for chaincode and channel name as they may differ in testing contexts.
-	chaincodeName := "FL"
-	if ccname := os.Getenv("CHAINCODE_NAME"); ccname != "" {
-		chaincodeName = ccname
+// DefaultChunkSize keeps every chunk transaction well below the gRPC message limit
+const DefaultChunkSize = 1 << 20
 
+// UploadModelParamChunked uploads the params of the JSON file in chunks of chunkSize bytes with BeginUpload, UploadChunk and CommitUpload.
+// An unfinished upload of the same params, e.g. after a crash, is resumed after its last acknowledged chunk
+func (c *Client) UploadModelParamChunked(ctx context.Context, filepath string, groupname string, roundId string, userId string, numSamples int, localEpochs int, chunkSize int, opts ...UploadOption) error {
+	var options uploadOptions
+	for _, opt := range opts {
+		opt(&options)
 	}
-
-	channelName := "mychannel"
-	if cname := os.Getenv("CHANNEL_NAME"); cname != "" {
-		channelName = cname
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
 	}
 
-	network := gw.GetNetwork(channelName)
-	contract := network.GetContract(chaincodeName)
-
-	//EvaluateTransaction is Query,SubmitTransaction is Modify
-	evaluateResult, err := contract.EvaluateTransaction("GetParam", key)
+	params, err := LoadParamsFile(filepath)
 	if err != nil {
-		return fmt.Errorf("failed to evaluate transaction: %v", err)
+		return err
 	}
-	// Unmarshal the result into the ModelParam structure
-	var modelParam ModelParamDy
-	err = json.Unmarshal(evaluateResult, &modelParam)
+	params, err = c.privatizeParams(params, groupname, roundId, userId, options)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal JSON data: %v", err)
+		return err
 	}
+	format := "json"
+	var payload []byte
+	if options.tensorEncoding {
+		format = "tensor"
+		tensors, err := tensor.FromParams(params, options.dtype)
+		if err != nil {
+			return err
+		}
+		payload, err = tensor.Encode(tensors, options.compression)
+		if err != nil {
+			return err
+		}
+	} else {
+		payload, err = json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal params to JSON: %w", err)
+		}
+	}
+	var chunks [][]byte
+	for start := 0; start < len(payload); start += chunkSize {
+		end := start + chunkSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunks = append(chunks, payload[start:end])
+	}
+
+	next := c.resumeIndex(ctx, groupname, roundId, userId, format, numSamples, localEpochs, chunks)
+	if next == 0 {
+		err = c.submitTransaction(ctx, "BeginUpload", groupname, roundId, userId, format, strconv.Itoa(numSamples), strconv.Itoa(localEpochs))
+		if err != nil {
+			return err
+		}
+	} else {
+		c.logf("resuming the upload of user %s at chunk %d of %d", userId, next, len(chunks))
+	}
+
+	for i := next; i < len(chunks); i++ {
+		c.logf("uploading chunk %d/%d", i+1, len(chunks))
+		err = c.submitTransaction(ctx, "UploadChunk", groupname, roundId, userId, strconv.Itoa(i), base64.StdEncoding.EncodeToString(chunks[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.submitTransaction(ctx, "CommitUpload", groupname, roundId, userId, store.Digest(payload))
+}
 
-	// Marshal only the Params field of the ModelParam
-	prettyJSON, err := json.MarshalIndent(modelParam.Params, "", "    ")
+// resumeIndex returns the chunk to resume an unfinished upload at, 0 if the upload has to begin again
+func (c *Client) resumeIndex(ctx context.Context, groupname string, roundId string, userId string, format string, numSamples int, localEpochs int, chunks [][]byte) int {
+	evaluateResult, err := c.evaluate(ctx, "GetUploadSession", groupname, roundId, userId)
 	if err != nil {
-		fmt.Println("Error encoding JSON:", err)
-		return err
+		return 0
 	}
-	if err = ioutil.WriteFile("./modelData/"+key+"_Dy.json", prettyJSON, 0644); err != nil {
-		fmt.Println("Error writing output JSON file:", err)
-		return err
+	var session UploadSession
+	err = json.Unmarshal(evaluateResult, &session)
+	if err != nil {
+		return 0
+	}
+	if session.Format != format || session.NumSamples != numSamples || session.LocalEpochs != localEpochs || len(session.ChunkDigests) > len(chunks) {
+		return 0
+	}
+	// the acknowledged chunks have to be the ones of these params
+	for i, digest := range session.ChunkDigests {
+		if store.Digest(chunks[i]) != digest {
+			return 0
+		}
 	}
-	fmt.Println("file successfully save to " + key + "_" + modelParam.UserID + "_" + modelParam.RoundID + "_Dy.json")
+	return len(session.ChunkDigests)
+}
+
+// fetchChunks downloads the chunks of params uploaded in chunks and checks them against the recorded digest
+func (c *Client) fetchChunks(ctx context.Context, key string, modelParam *ModelParamDy) error {
+	upload := modelParam.Upload
+	data := make([]byte, 0, upload.Size)
+	for i := 0; i < upload.Chunks; i++ {
+		evaluateResult, err := c.readParam(ctx, "GetParamChunk", key, strconv.Itoa(i))
+		if err != nil {
+			return err
+		}
+		chunk, err := base64.StdEncoding.DecodeString(string(evaluateResult))
+		if err != nil {
+			return fmt.Errorf("failed to decode chunk %d: %v", i, err)
+		}
+		data = append(data, chunk...)
+	}
+	if digest := store.Digest(data); digest != upload.Digest {
+		return fmt.Errorf("%w: the chunks of %s hash to %s, expected %s", store.ErrDigestMismatch, key, digest, upload.Digest)
+	}
+
+	if upload.Format == "tensor" {
+		modelParam.Tensors = base64.StdEncoding.EncodeToString(data)
+	} else {
+		err := json.Unmarshal(data, &modelParam.Params)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal JSON data: %v", err)
+		}
+	}
+	modelParam.Upload = nil
 	return nil
 }
 
-func GetExistGroupNameList() error {
-	// The gRPC client connection should be shared by all Gateway connections to this endpoint
-	clientConnection := newGrpcConnection()
+// TensorSpec is the name and shape of a layer of the group model
+type TensorSpec struct {
+	Name  string `json:"name"`
+	Shape []int  `json:"shape"`
+}
 
-	id := newIdentity()
-	sign := newSign()
+// ModelSchema lists the layers every upload of a group has to contain
+type ModelSchema struct {
+	Tensors []TensorSpec `json:"tensors"`
+}
 
-	// Create a Gateway connection for a specific client identity
-	gw, err := client.Connect(
-		id,
-		client.WithSign(sign),
-		client.WithClientConnection(clientConnection),
-		// Default timeouts for different gRPC calls
-		client.WithEvaluateTimeout(5*time.Second),
-		client.WithEndorseTimeout(15*time.Second),
-		client.WithSubmitTimeout(5*time.Second),
-		client.WithCommitStatusTimeout(1*time.Minute),
-	)
+// SchemaFromFile derives the model schema from a params JSON file such as model_parameters_0_4layer.json
+func SchemaFromFile(filepath string) (*ModelSchema, error) {
+	params, err := LoadParamsFile(filepath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	defer gw.Close()
-
-	// Override default values for chaincode and channel name as they may differ in testing contexts.
-	chaincodeName := "FL"
-	if ccname := os.Getenv("CHAINCODE_NAME"); ccname != "" {
-		chaincodeName = ccname
-
+	tensors, err := tensor.FromParams(params, tensor.Float32)
+	if err != nil {
+		return nil, err
 	}
-
-	channelName := "mychannel"
-	if cname := os.Getenv("CHANNEL_NAME"); cname != "" {
-		channelName = cname
+	schema := ModelSchema{Tensors: []TensorSpec{}}
+	for _, t := range tensors {
+		schema.Tensors = append(schema.Tensors, TensorSpec{Name: t.Name, Shape: t.Shape})
 	}
+	return &schema, nil
+}
 
-	network := gw.GetNetwork(channelName)
-	contract := network.GetContract(chaincodeName)
-
-	//EvaluateTransaction is Query,SubmitTransaction is Modify
-	evaluateResult, err := contract.EvaluateTransaction("GetGroupsNameList")
+// RegisterModelSchema registers the tensor names and shapes uploads of the group have to match, only the group owner may submit it
+func (c *Client) RegisterModelSchema(ctx context.Context, groupname string, schema *ModelSchema) error {
+	schemaJSON, err := json.Marshal(schema)
 	if err != nil {
-		return fmt.Errorf("failed to evaluate transaction: %v", err)
+		return fmt.Errorf("failed to marshal model schema: %w", err)
 	}
-	// Unmarshal the result into the ModelParam structure
-	var GroupList ExistGroups
-	err = json.Unmarshal(evaluateResult, &GroupList)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal JSON data: %v", err)
-	}
-	fmt.Println(GroupList)
-	return nil
+	return c.submitTransaction(ctx, "RegisterModelSchema", groupname, string(schemaJSON))
 }
 
-// newGrpcConnection creates a gRPC connection to the Gateway server.
-func newGrpcConnection() *grpc.ClientConn {
-	certificate, err := loadCertificate(tlsCertPath)
+// GetModelSchema reads the model schema registered for a group
+func (c *Client) GetModelSchema(ctx context.Context, groupname string) (*ModelSchema, error) {
+	evaluateResult, err := c.evaluate(ctx, "GetModelSchema", groupname)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-
-	//Use the Org1 user's X.509 certificate as the client identity and use the signature implementation based on that user's private key
-	certPool := x509.NewCertPool()
-	//Add certificate
-	certPool.AddCert(certificate)
-	transportCredentials := credentials.NewClientTLSFromCert(certPool, gatewayPeer)
-
-	connection, err := grpc.Dial(peerEndpoint, grpc.WithTransportCredentials(transportCredentials))
+	var schema ModelSchema
+	err = json.Unmarshal(evaluateResult, &schema)
 	if err != nil {
-		panic(fmt.Errorf("failed to create gRPC connection: %w", err))
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %v", err)
 	}
+	return &schema, nil
+}
 
-	return connection
+// Identity is the X.509 identity of a client as recorded by the dynamic chaincode
+type Identity struct {
+	MSPID string `json:"mspID"`
+	ID    string `json:"id"`
 }
 
-// newIdentity creates a client identity for this Gateway connection using an X.509 certificate.
-func newIdentity() *identity.X509Identity {
-	certificate, err := loadCertificate(certPath)
+// GroupMember is a user of a group, Status is "active" or "suspended"
+type GroupMember struct {
+	UserID string `json:"userID"`
+	MSPID  string `json:"mspID"`
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// AddedBy is the owner that added the user, empty for users that registered themselves
+	AddedBy Identity `json:"addedBy"`
+}
+
+// GroupMembers lists the owner and the users of a group
+type GroupMembers struct {
+	Owner   Identity      `json:"owner"`
+	Members []GroupMember `json:"members"`
+}
+
+// ClientID computes the client identity id the chaincode sees for the certificate in the PEM file
+func ClientID(certFile string) (string, error) {
+	certificate, err := loadCertificate(certFile)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
+	id := fmt.Sprintf("x509::%s::%s", certificate.Subject.ToRDNSequence().String(), certificate.Issuer.ToRDNSequence().String())
+	return base64.StdEncoding.EncodeToString([]byte(id)), nil
+}
 
-	id, err := identity.NewX509Identity(mspID, certificate)
+// AddUser adds a user bound to the identity of the certificate file, only the group owner may submit it
+func (c *Client) AddUser(ctx context.Context, groupname string, userId string, userMspId string, certFile string) error {
+	clientId, err := ClientID(certFile)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	return c.submitTransaction(ctx, "AddUser", groupname, userId, userMspId, clientId)
+}
 
-	return id
+// RemoveUser removes a user from a group, only the group owner may submit it
+func (c *Client) RemoveUser(ctx context.Context, groupname string, userId string) error {
+	return c.submitTransaction(ctx, "RemoveUser", groupname, userId)
 }
 
-func loadCertificate(filename string) (*x509.Certificate, error) {
-	certificatePEM, err := os.ReadFile(filename)
+// SuspendUser stops a user from uploading params, only the group owner may submit it
+func (c *Client) SuspendUser(ctx context.Context, groupname string, userId string) error {
+	return c.submitTransaction(ctx, "SuspendUser", groupname, userId)
+}
+
+// ReinstateUser ends the suspension of a user, only the group owner may submit it
+func (c *Client) ReinstateUser(ctx context.Context, groupname string, userId string) error {
+	return c.submitTransaction(ctx, "ReinstateUser", groupname, userId)
+}
+
+// TransferOwnership hands the group over to the identity of the certificate file, only the group owner may submit it
+func (c *Client) TransferOwnership(ctx context.Context, groupname string, ownerMspId string, certFile string) error {
+	clientId, err := ClientID(certFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+		return err
 	}
-	return identity.CertificateFromPEM(certificatePEM)
+	return c.submitTransaction(ctx, "TransferOwnership", groupname, ownerMspId, clientId)
 }
 
-// newSign creates a function that generates a digital signature from a message digest using a private key.
-func newSign() identity.Sign {
-	files, err := os.ReadDir(keyPath)
+// GetGroupMembers reads the owner of a group and its users with their identities and status
+func (c *Client) GetGroupMembers(ctx context.Context, groupname string) (*GroupMembers, error) {
+	evaluateResult, err := c.evaluate(ctx, "GetGroupMembers", groupname)
 	if err != nil {
-		panic(fmt.Errorf("failed to read private key directory: %w", err))
+		return nil, err
 	}
-	privateKeyPEM, err := os.ReadFile(path.Join(keyPath, files[0].Name()))
-
+	var members GroupMembers
+	err = json.Unmarshal(evaluateResult, &members)
 	if err != nil {
-		panic(fmt.Errorf("failed to read private key file: %w", err))
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %v", err)
 	}
+	return &members, nil
+}
 
-	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+// GetExistGroupNameList reads the names of the groups in the dynamic chaincode
+func (c *Client) GetExistGroupNameList(ctx context.Context) (*ExistGroups, error) {
+	evaluateResult, err := c.evaluate(ctx, "GetGroupsNameList")
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-
-	sign, err := identity.NewPrivateKeySign(privateKey)
+	// Unmarshal the result into the ModelParam structure
+	var GroupList ExistGroups
+	err = json.Unmarshal(evaluateResult, &GroupList)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %v", err)
 	}
-
-	return sign
+	return &GroupList, nil
 }
 
 // Format JSON data
-func formatJSON(data []byte) string {
+func formatJSON(data []byte) (string, error) {
 	var prettyJSON bytes.Buffer
 	if err := json.Indent(&prettyJSON, data, "", "  "); err != nil {
-		panic(fmt.Errorf("failed to parse JSON: %w", err))
+		return "", fmt.Errorf("failed to parse JSON: %w", err)
 	}
-	return prettyJSON.String()
+	return prettyJSON.String(), nil
 }
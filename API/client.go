@@ -0,0 +1,241 @@
+package API
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Config is what a Client needs to reach the gateway peer and the FL chaincode, the config package loads it from a profile
+type Config struct {
+	// Endpoint is the address of the gateway peer, e.g. "localhost:7051"
+	Endpoint string
+	// GatewayPeer is the host name in the TLS certificate of the gateway peer
+	GatewayPeer string
+	MSPID       string
+	// CertPath is the PEM file of the X.509 certificate of the client identity
+	CertPath string
+	// KeyPath is the PEM file of the private key, or a keystore directory whose first file is the key
+	KeyPath string
+	// TLSCertPath is the PEM file of the CA certificate that signed the TLS certificate of the gateway peer
+	TLSCertPath string
+	Channel     string
+	Chaincode   string
+	// The timeouts of the gRPC calls, zero keeps the default of the gateway client
+	EvaluateTimeout     time.Duration
+	EndorseTimeout      time.Duration
+	SubmitTimeout       time.Duration
+	CommitStatusTimeout time.Duration
+	// Logger receives the progress of the calls, such as the transactions submitted, nothing is logged when nil
+	Logger *log.Logger
+}
+
+// Client is a connection to the FL chaincode through the gateway peer. Build it once with NewClient,
+// share it between all calls and Close it when done
+type Client struct {
+	config     Config
+	connection *grpc.ClientConn
+	gateway    *client.Gateway
+	network    *client.Network
+	contract   *client.Contract
+	// ownsConnection is false for the clients of a Wallet, they share the connection of their endpoint
+	ownsConnection bool
+}
+
+// NewClient opens the gRPC connection to the gateway peer and connects with the identity of the config
+func NewClient(config Config) (*Client, error) {
+	connection, err := newGrpcConnection(config)
+	if err != nil {
+		return nil, err
+	}
+	c, err := connect(config, connection)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+	c.ownsConnection = true
+	return c, nil
+}
+
+// connect connects to the gateway over an open gRPC connection with the identity of the config
+func connect(config Config, connection *grpc.ClientConn) (*Client, error) {
+	id, err := newIdentity(config)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := newSign(config)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []client.ConnectOption{
+		client.WithSign(sign),
+		client.WithClientConnection(connection),
+	}
+	if config.EvaluateTimeout > 0 {
+		options = append(options, client.WithEvaluateTimeout(config.EvaluateTimeout))
+	}
+	if config.EndorseTimeout > 0 {
+		options = append(options, client.WithEndorseTimeout(config.EndorseTimeout))
+	}
+	if config.SubmitTimeout > 0 {
+		options = append(options, client.WithSubmitTimeout(config.SubmitTimeout))
+	}
+	if config.CommitStatusTimeout > 0 {
+		options = append(options, client.WithCommitStatusTimeout(config.CommitStatusTimeout))
+	}
+	gw, err := client.Connect(id, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the gateway: %w", err)
+	}
+
+	network := gw.GetNetwork(config.Channel)
+	return &Client{
+		config:     config,
+		connection: connection,
+		gateway:    gw,
+		network:    network,
+		contract:   network.GetContract(config.Chaincode),
+	}, nil
+}
+
+// Config returns the config the client was built from
+func (c *Client) Config() Config {
+	return c.config
+}
+
+// Close closes the gateway and its gRPC connection, event subscriptions of the client stop with it.
+// The connection of a client from a Wallet stays open until the wallet is closed
+func (c *Client) Close() error {
+	err := c.gateway.Close()
+	if !c.ownsConnection {
+		return err
+	}
+	if closeErr := c.connection.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// submit submits a transaction and waits for its commit, failures are returned as an EndorseError, CommitError or TransportError
+func (c *Client) submit(ctx context.Context, name string, options ...client.ProposalOption) ([]byte, error) {
+	c.logf("--> Submit Transaction: %s", name)
+
+	result, err := c.contract.SubmitWithContext(ctx, name, options...)
+	if err != nil {
+		return nil, transactionError(name, err)
+	}
+
+	c.logf("*** Transaction committed successfully")
+	return result, nil
+}
+
+// logf reports the progress to the logger of the config, if there is one
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.config.Logger != nil {
+		c.config.Logger.Printf(format, args...)
+	}
+}
+
+// submitTransaction submits a transaction with string arguments
+func (c *Client) submitTransaction(ctx context.Context, name string, args ...string) error {
+	_, err := c.submit(ctx, name, client.WithArguments(args...))
+	return err
+}
+
+// evaluate runs a query, EvaluateTransaction is Query,SubmitTransaction is Modify.
+// Failures are returned as an EndorseError or TransportError
+func (c *Client) evaluate(ctx context.Context, name string, args ...string) ([]byte, error) {
+	evaluateResult, err := c.contract.EvaluateWithContext(ctx, name, client.WithArguments(args...))
+	if err != nil {
+		return nil, transactionError(name, err)
+	}
+	return evaluateResult, nil
+}
+
+// newGrpcConnection creates a gRPC connection to the Gateway server.
+func newGrpcConnection(config Config) (*grpc.ClientConn, error) {
+	certificate, err := loadCertificate(config.TLSCertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool := x509.NewCertPool()
+	//Add certificate
+	certPool.AddCert(certificate)
+	transportCredentials := credentials.NewClientTLSFromCert(certPool, config.GatewayPeer)
+
+	connection, err := grpc.Dial(config.Endpoint, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
+	}
+
+	return connection, nil
+}
+
+// newIdentity creates a client identity for this Gateway connection using an X.509 certificate.
+func newIdentity(config Config) (*identity.X509Identity, error) {
+	certificate, err := loadCertificate(config.CertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := identity.NewX509Identity(config.MSPID, certificate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the client identity: %w", err)
+	}
+
+	return id, nil
+}
+
+func loadCertificate(filename string) (*x509.Certificate, error) {
+	certificatePEM, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+	}
+	return identity.CertificateFromPEM(certificatePEM)
+}
+
+// newSign creates a function that generates a digital signature from a message digest using a private key.
+func newSign(config Config) (identity.Sign, error) {
+	keyFile := config.KeyPath
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	if info.IsDir() {
+		files, err := os.ReadDir(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key directory: %w", err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("the private key directory %s is empty", keyFile)
+		}
+		keyFile = path.Join(keyFile, files[0].Name())
+	}
+	privateKeyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	sign, err := identity.NewPrivateKeySign(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the private key signer: %w", err)
+	}
+
+	return sign, nil
+}
@@ -0,0 +1,172 @@
+package API
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Errors the chaincode reports about groups and rounds, failed calls wrap them so callers can test with errors.Is
+var (
+	// ErrNotRegistered is returned when the user is not a member of the group
+	ErrNotRegistered = errors.New("not registered")
+	// ErrAlreadyRegistered is returned when the user or the group already exists
+	ErrAlreadyRegistered = errors.New("already registered")
+	// ErrRoundClosed is returned when the round does not take uploads, it is not open yet, aggregating, closed or failed
+	ErrRoundClosed = errors.New("round closed")
+	// ErrNotFound is returned when the group, params, report, schema or upload does not exist
+	ErrNotFound = errors.New("not found")
+)
+
+// chaincodeReasons maps the codes that start the messages of the chaincode errors to the errors above.
+// The peers wrap the message of the chaincode, so the code is looked for as "<code>: " anywhere in a message
+var chaincodeReasons = map[string]error{
+	"FL_NOT_REGISTERED":     ErrNotRegistered,
+	"FL_ALREADY_REGISTERED": ErrAlreadyRegistered,
+	"FL_ROUND_CLOSED":       ErrRoundClosed,
+	"FL_NOT_FOUND":          ErrNotFound,
+}
+
+// ErrorDetail is the error a peer or orderer returned for a transaction
+type ErrorDetail struct {
+	Address string
+	MSPID   string
+	Message string
+}
+
+// TransactionError is a failed call of a transaction, it holds the gRPC status and the errors of the peers behind it.
+// It is returned as an EndorseError, CommitError or TransportError
+type TransactionError struct {
+	Transaction   string
+	TransactionID string
+	Code          codes.Code
+	Message       string
+	Details       []ErrorDetail
+	stage         string
+	reason        error
+	err           error
+}
+
+func (e *TransactionError) Error() string {
+	message := fmt.Sprintf("failed to %s transaction %s: %s", e.stage, e.Transaction, e.Message)
+	for _, detail := range e.Details {
+		message += fmt.Sprintf("\n  %s (%s): %s", detail.Address, detail.MSPID, detail.Message)
+	}
+	return message
+}
+
+// Unwrap returns the chaincode error the failure matched, if any, and the error of the gateway client
+func (e *TransactionError) Unwrap() []error {
+	if e.reason == nil {
+		return []error{e.err}
+	}
+	return []error{e.reason, e.err}
+}
+
+// EndorseError is a transaction the peers refused to endorse or evaluate, usually because the chaincode returned an error
+type EndorseError struct {
+	*TransactionError
+}
+
+// CommitError is an endorsed transaction that was not committed, ValidationCode is set when the peers invalidated it
+type CommitError struct {
+	*TransactionError
+	ValidationCode peer.TxValidationCode
+}
+
+// TransportError is a transaction that did not reach the gateway or whose result did not come back in time
+type TransportError struct {
+	*TransactionError
+}
+
+// transactionError turns an error of the gateway client into an EndorseError, CommitError or TransportError
+func transactionError(name string, err error) error {
+	grpcStatus := status.Convert(err)
+	txErr := &TransactionError{
+		Transaction: name,
+		Code:        grpcStatus.Code(),
+		Message:     grpcStatus.Message(),
+		err:         err,
+	}
+	for _, detail := range grpcStatus.Details() {
+		if errorDetail, ok := detail.(*gateway.ErrorDetail); ok {
+			txErr.Details = append(txErr.Details, ErrorDetail{
+				Address: errorDetail.GetAddress(),
+				MSPID:   errorDetail.GetMspId(),
+				Message: errorDetail.GetMessage(),
+			})
+		}
+	}
+	txErr.reason = chaincodeReason(txErr.messages())
+
+	var endorseErr *client.EndorseError
+	var submitErr *client.SubmitError
+	var commitStatusErr *client.CommitStatusError
+	var commitErr *client.CommitError
+	switch {
+	case errors.As(err, &endorseErr):
+		txErr.TransactionID = endorseErr.TransactionID
+	case errors.As(err, &submitErr):
+		txErr.TransactionID = submitErr.TransactionID
+	case errors.As(err, &commitStatusErr):
+		txErr.TransactionID = commitStatusErr.TransactionID
+	case errors.As(err, &commitErr):
+		txErr.TransactionID = commitErr.TransactionID
+		txErr.stage = "commit"
+		return &CommitError{TransactionError: txErr, ValidationCode: commitErr.Code}
+	}
+
+	if transportFailure(err, txErr.Code) {
+		txErr.stage = "send"
+		return &TransportError{TransactionError: txErr}
+	}
+	if submitErr != nil || commitStatusErr != nil {
+		txErr.stage = "commit"
+		return &CommitError{TransactionError: txErr}
+	}
+	txErr.stage = "endorse"
+	if endorseErr == nil {
+		txErr.stage = "evaluate"
+	}
+	return &EndorseError{TransactionError: txErr}
+}
+
+// messages returns the message of the gRPC status and those of the peers
+func (e *TransactionError) messages() []string {
+	messages := []string{e.Message}
+	for _, detail := range e.Details {
+		messages = append(messages, detail.Message)
+	}
+	return messages
+}
+
+// chaincodeReason finds the code of the chaincode error in the messages of a failed transaction, nil if there is none
+func chaincodeReason(messages []string) error {
+	for _, message := range messages {
+		for code, reason := range chaincodeReasons {
+			if strings.Contains(message, code+": ") {
+				return reason
+			}
+		}
+	}
+	return nil
+}
+
+// transportFailure tells whether the call failed on the way to or from the gateway rather than in the chaincode
+func transportFailure(err error, code codes.Code) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package API
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// Chaincode events of the round lifecycle
+const (
+	EventParamUploaded   = "ParamUploaded"
+	EventQuorumReached   = "QuorumReached"
+	EventRoundAggregated = "RoundAggregated"
+	EventRoundFailed     = "RoundFailed"
+)
+
+// RoundEvent is an event of the round lifecycle emitted by the Dy chaincode
+type RoundEvent struct {
+	Event     string `json:"event"`
+	GroupName string `json:"groupName"`
+	RoundID   string `json:"roundID"`
+	// UserID is the uploader of ParamUploaded
+	UserID   string `json:"userID,omitempty"`
+	Uploaded int    `json:"uploaded"`
+	// Key is the key of the aggregated params of RoundAggregated
+	Key           string `json:"key,omitempty"`
+	BlockNumber   uint64 `json:"-"`
+	TransactionID string `json:"-"`
+	// lastInTransaction marks the last event of its transaction, checkpointing it moves past the transaction
+	lastInTransaction bool
+}
+
+// EventSubscription delivers the round events of the chaincode in ledger order.
+// Events are replayed from the checkpoint after a restart, so call Checkpoint once an event is handled
+type EventSubscription struct {
+	Events       <-chan RoundEvent
+	checkpointer *client.FileCheckpointer
+	cancel       context.CancelFunc
+}
+
+// SubscribeRoundEvents listens to the round events of the chaincode. The position is kept in checkpointFile,
+// a new subscription resumes after the last checkpointed event or starts at the next block if there is none
+func (c *Client) SubscribeRoundEvents(ctx context.Context, checkpointFile string) (*EventSubscription, error) {
+	checkpointer, err := client.NewFileCheckpointer(checkpointFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the event checkpoint: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	chaincodeEvents, err := c.network.ChaincodeEvents(ctx, c.config.Chaincode, client.WithCheckpoint(checkpointer))
+	if err != nil {
+		cancel()
+		checkpointer.Close()
+		return nil, fmt.Errorf("failed to start chaincode event listening: %w", err)
+	}
+
+	events := make(chan RoundEvent)
+	go func() {
+		defer close(events)
+		for chaincodeEvent := range chaincodeEvents {
+			var roundEvents []RoundEvent
+			err := json.Unmarshal(chaincodeEvent.Payload, &roundEvents)
+			if err != nil {
+				c.logf("skipping event %s of transaction %s: %v", chaincodeEvent.EventName, chaincodeEvent.TransactionID, err)
+				continue
+			}
+			for i, event := range roundEvents {
+				event.BlockNumber = chaincodeEvent.BlockNumber
+				event.TransactionID = chaincodeEvent.TransactionID
+				event.lastInTransaction = i == len(roundEvents)-1
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return &EventSubscription{
+		Events:       events,
+		checkpointer: checkpointer,
+		cancel:       cancel,
+	}, nil
+}
+
+// Checkpoint records that the event was handled. A transaction is only passed once its last event is checkpointed,
+// so a restarted subscription never skips events of a partly handled transaction
+func (s *EventSubscription) Checkpoint(event RoundEvent) error {
+	if !event.lastInTransaction {
+		return nil
+	}
+	err := s.checkpointer.CheckpointTransaction(event.BlockNumber, event.TransactionID)
+	if err != nil {
+		return fmt.Errorf("failed to save the event checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Close stops the subscription and closes its checkpoint file, the connection of the client stays open
+func (s *EventSubscription) Close() error {
+	s.cancel()
+	return s.checkpointer.Close()
+}
+
+// WaitForRound handles the events until one of the named events arrives for the round and returns it.
+// The events passed on the way are checkpointed
+func (s *EventSubscription) WaitForRound(ctx context.Context, groupname string, roundId string, names ...string) (*RoundEvent, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case event, ok := <-s.Events:
+			if !ok {
+				return nil, fmt.Errorf("the event stream of round %s of group %s ended", roundId, groupname)
+			}
+			err := s.Checkpoint(event)
+			if err != nil {
+				return nil, err
+			}
+			if event.GroupName != groupname || event.RoundID != roundId {
+				continue
+			}
+			for _, name := range names {
+				if event.Event == name {
+					return &event, nil
+				}
+			}
+		}
+	}
+}
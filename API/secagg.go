@@ -0,0 +1,372 @@
+package API
+
+import (
+	"Capstone_go/secagg"
+	"Capstone_go/tensor"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"os"
+	"path"
+	"strconv"
+)
+
+// SecAggConfig turns on secure aggregation for a group, the chaincode then only learns the sum of the uploads.
+// Threshold is the number of survivors needed to unmask a round, at least a majority of the participants
+type SecAggConfig struct {
+	Enabled   bool `json:"enabled"`
+	Threshold int  `json:"threshold,omitempty"`
+}
+
+// SecAggRound is the secure aggregation state of a round
+type SecAggRound struct {
+	RoundID      string   `json:"roundID"`
+	Phase        string   `json:"phase"`
+	Threshold    int      `json:"threshold"`
+	Keyed        []string `json:"keyed"`
+	Participants []string `json:"participants"`
+	Shared       []string `json:"shared"`
+	Sharers      []string `json:"sharers"`
+	Survivors    []string `json:"survivors"`
+	Revealed     []string `json:"revealed"`
+}
+
+// SecAggKeys are the public keys a user advertised for a round
+type SecAggKeys struct {
+	UserID   string `json:"userID"`
+	ShareKey string `json:"shareKey"`
+	MaskKey  string `json:"maskKey"`
+}
+
+type secAggEncryptedShare struct {
+	From       string `json:"from"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+type secAggShares struct {
+	Shares       map[string]string `json:"shares"`
+	SelfSeedHash string            `json:"selfSeedHash"`
+}
+
+type secAggReveal struct {
+	SelfSeeds map[string]secagg.Share `json:"selfSeeds"`
+	MaskKeys  map[string]secagg.Share `json:"maskKeys"`
+}
+
+// secAggSession holds the secrets of a user for a round, they never leave the client
+type secAggSession struct {
+	ShareKey secagg.KeyPair `json:"shareKey"`
+	MaskKey  secagg.KeyPair `json:"maskKey"`
+	SelfSeed []byte         `json:"selfSeed"`
+}
+
+// SecAggAdvertiseKeys creates the key pairs of a user for a round, keeps them in dir and sends the public keys
+func (c *Client) SecAggAdvertiseKeys(ctx context.Context, groupname string, roundId string, userId string, dir string) error {
+	var session secAggSession
+	var err error
+	session.ShareKey, err = secagg.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+	session.MaskKey, err = secagg.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+	session.SelfSeed, err = secagg.NewSeed()
+	if err != nil {
+		return err
+	}
+	err = saveSecAggSession(dir, groupname, roundId, userId, &session)
+	if err != nil {
+		return err
+	}
+
+	return c.submitTransaction(ctx, "SubmitSecAggKeys", groupname, roundId, userId,
+		base64.StdEncoding.EncodeToString(session.ShareKey.Public), base64.StdEncoding.EncodeToString(session.MaskKey.Public))
+}
+
+// SecAggShareKeys Shamir-shares the mask key and the self-mask seed of a user with the participants of the round,
+// every share is encrypted for its receiver
+func (c *Client) SecAggShareKeys(ctx context.Context, groupname string, roundId string, userId string, dir string) error {
+	session, err := loadSecAggSession(dir, groupname, roundId, userId)
+	if err != nil {
+		return err
+	}
+
+	state, err := c.GetSecAggRound(ctx, groupname, roundId)
+	if err != nil {
+		return err
+	}
+	keys, err := c.getSecAggKeys(ctx, groupname, roundId)
+	if err != nil {
+		return err
+	}
+
+	n := len(state.Participants)
+	maskKeyShares, err := secagg.Split(session.MaskKey.Private, n, state.Threshold)
+	if err != nil {
+		return err
+	}
+	selfSeedShares, err := secagg.Split(session.SelfSeed, n, state.Threshold)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(session.SelfSeed)
+	shares := secAggShares{Shares: make(map[string]string), SelfSeedHash: hex.EncodeToString(hash[:])}
+	for i, participant := range state.Participants {
+		peer, err := publicKey(keys, participant, false)
+		if err != nil {
+			return err
+		}
+		pair := secagg.SharePair{MaskKey: maskKeyShares[i], SelfSeed: selfSeedShares[i]}
+		aad := secagg.ShareAAD(groupname, roundId, userId, participant)
+		shares.Shares[participant], err = secagg.EncryptShares(session.ShareKey.Private, peer, aad, pair)
+		if err != nil {
+			return err
+		}
+	}
+	sharesJSON, err := json.Marshal(shares)
+	if err != nil {
+		return err
+	}
+
+	return c.submitTransaction(ctx, "SubmitSecAggShares", groupname, roundId, userId, string(sharesJSON))
+}
+
+// UploadMaskedParam uploads the params of a user masked with its self mask and the pairwise masks it shares with the
+// other sharers of the round. The params are weighted by numSamples so the chaincode can average the unmasked sum
+func (c *Client) UploadMaskedParam(ctx context.Context, filepath string, groupname string, roundId string, userId string, numSamples int, localEpochs int, dir string, opts ...UploadOption) error {
+	var options uploadOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	session, err := loadSecAggSession(dir, groupname, roundId, userId)
+	if err != nil {
+		return err
+	}
+	params, err := LoadParamsFile(filepath)
+	if err != nil {
+		return err
+	}
+	params, err = c.privatizeParams(params, groupname, roundId, userId, options)
+	if err != nil {
+		return err
+	}
+
+	tensors, err := tensor.FromParams(params, tensor.Float32)
+	if err != nil {
+		return err
+	}
+	layout := make([]secagg.TensorSpec, 0, len(tensors))
+	var values []float64
+	for _, t := range tensors {
+		layout = append(layout, secagg.TensorSpec{Name: t.Name, Shape: t.Shape})
+		for _, value := range t.Data {
+			values = append(values, float64(value))
+		}
+	}
+	state, err := c.GetSecAggRound(ctx, groupname, roundId)
+	if err != nil {
+		return err
+	}
+	// at most the sharers upload, their sum must not wrap
+	masked, err := secagg.Encode(values, float64(numSamples), len(state.Sharers))
+	if err != nil {
+		return err
+	}
+	keys, err := c.getSecAggKeys(ctx, groupname, roundId)
+	if err != nil {
+		return err
+	}
+	err = secagg.AddMask(masked, session.SelfSeed, 1)
+	if err != nil {
+		return err
+	}
+	for _, sharer := range state.Sharers {
+		if sharer == userId {
+			continue
+		}
+		peer, err := publicKey(keys, sharer, true)
+		if err != nil {
+			return err
+		}
+		seed, err := secagg.PairSeed(session.MaskKey.Private, peer)
+		if err != nil {
+			return err
+		}
+		err = secagg.AddMask(masked, seed, pairSign(state.Participants, userId, sharer))
+		if err != nil {
+			return err
+		}
+	}
+	maskedJSON, err := json.Marshal(secagg.Pack(layout, masked))
+	if err != nil {
+		return err
+	}
+	c.logf("the length of data is %d", len(maskedJSON))
+
+	return c.submitTransaction(ctx, "UploadMaskedParam", groupname, roundId, userId, string(maskedJSON), strconv.Itoa(numSamples), strconv.Itoa(localEpochs))
+}
+
+// SecAggReveal decrypts the shares a user received and reveals the self-mask seed shares of the survivors
+// and the mask key shares of the sharers that dropped out
+func (c *Client) SecAggReveal(ctx context.Context, groupname string, roundId string, userId string, dir string) error {
+	session, err := loadSecAggSession(dir, groupname, roundId, userId)
+	if err != nil {
+		return err
+	}
+
+	state, err := c.GetSecAggRound(ctx, groupname, roundId)
+	if err != nil {
+		return err
+	}
+	keys, err := c.getSecAggKeys(ctx, groupname, roundId)
+	if err != nil {
+		return err
+	}
+	evaluateResult, err := c.evaluate(ctx, "GetSecAggShares", groupname, roundId, userId)
+	if err != nil {
+		return err
+	}
+	var received []secAggEncryptedShare
+	err = json.Unmarshal(evaluateResult, &received)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON data: %v", err)
+	}
+
+	reveal := secAggReveal{SelfSeeds: make(map[string]secagg.Share), MaskKeys: make(map[string]secagg.Share)}
+	for _, share := range received {
+		if !contains(state.Sharers, share.From) {
+			continue
+		}
+		peer, err := publicKey(keys, share.From, false)
+		if err != nil {
+			return err
+		}
+		aad := secagg.ShareAAD(groupname, roundId, share.From, userId)
+		pair, err := secagg.DecryptShares(session.ShareKey.Private, peer, aad, share.Ciphertext)
+		if err != nil {
+			return fmt.Errorf("failed to open the shares from %s: %w", share.From, err)
+		}
+		if contains(state.Survivors, share.From) {
+			reveal.SelfSeeds[share.From] = pair.SelfSeed
+		} else {
+			reveal.MaskKeys[share.From] = pair.MaskKey
+		}
+	}
+	revealJSON, err := json.Marshal(reveal)
+	if err != nil {
+		return err
+	}
+
+	// the shares are passed as transient data, the chaincode keeps them in the private data collection of the group
+	_, err = c.submit(ctx, "SubmitSecAggReveal",
+		client.WithArguments(groupname, roundId, userId),
+		client.WithTransient(map[string][]byte{"reveal": revealJSON}))
+	return err
+}
+
+// AdvanceSecAgg ends the key or share phase of a round without the users that did not respond, only the group owner may call it
+func (c *Client) AdvanceSecAgg(ctx context.Context, groupname string, roundId string) error {
+	return c.submitTransaction(ctx, "AdvanceSecAgg", groupname, roundId)
+}
+
+// GetSecAggRound returns the secure aggregation state of a round
+func (c *Client) GetSecAggRound(ctx context.Context, groupname string, roundId string) (*SecAggRound, error) {
+	evaluateResult, err := c.evaluate(ctx, "GetSecAggRound", groupname, roundId)
+	if err != nil {
+		return nil, err
+	}
+	var state SecAggRound
+	err = json.Unmarshal(evaluateResult, &state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %v", err)
+	}
+	return &state, nil
+}
+
+func (c *Client) getSecAggKeys(ctx context.Context, groupname string, roundId string) ([]SecAggKeys, error) {
+	evaluateResult, err := c.evaluate(ctx, "GetSecAggKeys", groupname, roundId)
+	if err != nil {
+		return nil, err
+	}
+	var keys []SecAggKeys
+	err = json.Unmarshal(evaluateResult, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %v", err)
+	}
+	return keys, nil
+}
+
+// publicKey returns the mask or share public key a user advertised
+func publicKey(keys []SecAggKeys, userId string, mask bool) ([]byte, error) {
+	for _, key := range keys {
+		if key.UserID != userId {
+			continue
+		}
+		if mask {
+			return base64.StdEncoding.DecodeString(key.MaskKey)
+		}
+		return base64.StdEncoding.DecodeString(key.ShareKey)
+	}
+	return nil, fmt.Errorf("user %s advertised no keys", userId)
+}
+
+// pairSign is the sign a user applies to the mask it shares with a peer, the one earlier in the participants adds it
+func pairSign(participants []string, userId string, peer string) int {
+	for _, participant := range participants {
+		if participant == userId {
+			return 1
+		}
+		if participant == peer {
+			return -1
+		}
+	}
+	return 1
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func secAggSessionPath(dir string, groupname string, roundId string, userId string) string {
+	return path.Join(dir, fmt.Sprintf("%s_%s_%s_secagg.json", groupname, roundId, userId))
+}
+
+func saveSecAggSession(dir string, groupname string, roundId string, userId string, session *secAggSession) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create the secure aggregation dir: %w", err)
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(secAggSessionPath(dir, groupname, roundId, userId), data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write the secure aggregation session: %w", err)
+	}
+	return nil
+}
+
+func loadSecAggSession(dir string, groupname string, roundId string, userId string) (*secAggSession, error) {
+	data, err := os.ReadFile(secAggSessionPath(dir, groupname, roundId, userId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the secure aggregation session: %w", err)
+	}
+	var session secAggSession
+	err = json.Unmarshal(data, &session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the secure aggregation session: %w", err)
+	}
+	return &session, nil
+}
@@ -0,0 +1,126 @@
+package API
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// ErrUnknownParticipant is returned for a participant that has no identity in the wallet
+var ErrUnknownParticipant = errors.New("unknown participant")
+
+// WalletIdentity is the identity of a participant. The connection fields are optional,
+// when set the participant reaches the network through a peer of its own org
+type WalletIdentity struct {
+	MSPID string
+	// CertPath is the PEM file of the X.509 certificate of the participant
+	CertPath string
+	// KeyPath is the PEM file of the private key, or a keystore directory whose first file is the key
+	KeyPath     string
+	Endpoint    string
+	GatewayPeer string
+	TLSCertPath string
+}
+
+// Wallet maps the participants of a run to their own identities, possibly of different orgs.
+// Every participant gets its own Client, the clients of one endpoint share a gRPC connection
+type Wallet struct {
+	base        Config
+	identities  map[string]WalletIdentity
+	mutex       sync.Mutex
+	clients     map[string]*Client
+	connections map[string]*grpc.ClientConn
+}
+
+// NewWallet creates a wallet whose participants connect with the channel, chaincode, timeouts
+// and, unless their identity names its own peer, the gateway peer of the base config
+func NewWallet(base Config, identities map[string]WalletIdentity) *Wallet {
+	return &Wallet{
+		base:        base,
+		identities:  identities,
+		clients:     make(map[string]*Client),
+		connections: make(map[string]*grpc.ClientConn),
+	}
+}
+
+// Participants lists the participants of the wallet in name order
+func (w *Wallet) Participants() []string {
+	participants := make([]string, 0, len(w.identities))
+	for participant := range w.identities {
+		participants = append(participants, participant)
+	}
+	sort.Strings(participants)
+	return participants
+}
+
+// Has tells whether the participant has an identity in the wallet
+func (w *Wallet) Has(participant string) bool {
+	_, exists := w.identities[participant]
+	return exists
+}
+
+// Config returns the client config of the participant
+func (w *Wallet) Config(participant string) (Config, error) {
+	id, exists := w.identities[participant]
+	if !exists {
+		return Config{}, fmt.Errorf("%w: %s", ErrUnknownParticipant, participant)
+	}
+	config := w.base
+	config.MSPID = id.MSPID
+	config.CertPath = id.CertPath
+	config.KeyPath = id.KeyPath
+	if id.Endpoint != "" {
+		config.Endpoint = id.Endpoint
+		config.GatewayPeer = id.GatewayPeer
+		config.TLSCertPath = id.TLSCertPath
+	}
+	return config, nil
+}
+
+// Client returns the client of the participant, it is connected on first use and closed with the wallet
+func (w *Wallet) Client(participant string) (*Client, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if c, exists := w.clients[participant]; exists {
+		return c, nil
+	}
+	config, err := w.Config(participant)
+	if err != nil {
+		return nil, err
+	}
+	connection, exists := w.connections[config.Endpoint]
+	if !exists {
+		connection, err = newGrpcConnection(config)
+		if err != nil {
+			return nil, err
+		}
+		w.connections[config.Endpoint] = connection
+	}
+	c, err := connect(config, connection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect participant %s: %w", participant, err)
+	}
+	w.clients[participant] = c
+	return c, nil
+}
+
+// Close closes the clients of the participants and their connections
+func (w *Wallet) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var errs []error
+	for _, c := range w.clients {
+		errs = append(errs, c.Close())
+	}
+	for _, connection := range w.connections {
+		errs = append(errs, connection.Close())
+	}
+	w.clients = make(map[string]*Client)
+	w.connections = make(map[string]*grpc.ClientConn)
+	return errors.Join(errs...)
+}
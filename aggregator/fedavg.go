@@ -0,0 +1,147 @@
+// Package aggregator aggregates the params of groups that keep them off chain.
+// It downloads the uploads of a round that reached its quorum, verifies them against their digest,
+// averages them weighted by their sample count and posts the digest of the result to the ledger
+package aggregator
+
+import (
+	"Capstone_go/API"
+	"Capstone_go/store"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// FedAvg aggregates a round waiting for its off-chain aggregate, the client has to connect with the identity of the group owner
+func FedAvg(ctx context.Context, client *API.Client, groupname string, roundId string, paramStore store.Store) (*store.Object, error) {
+	status, err := client.GetRoundStatus(ctx, groupname, roundId)
+	if err != nil {
+		return nil, err
+	}
+	if status.Status != "aggregating" {
+		return nil, fmt.Errorf("round %s of group %s is %s, not waiting for an aggregate", roundId, groupname, status.Status)
+	}
+	members, err := client.GetGroupMembers(ctx, groupname)
+	if err != nil {
+		return nil, err
+	}
+
+	// the chaincode leaves the uploads of suspended users out of the round
+	active := make(map[string]bool)
+	for _, member := range members.Members {
+		if member.Status != "suspended" {
+			active[member.UserID] = true
+		}
+	}
+	var params []map[string]interface{}
+	var weights []float64
+	for _, userId := range status.Uploaded {
+		if !active[userId] {
+			continue
+		}
+		upload, err := client.GetModelParamDy(ctx, groupname+"_PARAM_"+userId+"_"+roundId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the params of user %s: %w", userId, err)
+		}
+		weight := float64(upload.NumSamples)
+		if weight <= 0 {
+			weight = 1
+		}
+		params = append(params, upload.Params)
+		weights = append(weights, weight)
+	}
+	if len(params) == 0 {
+		return nil, fmt.Errorf("no user params found for aggregation")
+	}
+
+	aggreParams, err := WeightedMean(params, weights)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(aggreParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal aggregated params: %w", err)
+	}
+	object, err := paramStore.Put(data)
+	if err != nil {
+		return nil, err
+	}
+	err = client.SubmitAggregate(ctx, groupname, roundId, object)
+	if err != nil {
+		return nil, err
+	}
+	return &object, nil
+}
+
+// WeightedMean averages params of the same layout, every param is weighted by its weight
+func WeightedMean(params []map[string]interface{}, weights []float64) (map[string]interface{}, error) {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	values := make([]interface{}, len(params))
+	for i, param := range params {
+		values[i] = param
+	}
+	result, err := meanRecursive(values, weights, total, "")
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[string]interface{}), nil
+}
+
+func meanRecursive(values []interface{}, weights []float64, total float64, name string) (interface{}, error) {
+	switch first := values[0].(type) {
+	case float64:
+		sum := 0.0
+		for i, value := range values {
+			number, ok := value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("params differ in layout at %s", name)
+			}
+			sum += number * weights[i]
+		}
+		return sum / total, nil
+	case []interface{}:
+		result := make([]interface{}, len(first))
+		for j := range first {
+			column := make([]interface{}, len(values))
+			for i, value := range values {
+				list, ok := value.([]interface{})
+				if !ok || len(list) != len(first) {
+					return nil, fmt.Errorf("params differ in layout at %s", name)
+				}
+				column[i] = list[j]
+			}
+			mean, err := meanRecursive(column, weights, total, fmt.Sprintf("%s[%d]", name, j))
+			if err != nil {
+				return nil, err
+			}
+			result[j] = mean
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(first))
+		for key := range first {
+			column := make([]interface{}, len(values))
+			for i, value := range values {
+				entries, ok := value.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("params differ in layout at %s", name)
+				}
+				entry, exists := entries[key]
+				if !exists {
+					return nil, fmt.Errorf("params differ in layout, %s is missing", key)
+				}
+				column[i] = entry
+			}
+			mean, err := meanRecursive(column, weights, total, key)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = mean
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unsupported value at %s", name)
+	}
+}
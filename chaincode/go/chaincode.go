@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 	"log"
-	"math"
 )
 
 // SmartContract provides functions
@@ -33,7 +32,10 @@ type ModelParam struct {
 }
 
 type Group struct {
-	Users []string `json:"users"`
+	Users  []string    `json:"users"`
+	Policy GroupPolicy `json:"policy"`
+	// Owner 是创建组的客户端身份id，只有它可以修改组策略
+	Owner string `json:"owner,omitempty"`
 }
 
 func (s *SmartContract) RegisterUser(ctx contractapi.TransactionContextInterface, groupname string, userID string) error {
@@ -48,6 +50,12 @@ func (s *SmartContract) RegisterUser(ctx contractapi.TransactionContextInterface
 		if err != nil {
 			return fmt.Errorf("failed to unmarshal group: %s", err.Error())
 		}
+	} else {
+		// 第一个注册的用户创建组并成为组的所有者
+		group.Owner, err = ctx.GetClientIdentity().GetID()
+		if err != nil {
+			return fmt.Errorf("failed to get the caller identity: %s", err.Error())
+		}
 	}
 
 	// 检查用户是否已在组内
@@ -127,7 +135,7 @@ func (s *SmartContract) UploadModelParam(ctx contractapi.TransactionContextInter
 		return err
 	}
 	// check if most users upload the params
-	return s.checkAllUploaded(ctx, groupname, group.Users, roundID)
+	return s.checkAllUploaded(ctx, groupname, &group, roundID)
 }
 
 func (s *SmartContract) GetParam(ctx contractapi.TransactionContextInterface, key string) (*ModelParam, error) {
@@ -166,30 +174,134 @@ func (s *SmartContract) GetAggregatedParams(ctx contractapi.TransactionContextIn
 	return &Modelparam, nil
 }
 
-// CheckAllUploaded 检查是否所有用户都已上传参数，如果全部上传则调用聚合函数，具体实现就是维护一个全局的userid数组，遍历该数组在fabric上进行key查询，如果有一个没查到就说明没有上传完全
-func (s *SmartContract) checkAllUploaded(ctx contractapi.TransactionContextInterface, groupname string, usersId []string, roundID string) error {
-	// 这里应该实现检查逻辑，如果所有用户都上传了，则调用参数聚合方法
+// SetGroupPolicy 设置组的聚合策略，只有组的所有者可以调用，policyJson是GroupPolicy的JSON
+func (s *SmartContract) SetGroupPolicy(ctx contractapi.TransactionContextInterface, groupname string, policyJson string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	if group.Users == nil {
+		return fmt.Errorf("group %s does not exist", groupname)
+	}
+	caller, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get the caller identity: %s", err.Error())
+	}
+	if group.Owner == "" || group.Owner != caller {
+		return fmt.Errorf("the caller is not the owner of group %s", groupname)
+	}
+
+	var policy GroupPolicy
+	err = json.Unmarshal([]byte(policyJson), &policy)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal group policy: %w", err)
+	}
+	err = policy.validate()
+	if err != nil {
+		return err
+	}
+	group.Policy = policy
+
+	data, err := json.Marshal(group)
+	if err != nil {
+		return fmt.Errorf("failed to marshal group: %s", err.Error())
+	}
+	err = ctx.GetStub().PutState(groupname, data)
+	if err != nil {
+		return fmt.Errorf("failed to update group state: %s", err.Error())
+	}
+	return nil
+}
+
+// GetGroupPolicy 获取组的聚合策略，未设置的字段使用默认值
+func (s *SmartContract) GetGroupPolicy(ctx contractapi.TransactionContextInterface, groupname string) (*GroupPolicy, error) {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return nil, err
+	}
+	if group.Users == nil {
+		return nil, fmt.Errorf("group %s does not exist", groupname)
+	}
+	policy := group.Policy
+	policy.setDefaults()
+	return &policy, nil
+}
+
+// FinalizeRound 达到法定人数后聚合该轮参数，finalize模式的组只能通过该调用聚合
+func (s *SmartContract) FinalizeRound(ctx contractapi.TransactionContextInterface, groupname string, roundID string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+
+	data, err := ctx.GetStub().GetState(groupname + "_AGGREPARAM_" + roundID)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		return fmt.Errorf("round %s of group %s is already aggregated", roundID, groupname)
+	}
+
+	ready, err := quorumReached(ctx, groupname, group, roundID)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return fmt.Errorf("round %s of group %s has not reached the quorum", roundID, groupname)
+	}
+	return s.aggregateParams(ctx, groupname, group.Users, roundID)
+}
+
+// CheckAllUploaded 检查上传参数的用户是否达到组策略的法定人数，如果达到且组是eager模式则调用聚合函数，具体实现就是维护一个全局的userid数组，遍历该数组在fabric上进行key查询
+func (s *SmartContract) checkAllUploaded(ctx contractapi.TransactionContextInterface, groupname string, group *Group, roundID string) error {
+	policy := group.Policy
+	policy.setDefaults()
+	if policy.Mode != PolicyModeEager {
+		return nil
+	}
 
-	//四舍五入
-	ratio := int(math.Round(0.8 * float64(len(usersId))))
-	for i := 0; i < len(usersId); i++ {
-		key := groupname + "_PARAM_" + usersId[i] + "_" + roundID
+	ready, err := quorumReached(ctx, groupname, group, roundID)
+	if err != nil || !ready {
+		return err
+	}
+
+	// 达到法定人数，调用参数聚合方法
+	return s.aggregateParams(ctx, groupname, group.Users, roundID)
+}
+
+// quorumReached 判断该轮上传参数的用户数是否达到组策略的法定人数
+func quorumReached(ctx contractapi.TransactionContextInterface, groupname string, group *Group, roundID string) (bool, error) {
+	uploaded := 0
+	for i := 0; i < len(group.Users); i++ {
+		key := groupname + "_PARAM_" + group.Users[i] + "_" + roundID
 		data, err := ctx.GetStub().GetState(key)
 		if err != nil {
-			return err
+			return false, err
 		}
 		if data != nil {
-			ratio--
+			uploaded++
 		}
 	}
-	if ratio > 0 {
-		return nil
-	}
 
-	// 假设大部分用户都已上传，调用参数聚合方法
-	s.aggregateParams(ctx, groupname, usersId, roundID)
+	policy := group.Policy
+	policy.setDefaults()
+	return uploaded >= policy.quorum(len(group.Users)), nil
+}
 
-	return nil
+// getGroup 读取组的状态信息，组不存在时返回空组
+func getGroup(ctx contractapi.TransactionContextInterface, groupname string) (*Group, error) {
+	data, err := ctx.GetStub().GetState(groupname)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the group: %s", err.Error())
+	}
+	var group Group
+	if data != nil {
+		err = json.Unmarshal(data, &group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal group: %s", err.Error())
+		}
+	}
+	return &group, nil
 }
 
 // 模型聚合
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Aggregation modes of a group policy
+const (
+	// PolicyModeEager aggregates as soon as the quorum uploaded
+	PolicyModeEager = "eager"
+	// PolicyModeFinalize waits for an explicit FinalizeRound call once the quorum uploaded
+	PolicyModeFinalize = "finalize"
+)
+
+// defaultMinFraction is the share of users that had to upload before groups had a policy
+const defaultMinFraction = 0.8
+
+// GroupPolicy decides when the params of a round can be aggregated.
+// The quorum is the larger of MinCount and MinFraction of the users, rounded to the nearest user
+type GroupPolicy struct {
+	MinCount    int     `json:"minCount"`
+	MinFraction float64 `json:"minFraction"`
+	Mode        string  `json:"mode"`
+}
+
+func (p *GroupPolicy) validate() error {
+	p.setDefaults()
+	if p.MinCount < 0 {
+		return fmt.Errorf("the minimum count must not be negative, got %d", p.MinCount)
+	}
+	if p.MinFraction < 0 || p.MinFraction > 1 {
+		return fmt.Errorf("the minimum fraction must be in [0, 1], got %v", p.MinFraction)
+	}
+	if p.Mode != PolicyModeEager && p.Mode != PolicyModeFinalize {
+		return fmt.Errorf("unknown aggregation mode %s", p.Mode)
+	}
+	return nil
+}
+
+// setDefaults fills an empty policy, groups created before policies existed keep the 80% eager quorum
+func (p *GroupPolicy) setDefaults() {
+	if p.MinCount == 0 && p.MinFraction == 0 {
+		p.MinFraction = defaultMinFraction
+	}
+	if p.Mode == "" {
+		p.Mode = PolicyModeEager
+	}
+}
+
+// quorum is the number of uploads needed to aggregate a round of a group with userCount users
+func (p *GroupPolicy) quorum(userCount int) int {
+	required := int(math.Round(p.MinFraction * float64(userCount)))
+	if p.MinCount > required {
+		required = p.MinCount
+	}
+	if required < 1 {
+		required = 1
+	}
+	return required
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// AccessDeniedError is returned when the caller may not read a key. Its message starts with "access denied:"
+// so clients can tell a refused read from a missing key
+type AccessDeniedError struct {
+	Key    string
+	Reason string
+}
+
+func (e *AccessDeniedError) Error() string {
+	return fmt.Sprintf("access denied: %s: %s", e.Key, e.Reason)
+}
+
+// checkRead fails with an AccessDeniedError unless the caller may read the params under the key.
+// User params "groupname_PARAM_userID_roundID" are readable by the user and the group owner,
+// aggregated params "groupname_AGGREPARAM_roundID" by the owner and the active members the owner added, other keys by no one
+func checkRead(ctx contractapi.TransactionContextInterface, key string) error {
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	if index := strings.LastIndex(key, "_AGGREPARAM_"); index > 0 {
+		return checkGroupRead(ctx, key[:index], key)
+	}
+
+	if index := strings.Index(key, "_PARAM_"); index > 0 {
+		groupname := key[:index]
+		rest := key[index+len("_PARAM_"):]
+		separator := strings.LastIndex(rest, "_")
+		if separator <= 0 {
+			return &AccessDeniedError{Key: key, Reason: "not the key of model params"}
+		}
+		userID := rest[:separator]
+		group, err := readableGroup(ctx, groupname, key)
+		if err != nil {
+			return err
+		}
+		if group.Owner == caller {
+			return nil
+		}
+		if member, exists := group.Members[userID]; exists && member.Identity == caller {
+			return nil
+		}
+		return &AccessDeniedError{Key: key, Reason: fmt.Sprintf("the caller from %s is neither user %s nor the owner of group %s", caller.MSPID, userID, groupname)}
+	}
+
+	return &AccessDeniedError{Key: key, Reason: "not the key of model params"}
+}
+
+// checkGroupRead fails with an AccessDeniedError unless the caller may read the group state under the key,
+// like the aggregated params it is readable by the owner and the active members the owner added
+func checkGroupRead(ctx contractapi.TransactionContextInterface, groupname string, key string) error {
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	group, err := readableGroup(ctx, groupname, key)
+	if err != nil {
+		return err
+	}
+	if group.Owner == caller {
+		return nil
+	}
+	for _, member := range group.Members {
+		// members that registered themselves never got the owner's consent
+		if member.Identity == caller && member.Status != MemberStatusSuspended && member.AddedBy.ID != "" {
+			return nil
+		}
+	}
+	return &AccessDeniedError{Key: key, Reason: fmt.Sprintf("the caller from %s is not an active member of group %s added by its owner", caller.MSPID, groupname)}
+}
+
+// readableGroup loads the group a key belongs to, keys of groups missing from the group list are denied
+func readableGroup(ctx contractapi.TransactionContextInterface, groupname string, key string) (*Group, error) {
+	groupNamesData, err := ctx.GetStub().GetState(GroupsNameListKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the group list: %s", err.Error())
+	}
+	var existGroups ExistGroups
+	if groupNamesData != nil {
+		err = json.Unmarshal(groupNamesData, &existGroups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the group list: %s", err.Error())
+		}
+	}
+	if !contains(existGroups.GroupsName, groupname) {
+		return nil, &AccessDeniedError{Key: key, Reason: fmt.Sprintf("group %s does not exist", groupname)}
+	}
+	return getGroup(ctx, groupname)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestGetParamAccess(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"mode": "finalize"}}`, "u1", "u2", "u3")
+	for _, user := range []string{"u1", "u2"} {
+		if err := upload(stub, "g", "0", user, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := new(SmartContract)
+	stub.caller = "owner"
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		err := s.FinalizeRound(ctx, "g", "0")
+		if err != nil {
+			return err
+		}
+		return s.SuspendUser(ctx, "g", "u3")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		mspID   string
+		caller  string
+		key     string
+		allowed bool
+	}{
+		{"user reads its params", "Org1MSP", "u1", "g_PARAM_u1_0", true},
+		{"owner reads user params", "Org1MSP", "owner", "g_PARAM_u1_0", true},
+		{"other user reads user params", "Org1MSP", "u2", "g_PARAM_u1_0", false},
+		{"same id from another MSP", "Org2MSP", "u1", "g_PARAM_u1_0", false},
+		{"member reads the aggregate", "Org1MSP", "u2", "g_AGGREPARAM_0", true},
+		{"owner reads the aggregate", "Org1MSP", "owner", "g_AGGREPARAM_0", true},
+		{"suspended member reads the aggregate", "Org1MSP", "u3", "g_AGGREPARAM_0", false},
+		{"outsider reads the aggregate", "Org1MSP", "mallory", "g_AGGREPARAM_0", false},
+		{"unknown group", "Org1MSP", "owner", "h_AGGREPARAM_0", false},
+		{"other keys", "Org1MSP", "owner", "g", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub.mspID, stub.caller = test.mspID, test.caller
+			err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+				_, err := s.GetParam(ctx, test.key)
+				return err
+			})
+			if test.allowed {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var denied *AccessDeniedError
+			if !errors.As(err, &denied) {
+				t.Fatalf("GetParam(%s) = %v, want an AccessDeniedError", test.key, err)
+			}
+		})
+	}
+}
+
+func TestSelfRegisteredMemberAccess(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{}`, "u1")
+	stub.put(t, "g_AGGREPARAM_0", ModelParam{Params: weightParams(1)})
+
+	// users that registered themselves before only the owner could add users have no AddedBy
+	var group Group
+	stub.get(t, "g", &group)
+	member := group.Members["u1"]
+	member.AddedBy = Identity{}
+	group.Members["u1"] = member
+	stub.put(t, "g", group)
+
+	stub.caller = "u1"
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := new(SmartContract).GetParam(ctx, "g_AGGREPARAM_0")
+		return err
+	})
+	var denied *AccessDeniedError
+	if !errors.As(err, &denied) {
+		t.Fatalf("GetParam() by a self-registered member = %v, want an AccessDeniedError", err)
+	}
+}
+
+func TestGroupReadAccess(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"mode": "finalize"}}`, "u1", "u2", "u3")
+	for _, user := range []string{"u1", "u2"} {
+		if err := upload(stub, "g", "0", user, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := new(SmartContract)
+	stub.caller = "owner"
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		err := s.FinalizeRound(ctx, "g", "0")
+		if err != nil {
+			return err
+		}
+		return s.SuspendUser(ctx, "g", "u3")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reads := map[string]func(ctx contractapi.TransactionContextInterface) error{
+		"GetAggregationReport": func(ctx contractapi.TransactionContextInterface) error {
+			_, err := s.GetAggregationReport(ctx, "g", "0")
+			return err
+		},
+		"GetRoundStatus": func(ctx contractapi.TransactionContextInterface) error {
+			_, err := s.GetRoundStatus(ctx, "g", "0")
+			return err
+		},
+		"GetGroupMembers": func(ctx contractapi.TransactionContextInterface) error {
+			_, err := s.GetGroupMembers(ctx, "g")
+			return err
+		},
+	}
+	callers := []struct {
+		caller  string
+		allowed bool
+	}{
+		{"owner", true},
+		{"u2", true},
+		{"u3", false},
+		{"mallory", false},
+	}
+	for name, read := range reads {
+		for _, test := range callers {
+			t.Run(name+" by "+test.caller, func(t *testing.T) {
+				stub.mspID, stub.caller = "Org1MSP", test.caller
+				err := stub.invoke(read)
+				if test.allowed {
+					if err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				var denied *AccessDeniedError
+				if !errors.As(err, &denied) {
+					t.Fatalf("%s() = %v, want an AccessDeniedError", name, err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Aggregation rules a group can be created with
+const (
+	// AggregationFedAvg averages the params weighted by the sample count of each user
+	AggregationFedAvg = "fedavg"
+	// AggregationMedian takes the coordinate-wise median of the params
+	AggregationMedian = "median"
+	// AggregationTrimmedMean drops the TrimRatio largest and smallest values of every coordinate and averages the rest
+	AggregationTrimmedMean = "trimmedmean"
+	// AggregationKrum keeps the single upload closest to its neighbours, assuming ByzantineCount attackers
+	AggregationKrum = "krum"
+	// AggregationMultiKrum averages the KrumSelect uploads with the best Krum scores
+	AggregationMultiKrum = "multikrum"
+)
+
+// AggregationConfig selects the rule used to combine the params uploaded in a round.
+// The robust rules (median, trimmed mean, krum) ignore the sample counts, so a user can not gain weight by lying about it
+type AggregationConfig struct {
+	Rule      string  `json:"rule"`
+	TrimRatio float64 `json:"trimRatio,omitempty" metadata:",optional"`
+	// ByzantineCount is the number of attackers the krum rules assume
+	ByzantineCount int `json:"byzantineCount,omitempty" metadata:",optional"`
+	// KrumSelect is the number of uploads multikrum averages, 0 means all but ByzantineCount
+	KrumSelect int `json:"krumSelect,omitempty" metadata:",optional"`
+}
+
+// AggregationReport records which uploads went into the aggregation of a round, so the result can be audited.
+// Rejected and Scores are only filled by the krum rules
+type AggregationReport struct {
+	RoundID  string             `json:"roundID"`
+	Rule     string             `json:"rule"`
+	Selected []string           `json:"selected"`
+	Rejected []string           `json:"rejected"`
+	Scores   map[string]float64 `json:"scores,omitempty" metadata:",optional"`
+	// Optimizer is the server optimizer applied on top of the rule
+	Optimizer string `json:"optimizer,omitempty" metadata:",optional"`
+}
+
+func (c *AggregationConfig) validate() error {
+	switch c.Rule {
+	case "":
+		c.Rule = AggregationFedAvg
+	case AggregationFedAvg, AggregationMedian:
+	case AggregationTrimmedMean:
+		if c.TrimRatio < 0 || c.TrimRatio >= 0.5 {
+			return fmt.Errorf("the trim ratio must be in [0, 0.5), got %v", c.TrimRatio)
+		}
+	case AggregationKrum, AggregationMultiKrum:
+		if c.ByzantineCount < 0 {
+			return fmt.Errorf("the byzantine count must not be negative, got %d", c.ByzantineCount)
+		}
+		if c.KrumSelect < 0 {
+			return fmt.Errorf("the krum select count must not be negative, got %d", c.KrumSelect)
+		}
+	default:
+		return fmt.Errorf("unknown aggregation rule %s", c.Rule)
+	}
+	return nil
+}
+
+// minUploads is the number of uploads the rule needs before it can aggregate
+func (c *AggregationConfig) minUploads() int {
+	switch c.Rule {
+	case AggregationKrum, AggregationMultiKrum:
+		// every score needs n-f-2 > 0 neighbours
+		return 2*c.ByzantineCount + 3
+	default:
+		return 1
+	}
+}
+
+// selectCount is the number of uploads the krum rules average out of n uploads
+func (c *AggregationConfig) selectCount(n int) int {
+	if c.Rule == AggregationKrum {
+		return 1
+	}
+	if c.KrumSelect > 0 {
+		return min(c.KrumSelect, n)
+	}
+	return n - c.ByzantineCount
+}
+
+// combineParams merges the params of the uploads coordinate by coordinate with reduce.
+// All uploads must have the same layers and shapes
+func combineParams(uploads []*ModelParam, reduce func([]float64) float64) (map[string]interface{}, error) {
+	paramsList := make([]map[string]interface{}, len(uploads))
+	owners := make([]string, len(uploads))
+	for i, upload := range uploads {
+		paramsList[i] = upload.Params
+		owners[i] = "the upload of user " + upload.UserID
+	}
+	return combineMaps(paramsList, owners, reduce)
+}
+
+// combineMaps merges params trees coordinate by coordinate with reduce, owners name the trees in errors
+func combineMaps(paramsList []map[string]interface{}, owners []string, reduce func([]float64) float64) (map[string]interface{}, error) {
+	// sort the layer names so every endorser reports the same error
+	keys := make([]string, 0, len(paramsList[0]))
+	for key := range paramsList[0] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		values := make([]interface{}, len(paramsList))
+		for i, params := range paramsList {
+			value, exists := params[key]
+			if !exists {
+				return nil, fmt.Errorf("param %s is missing in %s", key, owners[i])
+			}
+			values[i] = value
+		}
+		combined, err := combineRecursive(values, reduce)
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %v", key, err)
+		}
+		result[key] = combined
+	}
+	return result, nil
+}
+
+func combineRecursive(values []interface{}, reduce func([]float64) float64) (interface{}, error) {
+	switch first := values[0].(type) {
+	case float64:
+		numbers := make([]float64, len(values))
+		for i, value := range values {
+			number, ok := value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("mismatched value types")
+			}
+			numbers[i] = number
+		}
+		return reduce(numbers), nil
+	case []interface{}:
+		slices := make([][]interface{}, len(values))
+		for i, value := range values {
+			slice, ok := value.([]interface{})
+			if !ok || len(slice) != len(first) {
+				return nil, fmt.Errorf("mismatched shapes")
+			}
+			slices[i] = slice
+		}
+		result := make([]interface{}, len(first))
+		column := make([]interface{}, len(values))
+		for j := range first {
+			for i, slice := range slices {
+				column[i] = slice[j]
+			}
+			combined, err := combineRecursive(column, reduce)
+			if err != nil {
+				return nil, err
+			}
+			result[j] = combined
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", first)
+	}
+}
+
+// median returns the median of the values
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// trimmedMean returns a reducer that drops the ratio largest and smallest values and averages the rest
+func trimmedMean(ratio float64) func([]float64) float64 {
+	return func(values []float64) float64 {
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		trim := int(ratio * float64(len(sorted)))
+		return mean(sorted[trim : len(sorted)-trim])
+	}
+}
+
+// mean returns the average of the values
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// krumSelect scores every upload by the summed squared L2 distance to its n-f-2 closest uploads
+// and returns the m uploads with the lowest scores, in upload order, together with the scores by user
+func krumSelect(uploads []*ModelParam, f int, m int) ([]*ModelParam, map[string]float64, error) {
+	n := len(uploads)
+	neighbours := n - f - 2
+	if neighbours <= 0 {
+		return nil, nil, fmt.Errorf("krum needs more than %d uploads to tolerate %d byzantine users, got %d", 2*f+2, f, n)
+	}
+
+	vectors := make([][]float64, n)
+	for i, upload := range uploads {
+		vector, err := flattenParams(upload.Params)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to flatten the params of user %s: %v", upload.UserID, err)
+		}
+		if i > 0 && len(vector) != len(vectors[0]) {
+			return nil, nil, fmt.Errorf("the params of user %s have %d values, expected %d", upload.UserID, len(vector), len(vectors[0]))
+		}
+		vectors[i] = vector
+	}
+
+	distances := make([][]float64, n)
+	for i := range distances {
+		distances[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			d := squaredDistance(vectors[i], vectors[j])
+			distances[i][j] = d
+			distances[j][i] = d
+		}
+	}
+
+	scores := make([]float64, n)
+	scoresByUser := make(map[string]float64, n)
+	for i := 0; i < n; i++ {
+		others := make([]float64, 0, n-1)
+		for j := 0; j < n; j++ {
+			if j != i {
+				others = append(others, distances[i][j])
+			}
+		}
+		sort.Float64s(others)
+		for _, d := range others[:neighbours] {
+			scores[i] += d
+		}
+		scoresByUser[uploads[i].UserID] = scores[i]
+	}
+
+	// rank by score, ties keep the upload order so every endorser selects the same users
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] < scores[order[b]]
+	})
+	chosen := order[:m]
+	sort.Ints(chosen)
+
+	selected := make([]*ModelParam, 0, m)
+	for _, i := range chosen {
+		selected = append(selected, uploads[i])
+	}
+	return selected, scoresByUser, nil
+}
+
+// flattenParams lays the params out as a single vector, layers in name order
+func flattenParams(params map[string]interface{}) ([]float64, error) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var vector []float64
+	for _, key := range keys {
+		var err error
+		vector, err = flattenRecursive(vector, params[key])
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %v", key, err)
+		}
+	}
+	return vector, nil
+}
+
+func flattenRecursive(vector []float64, value interface{}) ([]float64, error) {
+	switch typedValue := value.(type) {
+	case float64:
+		return append(vector, typedValue), nil
+	case []interface{}:
+		var err error
+		for _, v := range typedValue {
+			vector, err = flattenRecursive(vector, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return vector, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+func squaredDistance(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
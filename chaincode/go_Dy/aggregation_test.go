@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{"single", []float64{3}, 3},
+		{"odd", []float64{5, 1, 3}, 3},
+		{"even", []float64{4, 1, 3, 2}, 2.5},
+		{"outlier", []float64{1, 2, 1000}, 2},
+		{"negative", []float64{-1, -5, -3}, -3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := append([]float64(nil), test.values...)
+			if got := median(values); got != test.want {
+				t.Fatalf("median(%v) = %v, want %v", test.values, got, test.want)
+			}
+			for i := range values {
+				if values[i] != test.values[i] {
+					t.Fatalf("median reordered its input to %v", values)
+				}
+			}
+		})
+	}
+}
+
+func TestTrimmedMean(t *testing.T) {
+	tests := []struct {
+		name   string
+		ratio  float64
+		values []float64
+		want   float64
+	}{
+		{"no trim is the mean", 0, []float64{1, 2, 3, 10}, 4},
+		{"trims one of each end", 0.2, []float64{100, 1, 2, 3, -100}, 2},
+		{"rounds the trim down", 0.2, []float64{1, 2, 3, 10}, 4},
+		{"trims two of each end", 0.4, []float64{-9, 9, 5, 5, 5, -9, 9}, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := trimmedMean(test.ratio)(test.values); math.Abs(got-test.want) > 1e-12 {
+				t.Fatalf("trimmedMean(%v)(%v) = %v, want %v", test.ratio, test.values, got, test.want)
+			}
+		})
+	}
+}
+
+// krumUpload is the param of a user whose layers are all set to value
+func krumUpload(userID string, value float64) *ModelParam {
+	return &ModelParam{
+		UserID: userID,
+		Params: map[string]interface{}{
+			"fc.weight": []interface{}{[]interface{}{value, value}},
+			"fc.bias":   []interface{}{value},
+		},
+	}
+}
+
+func TestKrumSelect(t *testing.T) {
+	honest := []*ModelParam{krumUpload("a", 1), krumUpload("b", 1.1), krumUpload("c", 0.9), krumUpload("d", 1.05)}
+	attacker := krumUpload("x", 50)
+
+	tests := []struct {
+		name    string
+		uploads []*ModelParam
+		f       int
+		m       int
+		want    []string
+		wantErr bool
+	}{
+		{"krum keeps the most central upload", append(honest, attacker), 1, 1, []string{"d"}, false},
+		{"multikrum drops the attacker", append(honest, attacker), 1, 4, []string{"a", "b", "c", "d"}, false},
+		{"selection keeps the upload order", []*ModelParam{attacker, honest[0], honest[1], honest[2], honest[3]}, 1, 3, []string{"a", "b", "d"}, false},
+		{"ties keep the upload order", []*ModelParam{krumUpload("p", 1), krumUpload("q", 1), krumUpload("r", 1)}, 0, 1, []string{"p"}, false},
+		{"too few uploads", honest[:3], 1, 1, nil, true},
+		{"different layers", []*ModelParam{honest[0], honest[1], honest[2], {UserID: "y", Params: map[string]interface{}{"fc.bias": []interface{}{1.0}}}}, 0, 1, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, scores, err := krumSelect(test.uploads, test.f, test.m)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("krumSelect() = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(scores) != len(test.uploads) {
+				t.Fatalf("got %d scores for %d uploads", len(scores), len(test.uploads))
+			}
+			var got []string
+			for _, upload := range selected {
+				got = append(got, upload.UserID)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("krumSelect() selected %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("krumSelect() selected %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
@@ -5,7 +5,8 @@ import (
 	"fmt"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 	"log"
-	"math"
+
+	"Capstone_go/secagg"
 )
 
 const GroupsNameListKey = "AllGroups"
@@ -17,107 +18,207 @@ type SmartContract struct {
 
 // ModelParam represents a model parameter which can be uploaded by a user
 type ModelParam struct {
-	Params  map[string]interface{} `json:"params"`
-	UserID  string                 `json:"userID"`
-	RoundID string                 `json:"roundID"`
+	Params map[string]interface{} `json:"params,omitempty" metadata:",optional"`
+	// Tensors is the base64 encoded tensor container of uploads in the binary format, Params is then empty
+	Tensors string `json:"tensors,omitempty" metadata:",optional"`
+	// Upload describes params uploaded in chunks, Params is then empty
+	Upload *ChunkedUpload `json:"upload,omitempty" metadata:",optional"`
+	// Ref points to the params in groups that keep them off chain, Params is then empty
+	Ref *ParamRef `json:"ref,omitempty" metadata:",optional"`
+	// Private points to the params in groups that keep them in a private data collection, Params is then empty
+	Private *PrivateRef `json:"private,omitempty" metadata:",optional"`
+	// Masked holds the masked params of groups with secure aggregation, Params is then empty
+	Masked      *secagg.MaskedVector `json:"masked,omitempty" metadata:",optional"`
+	UserID      string               `json:"userID"`
+	RoundID     string               `json:"roundID"`
+	NumSamples  int                  `json:"numSamples"`
+	LocalEpochs int                  `json:"localEpochs,omitempty" metadata:",optional"`
+	// Aggregation is the rule that produced an aggregated param, it is empty for user uploads
+	Aggregation *AggregationConfig `json:"aggregation,omitempty" metadata:",optional"`
 }
 
 // Group represents a group of users
 type Group struct {
-	Users []string `json:"users"`
+	Users  []string    `json:"users"`
+	Config GroupConfig `json:"config"`
+	// Members binds every user to its identity
+	Members map[string]Member `json:"members"`
+	// Owner is the identity that created the group, it administers the members
+	Owner Identity `json:"owner"`
+	// CurrentRound is the round that accepts uploads
+	CurrentRound string `json:"currentRound"`
+}
+
+// GroupConfig holds the settings of a group, they are chosen when the group is created
+type GroupConfig struct {
+	Aggregation AggregationConfig `json:"aggregation"`
+	Optimizer   OptimizerConfig   `json:"optimizer"`
+	Policy      GroupPolicy       `json:"policy"`
+	// Storage is StorageOnChain, StorageOffChain or StoragePrivate
+	Storage string `json:"storage,omitempty" metadata:",optional"`
+	// Collection is the private data collection of groups with StoragePrivate, groups with secure aggregation
+	// keep the revealed shares in it
+	Collection string       `json:"collection,omitempty" metadata:",optional"`
+	SecAgg     SecAggConfig `json:"secureAggregation" metadata:",optional"`
+}
+
+// validate checks the config and fills in the defaults
+func (c *GroupConfig) validate() error {
+	err := c.Aggregation.validate()
+	if err != nil {
+		return err
+	}
+	err = c.Optimizer.validate()
+	if err != nil {
+		return err
+	}
+	err = c.Policy.validate()
+	if err != nil {
+		return err
+	}
+	err = c.validateStorage()
+	if err != nil {
+		return err
+	}
+	return c.validateSecAgg()
 }
 
 type ExistGroups struct {
 	GroupsName []string `json:"groupsName"`
 }
 
-// RegisterUser adds a new user to a group
-func (s *SmartContract) RegisterUser(ctx contractapi.TransactionContextInterface, groupname string, userID string) error {
+// CreateGroup creates an empty group with the given config, configJson is a JSON encoded GroupConfig.
+// The caller owns the group and is the only one who can add users to it
+func (s *SmartContract) CreateGroup(ctx contractapi.TransactionContextInterface, groupname string, configJson string) error {
 	data, err := ctx.GetStub().GetState(groupname)
 	if err != nil {
 		return fmt.Errorf("failed to get the group: %s", err.Error())
 	}
-
-	var group Group
 	if data != nil {
-		err = json.Unmarshal(data, &group)
-		if err != nil {
-			return fmt.Errorf("failed to unmarshal group: %s", err.Error())
-		}
-	} else {
-		//get groupsName list
-		groupNamesData, err := ctx.GetStub().GetState(GroupsNameListKey)
-		if err != nil {
-			return fmt.Errorf("failed to get the group: %s", err.Error())
-		}
+		return codedError(CodeAlreadyRegistered, "group %s already exists", groupname)
+	}
 
-		var existGroups ExistGroups
-		//if groupsName list exist,bind json
-		if groupNamesData != nil {
-			err = json.Unmarshal(groupNamesData, &existGroups)
-			if err != nil {
-				return fmt.Errorf("failed to unmarshal group: %s", err.Error())
-			}
-		}
-		//if groupName list not exist,new a struct ,append groupName
-		existGroups.GroupsName = append(existGroups.GroupsName, groupname)
+	var config GroupConfig
+	err = json.Unmarshal([]byte(configJson), &config)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal group config: %s", err.Error())
+	}
+	err = config.validate()
+	if err != nil {
+		return err
+	}
 
-		//Marshal struct and put state to fabric
-		groupNamesData, err = json.Marshal(existGroups)
-		if err != nil {
-			return fmt.Errorf("failed to marshal group: %s", err.Error())
-		}
+	err = addGroupName(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	owner, err := callerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	group := &Group{Users: []string{}, Config: config, Owner: owner}
+	err = openRound(ctx, groupname, group, "0", 0)
+	if err != nil {
+		return err
+	}
+	return putGroup(ctx, groupname, group)
+}
 
-		err = ctx.GetStub().PutState(GroupsNameListKey, groupNamesData)
-		if err != nil {
-			return fmt.Errorf("failed to update group state: %s", err.Error())
-		}
+// RegisterUser lets the group owner add a user bound to the owner's own identity, for users the owner uploads for.
+// Users with an identity of their own are added with AddUser, a group has to be created with CreateGroup first
+func (s *SmartContract) RegisterUser(ctx contractapi.TransactionContextInterface, groupname string, userID string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkAdmin(ctx, group, groupname)
+	if err != nil {
+		return err
+	}
+	if _, exists := group.Members[userID]; exists {
+		return codedError(CodeAlreadyRegistered, "user %s is already registered in group %s", userID, groupname)
 	}
 
-	for _, user := range group.Users {
-		if user == userID {
-			return fmt.Errorf("user %s is already registered in group %s", userID, groupname)
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	group.addMember(userID, caller, caller)
+	return putGroup(ctx, groupname, group)
+}
+
+// addGroupName appends a new group name to the groups name list
+func addGroupName(ctx contractapi.TransactionContextInterface, groupname string) error {
+	//get groupsName list
+	groupNamesData, err := ctx.GetStub().GetState(GroupsNameListKey)
+	if err != nil {
+		return fmt.Errorf("failed to get the group: %s", err.Error())
+	}
+
+	var existGroups ExistGroups
+	//if groupsName list exist,bind json
+	if groupNamesData != nil {
+		err = json.Unmarshal(groupNamesData, &existGroups)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal group: %s", err.Error())
 		}
 	}
+	//if groupName list not exist,new a struct ,append groupName
+	existGroups.GroupsName = append(existGroups.GroupsName, groupname)
 
-	group.Users = append(group.Users, userID)
-	data, err = json.Marshal(group)
+	//Marshal struct and put state to fabric
+	groupNamesData, err = json.Marshal(existGroups)
 	if err != nil {
 		return fmt.Errorf("failed to marshal group: %s", err.Error())
 	}
-	err = ctx.GetStub().PutState(groupname, data)
+
+	err = ctx.GetStub().PutState(GroupsNameListKey, groupNamesData)
 	if err != nil {
 		return fmt.Errorf("failed to update group state: %s", err.Error())
 	}
 	return nil
 }
 
-// UploadModelParam allows a user to upload their model parameters
-// paramKey = "groupname_PARAM_userID_roundID"
-func (s *SmartContract) UploadModelParam(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, paramJson string) error {
+// getGroup reads a group, it fails if the group does not exist
+func getGroup(ctx contractapi.TransactionContextInterface, groupname string) (*Group, error) {
 	groupData, err := ctx.GetStub().GetState(groupname)
 	if err != nil {
-		return fmt.Errorf("failed to get the group: %s", err.Error())
+		return nil, fmt.Errorf("failed to get the group: %s", err.Error())
 	}
 	if groupData == nil {
-		return fmt.Errorf("group %s does not exist", groupname)
+		return nil, codedError(CodeNotFound, "group %s does not exist", groupname)
 	}
 
 	var group Group
 	err = json.Unmarshal(groupData, &group)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal group: %s", err.Error())
+		return nil, fmt.Errorf("failed to unmarshal group: %s", err.Error())
 	}
+	return &group, nil
+}
 
-	found := false
-	for _, user := range group.Users {
-		if user == userID {
-			found = true
-			break
-		}
+func putGroup(ctx contractapi.TransactionContextInterface, groupname string, group *Group) error {
+	data, err := json.Marshal(group)
+	if err != nil {
+		return fmt.Errorf("failed to marshal group: %s", err.Error())
 	}
-	if !found {
-		return fmt.Errorf("user %s is not registered in group %s", userID, groupname)
+	err = ctx.GetStub().PutState(groupname, data)
+	if err != nil {
+		return fmt.Errorf("failed to update group state: %s", err.Error())
+	}
+	return nil
+}
+
+// UploadModelParam allows a user to upload their model parameters
+// paramKey = "groupname_PARAM_userID_roundID"
+// numSamples is the number of training samples behind the upload and is used as its aggregation weight
+func (s *SmartContract) UploadModelParam(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, paramJson string, numSamples int, localEpochs int) error {
+	group, round, err := prepareUpload(ctx, groupname, roundID, userID, numSamples, localEpochs)
+	if err != nil {
+		return err
+	}
+	if group.Config.offChain() {
+		return fmt.Errorf("group %s keeps its params off chain, upload a reference with UploadParamRef", groupname)
 	}
 
 	var params map[string]interface{}
@@ -127,9 +228,62 @@ func (s *SmartContract) UploadModelParam(ctx contractapi.TransactionContextInter
 	}
 
 	param := ModelParam{
-		Params:  params,
-		UserID:  userID,
-		RoundID: roundID,
+		Params:      params,
+		UserID:      userID,
+		RoundID:     roundID,
+		NumSamples:  numSamples,
+		LocalEpochs: localEpochs,
+	}
+	err = checkUpload(ctx, groupname, &param)
+	if err != nil {
+		return err
+	}
+	return s.storeUpload(ctx, groupname, group, round, &param, &param)
+}
+
+// prepareUpload checks the upload arguments, the caller and the round, it returns the group and the open round
+func prepareUpload(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, numSamples int, localEpochs int) (*Group, *RoundStatus, error) {
+	if numSamples <= 0 {
+		return nil, nil, fmt.Errorf("the sample count must be positive, got %d", numSamples)
+	}
+	if localEpochs < 0 {
+		return nil, nil, fmt.Errorf("the local epochs must not be negative, got %d", localEpochs)
+	}
+
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = checkMember(ctx, group, groupname, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	// uploads to a group too small for its aggregation rule would never be aggregated
+	err = group.checkSize(groupname)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	round, err := getRoundStatus(ctx, groupname, roundID)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = checkRoundOpen(round, groupname, roundID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return group, round, nil
+}
+
+// storeUpload writes the param of a user and ends the round if it expired or reached its quorum.
+// content is the param with its values, it differs from param when the values are kept in private data or chunks
+func (s *SmartContract) storeUpload(ctx contractapi.TransactionContextInterface, groupname string, group *Group, round *RoundStatus, param *ModelParam, content *ModelParam) error {
+	if group.Config.SecAgg.Enabled && param.Masked == nil {
+		return fmt.Errorf("group %s uses secure aggregation, the params must be uploaded masked", groupname)
+	}
+	if group.Config.privateData() && param.Private == nil {
+		return fmt.Errorf("group %s keeps its params in the private data collection %s, upload them with UploadPrivateParam", groupname, group.Config.Collection)
 	}
 	paramJSON, err := json.Marshal(param)
 	if err != nil {
@@ -137,21 +291,53 @@ func (s *SmartContract) UploadModelParam(ctx contractapi.TransactionContextInter
 	}
 
 	// Creating a unique key for the user's parameters
-	paramKey := fmt.Sprintf("%s_PARAM_%s_%s", groupname, userID, roundID)
+	paramKey := fmt.Sprintf("%s_PARAM_%s_%s", groupname, param.UserID, param.RoundID)
 	err = ctx.GetStub().PutState(paramKey, paramJSON)
 	if err != nil {
 		return err
 	}
+	if !contains(round.Uploaded, param.UserID) {
+		round.Uploaded = append(round.Uploaded, param.UserID)
+		err = putRoundStatus(ctx, groupname, round)
+		if err != nil {
+			return err
+		}
+	}
+	err = emitEvent(ctx, RoundEvent{
+		Event:     EventParamUploaded,
+		GroupName: groupname,
+		RoundID:   param.RoundID,
+		UserID:    param.UserID,
+		Uploaded:  len(round.Uploaded),
+	})
+	if err != nil {
+		return err
+	}
+	// the first upload after the deadline ends the round with the uploads that arrived
+	expired, err := roundExpired(ctx, round)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return s.expireRound(ctx, groupname, group, round, content)
+	}
 	// check if most users upload the params
-	return s.checkAllUploaded(ctx, groupname, group.Users, roundID)
+	return s.checkAllUploaded(ctx, groupname, group, round, content)
 }
+
+// GetParam returns the params under the key, user params are only readable by the user and the group owner
+// and aggregated params by the group members
 func (s *SmartContract) GetParam(ctx contractapi.TransactionContextInterface, key string) (*ModelParam, error) {
+	err := checkRead(ctx, key)
+	if err != nil {
+		return nil, err
+	}
 	paramJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
 		return nil, err
 	}
 	if paramJSON == nil {
-		return nil, fmt.Errorf("the Model Params %s does not exist", key)
+		return nil, codedError(CodeNotFound, "the Model Params %s does not exist", key)
 	}
 
 	var Modelparam ModelParam
@@ -165,12 +351,16 @@ func (s *SmartContract) GetParam(ctx contractapi.TransactionContextInterface, ke
 // Get the aggregated model, the key is "groupname_AGGREPARAM_" + roundID
 func (s *SmartContract) GetAggregatedParams(ctx contractapi.TransactionContextInterface, groupname string, roundID string) (*ModelParam, error) {
 	key := groupname + "_AGGREPARAM_" + roundID
+	err := checkRead(ctx, key)
+	if err != nil {
+		return nil, err
+	}
 	paramJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
 		return nil, err
 	}
 	if paramJSON == nil {
-		return nil, fmt.Errorf("the Model Params %s does not exist", key)
+		return nil, codedError(CodeNotFound, "the Model Params %s does not exist", key)
 	}
 
 	var Modelparam ModelParam
@@ -181,6 +371,29 @@ func (s *SmartContract) GetAggregatedParams(ctx contractapi.TransactionContextIn
 	return &Modelparam, nil
 }
 
+// Get the report of the aggregation of a round, the key is "groupname_AGGREREPORT_" + roundID. It is readable like the aggregated params
+func (s *SmartContract) GetAggregationReport(ctx contractapi.TransactionContextInterface, groupname string, roundID string) (*AggregationReport, error) {
+	key := groupname + "_AGGREREPORT_" + roundID
+	err := checkGroupRead(ctx, groupname, key)
+	if err != nil {
+		return nil, err
+	}
+	reportJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if reportJSON == nil {
+		return nil, codedError(CodeNotFound, "the aggregation report %s does not exist", key)
+	}
+
+	var report AggregationReport
+	err = json.Unmarshal(reportJSON, &report)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
 // Get groups name list
 func (s *SmartContract) GetGroupsNameList(ctx contractapi.TransactionContextInterface) (*ExistGroups, error) {
 	paramJSON, err := ctx.GetStub().GetState(GroupsNameListKey)
@@ -188,7 +401,7 @@ func (s *SmartContract) GetGroupsNameList(ctx contractapi.TransactionContextInte
 		return nil, err
 	}
 	if paramJSON == nil {
-		return nil, fmt.Errorf("the Model Params %s does not exist", GroupsNameListKey)
+		return nil, codedError(CodeNotFound, "the Model Params %s does not exist", GroupsNameListKey)
 	}
 
 	var groupsNameList ExistGroups
@@ -199,78 +412,245 @@ func (s *SmartContract) GetGroupsNameList(ctx contractapi.TransactionContextInte
 	return &groupsNameList, nil
 }
 
-// CheckAllUploaded checks whether all users have uploaded parameters. If all have been uploaded, the aggregation function is called. The specific implementation is to maintain a global userid array, traverse the array and perform key queries on the fabric. If one is not found, it means that the upload is not complete.
-func (s *SmartContract) checkAllUploaded(ctx contractapi.TransactionContextInterface, groupname string, usersId []string, roundID string) error {
-	// Checking logic should be implemented here. If all users have uploaded, the parameter aggregation method is called.
+// CheckAllUploaded checks whether enough users have uploaded parameters. If the quorum of the group policy uploaded and the group aggregates eagerly, the round is aggregated and closed.
+// pending is the upload of the transaction, the ledger does not show it before the commit
+func (s *SmartContract) checkAllUploaded(ctx contractapi.TransactionContextInterface, groupname string, group *Group, round *RoundStatus, pending *ModelParam) error {
+	policy := group.Config.Policy
+	policy.setDefaults()
+	if policy.Mode != PolicyModeEager || !quorumReached(group, round) {
+		return nil
+	}
+	if group.Config.SecAgg.Enabled {
+		ready, err := secAggReady(ctx, groupname, group, round)
+		if err != nil || !ready {
+			return err
+		}
+	}
 
-	//rounding
-	ratio := int(math.Round(0.8 * float64(len(usersId))))
-	for i := 0; i < len(usersId); i++ {
-		key := groupname + "_PARAM_" + usersId[i] + "_" + roundID
-		data, err := ctx.GetStub().GetState(key)
+	// the quorum uploaded, aggregate the params and move on to the next round
+	return s.closeRound(ctx, groupname, group, round, pending)
+}
+
+// FinalizeRound aggregates and closes an open round once the quorum of the group policy uploaded,
+// groups with the finalize mode only aggregate through this call. Only the group owner finalizes rounds
+func (s *SmartContract) FinalizeRound(ctx contractapi.TransactionContextInterface, groupname string, roundID string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkAdmin(ctx, group, groupname)
+	if err != nil {
+		return err
+	}
+
+	round, err := getRoundStatus(ctx, groupname, roundID)
+	if err != nil {
+		return err
+	}
+	err = checkRoundOpen(round, groupname, roundID)
+	if err != nil {
+		return err
+	}
+	if !quorumReached(group, round) {
+		return fmt.Errorf("round %s of group %s has not reached the quorum", roundID, groupname)
+	}
+	if group.Config.SecAgg.Enabled {
+		ready, err := secAggReady(ctx, groupname, group, round)
 		if err != nil {
 			return err
 		}
-		if data != nil {
-			ratio--
+		if !ready {
+			return fmt.Errorf("round %s of group %s has fewer masked uploads than the secure aggregation threshold", roundID, groupname)
 		}
 	}
-	if ratio > 0 {
-		return nil
-	}
+	return s.closeRound(ctx, groupname, group, round, nil)
+}
 
-	// Assuming that most users(80%) have uploaded, call the parameter aggregation method
-	s.aggregateParams(ctx, groupname, usersId, roundID)
+// GetGroupPolicy returns the quorum policy of a group, defaults filled in
+func (s *SmartContract) GetGroupPolicy(ctx contractapi.TransactionContextInterface, groupname string) (*GroupPolicy, error) {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return nil, err
+	}
+	policy := group.Config.Policy
+	policy.setDefaults()
+	return &policy, nil
+}
 
-	return nil
+// quorumReached tells whether enough active users uploaded params for the round, by the group policy and the aggregation rule
+func quorumReached(group *Group, round *RoundStatus) bool {
+	uploaded := group.countActive(round.Uploaded)
+	policy := group.Config.Policy
+	policy.setDefaults()
+	if uploaded < policy.quorum(len(group.activeUsers())) {
+		return false
+	}
+	// the distance based rules need enough uploads to tell the outliers apart
+	return uploaded >= group.Config.Aggregation.minUploads()
 }
 
-func (s *SmartContract) aggregateParams(ctx contractapi.TransactionContextInterface, groupname string, usersId []string, roundID string) error {
-	userCount := 0
-	aggreParams := make(map[string]interface{})
-	var initialized bool
+// aggregateParams combines the params uploaded for the round with the aggregation rule of the group,
+// pending is an upload of the same transaction that is aggregated in place of its stored version
+func (s *SmartContract) aggregateParams(ctx contractapi.TransactionContextInterface, groupname string, group *Group, roundID string, pending *ModelParam) error {
+	uploads, err := loadRoundParams(ctx, groupname, group.activeUsers(), roundID, pending)
+	if err != nil {
+		return err
+	}
+	if len(uploads) == 0 {
+		return fmt.Errorf("no user params found for aggregation")
+	}
 
+	rule := group.Config.Aggregation
+	if rule.Rule == "" {
+		rule.Rule = AggregationFedAvg
+	}
+	// weighted FedAvg averages tensor containers natively, every other path works on JSON trees
+	optimizer := group.Config.Optimizer.Name
+	native := rule.Rule == AggregationFedAvg && (optimizer == "" || optimizer == OptimizerNone) && allTensors(uploads)
+	if !native {
+		for _, upload := range uploads {
+			err = upload.expandTensors()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	report := AggregationReport{
+		RoundID:  roundID,
+		Rule:     rule.Rule,
+		Selected: []string{},
+		Rejected: []string{},
+	}
+	var aggreParams map[string]interface{}
+	var aggreTensors string
+	switch rule.Rule {
+	case AggregationMedian:
+		aggreParams, err = combineParams(uploads, median)
+	case AggregationTrimmedMean:
+		aggreParams, err = combineParams(uploads, trimmedMean(rule.TrimRatio))
+	case AggregationKrum, AggregationMultiKrum:
+		var selected []*ModelParam
+		selected, report.Scores, err = krumSelect(uploads, rule.ByzantineCount, rule.selectCount(len(uploads)))
+		if err == nil {
+			aggreParams, err = combineParams(selected, mean)
+			uploads = selected
+		}
+	default:
+		if native {
+			aggreTensors, err = weightedMeanTensors(uploads)
+		} else {
+			aggreParams = weightedMean(uploads)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to aggregate params with rule %s: %v", rule.Rule, err)
+	}
+
+	// uploads now only holds the params that made it into the aggregation
+	totalSamples := 0
+	for _, upload := range uploads {
+		totalSamples += sampleWeight(upload)
+	}
+	for _, userID := range group.Users {
+		for _, upload := range uploads {
+			if upload.UserID == userID {
+				report.Selected = append(report.Selected, userID)
+				break
+			}
+		}
+	}
+	for _, userID := range group.Users {
+		if _, scored := report.Scores[userID]; scored && !contains(report.Selected, userID) {
+			report.Rejected = append(report.Rejected, userID)
+		}
+	}
+	aggreParams, err = applyServerOptimizer(ctx, groupname, group.Config.Optimizer, roundID, aggreParams)
+	if err != nil {
+		return fmt.Errorf("failed to apply the server optimizer: %v", err)
+	}
+	report.Optimizer = group.Config.Optimizer.Name
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(groupname+"_AGGREREPORT_"+roundID, reportJSON)
+	if err != nil {
+		return err
+	}
+
+	param := ModelParam{
+		Params:      aggreParams,
+		Tensors:     aggreTensors,
+		UserID:      "ALL",
+		RoundID:     roundID,
+		NumSamples:  totalSamples,
+		Aggregation: &rule,
+	}
+	paramJSON, err := json.Marshal(param)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(groupname+"_AGGREPARAM_"+roundID, paramJSON)
+}
+
+// loadRoundParams reads the params the users uploaded for the round, users without an upload are skipped.
+// GetState does not see the writes of the running transaction, so an upload it just stored is passed as pending
+func loadRoundParams(ctx contractapi.TransactionContextInterface, groupname string, usersId []string, roundID string, pending *ModelParam) ([]*ModelParam, error) {
+	var uploads []*ModelParam
 	for _, v := range usersId {
+		if pending != nil && pending.UserID == v {
+			uploads = append(uploads, pending)
+			continue
+		}
 		key := groupname + "_PARAM_" + v + "_" + roundID
 		data, err := ctx.GetStub().GetState(key)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if data == nil {
 			continue
 		}
 
-		userCount++
 		var params ModelParam
 		err = json.Unmarshal(data, &params)
 		if err != nil {
-			return fmt.Errorf("failed to unmarshal JSON data for key %s: %v", key, err)
+			return nil, fmt.Errorf("failed to unmarshal JSON data for key %s: %v", key, err)
 		}
-
-		if !initialized {
-			aggreParams = params.Params
-			initialized = true
-		} else {
-			addValues(aggreParams, params.Params)
+		err = params.loadPrivate(ctx, key)
+		if err != nil {
+			return nil, err
 		}
+		err = params.reassemble(ctx, groupname)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, &params)
 	}
+	return uploads, nil
+}
 
-	if initialized {
-		divideValues(aggreParams, userCount)
-	} else {
-		return fmt.Errorf("no user params found for aggregation")
+// sampleWeight returns the aggregation weight of an upload, params uploaded without a sample count count as a single sample
+func sampleWeight(upload *ModelParam) int {
+	if upload.NumSamples <= 0 {
+		return 1
 	}
+	return upload.NumSamples
+}
 
-	param := ModelParam{
-		Params:  aggreParams,
-		UserID:  "ALL",
-		RoundID: roundID,
-	}
-	paramJSON, err := json.Marshal(param)
-	if err != nil {
-		return err
-	}
-	return ctx.GetStub().PutState(groupname+"_AGGREPARAM_"+roundID, paramJSON)
+// weightedMean computes the FedAvg of the uploads, each user weighted by its sample count.
+// The params of the uploads are modified in place
+func weightedMean(uploads []*ModelParam) map[string]interface{} {
+	totalSamples := sampleWeight(uploads[0])
+	aggreParams := uploads[0].Params
+	scaleValues(aggreParams, float64(totalSamples))
+	for _, upload := range uploads[1:] {
+		totalSamples += sampleWeight(upload)
+		scaleValues(upload.Params, float64(sampleWeight(upload)))
+		addValues(aggreParams, upload.Params)
+	}
+	scaleValues(aggreParams, 1/float64(totalSamples))
+	return aggreParams
 }
 
 func addValues(total, params map[string]interface{}) {
@@ -319,25 +699,29 @@ func addDynamic(a, b interface{}) interface{} {
 	}
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
 	}
-	return b
+	return false
 }
-func divideValues(params map[string]interface{}, num int) {
+
+// scaleValues multiplies every value of the params by factor in place
+func scaleValues(params map[string]interface{}, factor float64) {
 	for key, value := range params {
-		params[key] = divideRecursive(value, num)
+		params[key] = scaleRecursive(value, factor)
 	}
 }
 
-func divideRecursive(value interface{}, num int) interface{} {
+func scaleRecursive(value interface{}, factor float64) interface{} {
 	switch typedValue := value.(type) {
 	case float64:
-		return typedValue / float64(num)
+		return typedValue * factor
 	case []interface{}:
 		for i, v := range typedValue {
-			typedValue[i] = divideRecursive(v, num)
+			typedValue[i] = scaleRecursive(v, factor)
 		}
 		return typedValue
 	default:
@@ -347,7 +731,9 @@ func divideRecursive(value interface{}, num int) interface{} {
 }
 
 func main() {
-	chaincode, err := contractapi.NewChaincode(&SmartContract{})
+	smartContract := new(SmartContract)
+	smartContract.TransactionContextHandler = new(EventContext)
+	chaincode, err := contractapi.NewChaincode(smartContract)
 	if err != nil {
 		log.Panicf("Error creating model-params chaincode: %v", err)
 	}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Formats of chunked uploads
+const (
+	// ChunkFormatJSON is the JSON encoded params
+	ChunkFormatJSON = "json"
+	// ChunkFormatTensor is a binary tensor container
+	ChunkFormatTensor = "tensor"
+)
+
+// maxChunkSize bounds the decoded size of a single chunk
+const maxChunkSize = 4 << 20
+
+// UploadSession tracks a chunked upload between BeginUpload and CommitUpload, it is kept at "groupname_UPLOADSESSION_userID_roundID".
+// ChunkDigests holds the SHA-256 of every acknowledged chunk so a client that crashed can check them and resume at the next index
+type UploadSession struct {
+	UploadID     string   `json:"uploadID"`
+	RoundID      string   `json:"roundID"`
+	UserID       string   `json:"userID"`
+	Format       string   `json:"format"`
+	NumSamples   int      `json:"numSamples"`
+	LocalEpochs  int      `json:"localEpochs"`
+	ChunkDigests []string `json:"chunkDigests"`
+	Size         int64    `json:"size"`
+}
+
+// ChunkedUpload describes params that stay in the chunks they were uploaded in, chunk i is kept at "groupname_CHUNK_uploadID_i"
+type ChunkedUpload struct {
+	UploadID string `json:"uploadID"`
+	Format   string `json:"format"`
+	Chunks   int    `json:"chunks"`
+	Size     int64  `json:"size"`
+	// Digest is the hex encoded SHA-256 of the reassembled params
+	Digest string `json:"digest"`
+}
+
+// BeginUpload starts a chunked upload of the params of a user, an unfinished upload of the user for the round is discarded
+func (s *SmartContract) BeginUpload(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, format string, numSamples int, localEpochs int) error {
+	if format != ChunkFormatJSON && format != ChunkFormatTensor {
+		return fmt.Errorf("unknown upload format %s", format)
+	}
+	group, _, err := prepareUpload(ctx, groupname, roundID, userID, numSamples, localEpochs)
+	if err != nil {
+		return err
+	}
+	if group.Config.offChain() {
+		return fmt.Errorf("group %s keeps its params off chain, upload a reference with UploadParamRef", groupname)
+	}
+	if group.Config.SecAgg.Enabled {
+		return fmt.Errorf("group %s uses secure aggregation, the params must be uploaded masked", groupname)
+	}
+	if group.Config.privateData() {
+		return fmt.Errorf("group %s keeps its params in the private data collection %s, upload them with UploadPrivateParam", groupname, group.Config.Collection)
+	}
+
+	previous, err := getUploadSession(ctx, groupname, userID, roundID)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		err = deleteChunks(ctx, groupname, previous.UploadID, len(previous.ChunkDigests))
+		if err != nil {
+			return err
+		}
+	}
+
+	session := UploadSession{
+		UploadID:     ctx.GetStub().GetTxID(),
+		RoundID:      roundID,
+		UserID:       userID,
+		Format:       format,
+		NumSamples:   numSamples,
+		LocalEpochs:  localEpochs,
+		ChunkDigests: []string{},
+	}
+	return putUploadSession(ctx, groupname, &session)
+}
+
+// UploadChunk stores the chunk with the given index of the upload, chunkBase64 is the base64 encoded chunk.
+// Chunks have to arrive in order, resending an acknowledged chunk with the same content is accepted
+func (s *SmartContract) UploadChunk(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, index int, chunkBase64 string) error {
+	chunk, err := base64.StdEncoding.DecodeString(chunkBase64)
+	if err != nil {
+		return fmt.Errorf("failed to decode chunk %d: %s", index, err.Error())
+	}
+	if len(chunk) == 0 || len(chunk) > maxChunkSize {
+		return fmt.Errorf("chunk %d has %d bytes, chunks must have 1 to %d bytes", index, len(chunk), maxChunkSize)
+	}
+
+	session, err := prepareChunkedUpload(ctx, groupname, roundID, userID)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(chunk)
+	chunkDigest := hex.EncodeToString(digest[:])
+	acknowledged := len(session.ChunkDigests)
+	if index < acknowledged {
+		if session.ChunkDigests[index] != chunkDigest {
+			return fmt.Errorf("chunk %d differs from the acknowledged one, begin the upload again", index)
+		}
+		return nil
+	}
+	if index != acknowledged {
+		return fmt.Errorf("expected chunk %d, got chunk %d", acknowledged, index)
+	}
+
+	err = ctx.GetStub().PutState(chunkKey(groupname, session.UploadID, index), chunk)
+	if err != nil {
+		return err
+	}
+	session.ChunkDigests = append(session.ChunkDigests, chunkDigest)
+	session.Size += int64(len(chunk))
+	return putUploadSession(ctx, groupname, session)
+}
+
+// CommitUpload checks the reassembled chunks against digest, the hex encoded SHA-256 of the whole params, and records them as the upload of the user.
+// The chunks stay in the world state, the param record only points to them
+func (s *SmartContract) CommitUpload(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, digest string) error {
+	group, round, err := prepareUpload(ctx, groupname, roundID, userID, 1, 0)
+	if err != nil {
+		return err
+	}
+	session, err := getUploadSession(ctx, groupname, userID, roundID)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return codedError(CodeNotFound, "user %s has no upload in progress for round %s of group %s", userID, roundID, groupname)
+	}
+	if len(session.ChunkDigests) == 0 {
+		return fmt.Errorf("the upload of user %s has no chunks", userID)
+	}
+
+	upload := &ChunkedUpload{
+		UploadID: session.UploadID,
+		Format:   session.Format,
+		Chunks:   len(session.ChunkDigests),
+		Size:     session.Size,
+		Digest:   digest,
+	}
+	param := ModelParam{
+		Upload:      upload,
+		UserID:      userID,
+		RoundID:     roundID,
+		NumSamples:  session.NumSamples,
+		LocalEpochs: session.LocalEpochs,
+	}
+	// reassembling checks the digest, the params are then checked like a single upload
+	reassembled := param
+	err = reassembled.reassemble(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkUpload(ctx, groupname, &reassembled)
+	if err != nil {
+		return err
+	}
+
+	// the chunks of an upload this one replaces are not needed any more
+	previous, err := getStoredParam(ctx, fmt.Sprintf("%s_PARAM_%s_%s", groupname, userID, roundID))
+	if err != nil {
+		return err
+	}
+	if previous != nil && previous.Upload != nil {
+		err = deleteChunks(ctx, groupname, previous.Upload.UploadID, previous.Upload.Chunks)
+		if err != nil {
+			return err
+		}
+	}
+	err = ctx.GetStub().DelState(uploadSessionKey(groupname, userID, roundID))
+	if err != nil {
+		return err
+	}
+	return s.storeUpload(ctx, groupname, group, round, &param, &reassembled)
+}
+
+// GetUploadSession returns the unfinished chunked upload of a user, clients resume it after the acknowledged chunks
+func (s *SmartContract) GetUploadSession(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string) (*UploadSession, error) {
+	session, err := getUploadSession(ctx, groupname, userID, roundID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, codedError(CodeNotFound, "user %s has no upload in progress for round %s of group %s", userID, roundID, groupname)
+	}
+	return session, nil
+}
+
+// GetParamChunk returns chunk index of params uploaded in chunks, base64 encoded
+func (s *SmartContract) GetParamChunk(ctx contractapi.TransactionContextInterface, key string, index int) (string, error) {
+	err := checkRead(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	param, err := getStoredParam(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if param == nil {
+		return "", codedError(CodeNotFound, "the Model Params %s does not exist", key)
+	}
+	if param.Upload == nil {
+		return "", fmt.Errorf("the Model Params %s were not uploaded in chunks", key)
+	}
+	if index < 0 || index >= param.Upload.Chunks {
+		return "", fmt.Errorf("the Model Params %s have no chunk %d", key, index)
+	}
+
+	suffix := "_PARAM_" + param.UserID + "_" + param.RoundID
+	if !strings.HasSuffix(key, suffix) {
+		return "", fmt.Errorf("%s is not the key of user params", key)
+	}
+	groupname := strings.TrimSuffix(key, suffix)
+	chunk, err := ctx.GetStub().GetState(chunkKey(groupname, param.Upload.UploadID, index))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(chunk), nil
+}
+
+// reassemble joins the chunks of the param, checks them against the digest and fills Params or Tensors by the format
+func (p *ModelParam) reassemble(ctx contractapi.TransactionContextInterface, groupname string) error {
+	if p.Upload == nil {
+		return nil
+	}
+	data := make([]byte, 0, p.Upload.Size)
+	for i := 0; i < p.Upload.Chunks; i++ {
+		chunk, err := ctx.GetStub().GetState(chunkKey(groupname, p.Upload.UploadID, i))
+		if err != nil {
+			return err
+		}
+		if chunk == nil {
+			return fmt.Errorf("chunk %d of the upload of user %s is missing", i, p.UserID)
+		}
+		data = append(data, chunk...)
+	}
+	digest := sha256.Sum256(data)
+	if hex.EncodeToString(digest[:]) != p.Upload.Digest {
+		return fmt.Errorf("the chunks uploaded by user %s do not match the digest %s", p.UserID, p.Upload.Digest)
+	}
+
+	switch p.Upload.Format {
+	case ChunkFormatTensor:
+		p.Tensors = base64.StdEncoding.EncodeToString(data)
+		_, err := p.decodeTensors()
+		if err != nil {
+			return err
+		}
+	default:
+		err := json.Unmarshal(data, &p.Params)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal the JSON params of user %s: %s", p.UserID, err.Error())
+		}
+	}
+	p.Upload = nil
+	return nil
+}
+
+// prepareChunkedUpload checks the caller and the round and returns the upload session
+func prepareChunkedUpload(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string) (*UploadSession, error) {
+	_, _, err := prepareUpload(ctx, groupname, roundID, userID, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	session, err := getUploadSession(ctx, groupname, userID, roundID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, codedError(CodeNotFound, "user %s has no upload in progress for round %s of group %s", userID, roundID, groupname)
+	}
+	return session, nil
+}
+
+func uploadSessionKey(groupname string, userID string, roundID string) string {
+	return fmt.Sprintf("%s_UPLOADSESSION_%s_%s", groupname, userID, roundID)
+}
+
+func chunkKey(groupname string, uploadID string, index int) string {
+	return fmt.Sprintf("%s_CHUNK_%s_%d", groupname, uploadID, index)
+}
+
+func getUploadSession(ctx contractapi.TransactionContextInterface, groupname string, userID string, roundID string) (*UploadSession, error) {
+	data, err := ctx.GetStub().GetState(uploadSessionKey(groupname, userID, roundID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the upload session: %s", err.Error())
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var session UploadSession
+	err = json.Unmarshal(data, &session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the upload session: %s", err.Error())
+	}
+	return &session, nil
+}
+
+func putUploadSession(ctx contractapi.TransactionContextInterface, groupname string, session *UploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(uploadSessionKey(groupname, session.UserID, session.RoundID), data)
+}
+
+func deleteChunks(ctx contractapi.TransactionContextInterface, groupname string, uploadID string, chunks int) error {
+	for i := 0; i < chunks; i++ {
+		err := ctx.GetStub().DelState(chunkKey(groupname, uploadID, i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getStoredParam reads a param record as stored, nil if it does not exist
+func getStoredParam(ctx contractapi.TransactionContextInterface, key string) (*ModelParam, error) {
+	data, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var param ModelParam
+	err = json.Unmarshal(data, &param)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data for key %s: %v", key, err)
+	}
+	return &param, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// chunkedUpload drives the chunked upload calls of a user
+type chunkedUpload struct {
+	t      *testing.T
+	stub   *mockStub
+	userID string
+}
+
+func (u chunkedUpload) invoke(fn func(s *SmartContract, ctx contractapi.TransactionContextInterface) error) error {
+	u.stub.mspID, u.stub.caller = "Org1MSP", u.userID
+	return u.stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return fn(new(SmartContract), ctx)
+	})
+}
+
+func (u chunkedUpload) begin() error {
+	return u.invoke(func(s *SmartContract, ctx contractapi.TransactionContextInterface) error {
+		return s.BeginUpload(ctx, "g", "0", u.userID, ChunkFormatJSON, 10, 1)
+	})
+}
+
+func (u chunkedUpload) chunk(index int, chunk string) error {
+	return u.invoke(func(s *SmartContract, ctx contractapi.TransactionContextInterface) error {
+		return s.UploadChunk(ctx, "g", "0", u.userID, index, base64.StdEncoding.EncodeToString([]byte(chunk)))
+	})
+}
+
+func (u chunkedUpload) commit(data string) error {
+	digest := sha256.Sum256([]byte(data))
+	return u.invoke(func(s *SmartContract, ctx contractapi.TransactionContextInterface) error {
+		return s.CommitUpload(ctx, "g", "0", u.userID, hex.EncodeToString(digest[:]))
+	})
+}
+
+func (u chunkedUpload) session() *UploadSession {
+	u.t.Helper()
+	var session *UploadSession
+	err := u.invoke(func(s *SmartContract, ctx contractapi.TransactionContextInterface) error {
+		var err error
+		session, err = s.GetUploadSession(ctx, "g", "0", u.userID)
+		return err
+	})
+	if err != nil {
+		u.t.Fatal(err)
+	}
+	return session
+}
+
+func TestChunkedUpload(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"mode": "finalize"}}`, "u1", "u2")
+	u1 := chunkedUpload{t, stub, "u1"}
+	params := uploadParams(2)
+	chunks := []string{params[:10], params[10:]}
+
+	err := u1.chunk(0, chunks[0])
+	if err == nil || !strings.Contains(err.Error(), "no upload in progress") {
+		t.Fatalf("UploadChunk() before BeginUpload() = %v, want a no upload error", err)
+	}
+	if err := u1.begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := u1.chunk(0, chunks[0]); err != nil {
+		t.Fatal(err)
+	}
+	// a client that lost the acknowledgement resends the chunk
+	if err := u1.chunk(0, chunks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := u1.chunk(0, "something else"); err == nil || !strings.Contains(err.Error(), "differs") {
+		t.Fatalf("resending chunk 0 with other content = %v, want a differs error", err)
+	}
+	if err := u1.chunk(2, chunks[1]); err == nil || !strings.Contains(err.Error(), "expected chunk 1") {
+		t.Fatalf("skipping chunk 1 = %v, want an expected chunk error", err)
+	}
+	if session := u1.session(); len(session.ChunkDigests) != 1 || session.Size != int64(len(chunks[0])) {
+		t.Fatalf("session = %+v, want one acknowledged chunk", session)
+	}
+	if err := u1.chunk(1, chunks[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := u1.commit("other params"); err == nil || !strings.Contains(err.Error(), "do not match the digest") {
+		t.Fatalf("CommitUpload() with a wrong digest = %v, want a digest error", err)
+	}
+	if err := u1.commit(params); err != nil {
+		t.Fatal(err)
+	}
+	if stub.state[uploadSessionKey("g", "u1", "0")] != nil {
+		t.Fatal("CommitUpload() kept the upload session")
+	}
+	if round := roundStatus(t, stub, "g", "0"); len(round.Uploaded) != 1 {
+		t.Fatalf("round 0 uploads = %v, want the committed upload", round.Uploaded)
+	}
+
+	var chunk string
+	err = u1.invoke(func(s *SmartContract, ctx contractapi.TransactionContextInterface) error {
+		var err error
+		chunk, err = s.GetParamChunk(ctx, "g_PARAM_u1_0", 1)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, _ := base64.StdEncoding.DecodeString(chunk); string(decoded) != chunks[1] {
+		t.Fatalf("GetParamChunk() = %q, want %q", decoded, chunks[1])
+	}
+
+	// the round aggregates the reassembled params with the plain uploads
+	if err := upload(stub, "g", "0", "u2", 4); err != nil {
+		t.Fatal(err)
+	}
+	stub.caller = "owner"
+	err = stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return new(SmartContract).FinalizeRound(ctx, "g", "0")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var aggregated ModelParam
+	stub.get(t, "g_AGGREPARAM_0", &aggregated)
+	if got := aggregated.Params["fc.bias"].([]interface{})[0]; got != 3.0 {
+		t.Fatalf("aggregated bias = %v, want 3", got)
+	}
+}
+
+func TestBeginUploadDiscardsChunks(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"mode": "finalize"}}`, "u1")
+	u1 := chunkedUpload{t, stub, "u1"}
+	if err := u1.begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := u1.chunk(0, "stale"); err != nil {
+		t.Fatal(err)
+	}
+	first := u1.session().UploadID
+
+	if err := u1.begin(); err != nil {
+		t.Fatal(err)
+	}
+	if stub.state[chunkKey("g", first, 0)] != nil {
+		t.Fatal("BeginUpload() kept the chunks of the discarded upload")
+	}
+	if session := u1.session(); session.UploadID == first || len(session.ChunkDigests) != 0 {
+		t.Fatalf("session = %+v, want a new upload without chunks", session)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+// Codes that start the messages of the errors clients act on, e.g. "FL_NOT_REGISTERED: user 1 is not registered in group g".
+// The client library matches the codes rather than the text, so the messages may change but the codes must not
+const (
+	// CodeNotRegistered is the user is not a member of the group
+	CodeNotRegistered = "FL_NOT_REGISTERED"
+	// CodeAlreadyRegistered is the user or the group already exists
+	CodeAlreadyRegistered = "FL_ALREADY_REGISTERED"
+	// CodeRoundClosed is the round does not take uploads, it is not open yet, aggregating, closed or failed
+	CodeRoundClosed = "FL_ROUND_CLOSED"
+	// CodeNotFound is the group, params, report, schema, upload or secure aggregation state does not exist
+	CodeNotFound = "FL_NOT_FOUND"
+)
+
+// codedError formats an error whose message starts with the code
+func codedError(code string, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", code, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Chaincode events of the round lifecycle
+const (
+	// EventParamUploaded is emitted when a user param is stored
+	EventParamUploaded = "ParamUploaded"
+	// EventQuorumReached is emitted when a round stops taking uploads and starts its aggregation
+	EventQuorumReached = "QuorumReached"
+	// EventRoundAggregated is emitted when the aggregated params of a round are stored and the round is closed
+	EventRoundAggregated = "RoundAggregated"
+	// EventRoundFailed is emitted when a round fails and has to be restarted
+	EventRoundFailed = "RoundFailed"
+)
+
+// RoundEvent is the payload of a chaincode event. Fabric keeps a single event per transaction,
+// so the payload is the JSON array of every RoundEvent of the transaction and the event is named after the last one
+type RoundEvent struct {
+	Event     string `json:"event"`
+	GroupName string `json:"groupName"`
+	RoundID   string `json:"roundID"`
+	// UserID is the uploader of ParamUploaded
+	UserID string `json:"userID,omitempty"`
+	// Uploaded is the number of users that uploaded params for the round
+	Uploaded int `json:"uploaded"`
+	// Key is the key of the aggregated params of RoundAggregated
+	Key string `json:"key,omitempty"`
+}
+
+// EventContext is the transaction context of the chaincode, it collects the events of the transaction
+type EventContext struct {
+	contractapi.TransactionContext
+	events []RoundEvent
+}
+
+// emitEvent adds the event to the events of the transaction and sets them as its chaincode event.
+// Contexts that do not collect events only keep the last event
+func emitEvent(ctx contractapi.TransactionContextInterface, event RoundEvent) error {
+	events := []RoundEvent{event}
+	if eventCtx, ok := ctx.(*EventContext); ok {
+		eventCtx.events = append(eventCtx.events, event)
+		events = eventCtx.events
+	}
+	payload, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(event.Event, payload)
+}
+
+// emitRoundEvent emits an event about the state of a round
+func emitRoundEvent(ctx contractapi.TransactionContextInterface, name string, groupname string, round *RoundStatus) error {
+	event := RoundEvent{
+		Event:     name,
+		GroupName: groupname,
+		RoundID:   round.RoundID,
+		Uploaded:  len(round.Uploaded),
+	}
+	if name == EventRoundAggregated {
+		event.Key = groupname + "_AGGREPARAM_" + round.RoundID
+	}
+	return emitEvent(ctx, event)
+}
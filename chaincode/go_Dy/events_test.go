@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func checkEvents(t *testing.T, stub *mockStub, want ...string) []RoundEvent {
+	t.Helper()
+	events := stub.events(t)
+	if stub.eventName != want[len(want)-1] || len(events) != len(want) {
+		t.Fatalf("event %s with %+v, want %v", stub.eventName, events, want)
+	}
+	for i := range want {
+		if events[i].Event != want[i] || events[i].GroupName != "g" || events[i].RoundID != "0" {
+			t.Fatalf("event %d = %+v, want %s of round 0 of g", i, events[i], want[i])
+		}
+	}
+	return events
+}
+
+func TestUploadEvents(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"minFraction": 1}}`, "u1", "u2")
+
+	if err := upload(stub, "g", "0", "u1", 1); err != nil {
+		t.Fatal(err)
+	}
+	events := checkEvents(t, stub, EventParamUploaded)
+	if events[0].UserID != "u1" || events[0].Uploaded != 1 {
+		t.Fatalf("event = %+v, want the upload of u1", events[0])
+	}
+
+	// the upload that reaches the quorum reports every step of the transaction in one event
+	if err := upload(stub, "g", "0", "u2", 1); err != nil {
+		t.Fatal(err)
+	}
+	events = checkEvents(t, stub, EventParamUploaded, EventQuorumReached, EventRoundAggregated)
+	if events[2].Key != "g_AGGREPARAM_0" || events[2].Uploaded != 2 {
+		t.Fatalf("event = %+v, want the aggregate of both uploads", events[2])
+	}
+
+	// failed transactions emit nothing
+	if err := upload(stub, "g", "0", "u1", 1); err == nil {
+		t.Fatal("upload to a closed round = nil, want an error")
+	}
+	if stub.eventName != "" {
+		t.Fatalf("a failed transaction emitted %s", stub.eventName)
+	}
+}
+
+func TestRoundFailedEvent(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"minCount": 2, "roundTimeoutSeconds": 10}}`, "u1", "u2")
+
+	stub.now = 20
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return new(SmartContract).CloseExpiredRound(ctx, "g", "0")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, stub, EventRoundFailed)
+}
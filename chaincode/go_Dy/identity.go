@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Identity is the X.509 identity of a client
+type Identity struct {
+	MSPID string `json:"mspID"`
+	// ID is the client identity id, the base64 encoded "x509::<subject>::<issuer>" of the certificate
+	ID string `json:"id"`
+}
+
+// callerIdentity returns the MSP ID and client identity id of the submitter of the transaction
+func callerIdentity(ctx contractapi.TransactionContextInterface) (Identity, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to get the caller MSP ID: %s", err.Error())
+	}
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to get the caller identity: %s", err.Error())
+	}
+	return Identity{MSPID: mspID, ID: id}, nil
+}
+
+// checkMember fails unless the user is an active member of the group and the submitter of the transaction is its registered identity
+func checkMember(ctx contractapi.TransactionContextInterface, group *Group, groupname string, userID string) error {
+	member, exists := group.Members[userID]
+	if !exists {
+		return codedError(CodeNotRegistered, "user %s is not registered in group %s", userID, groupname)
+	}
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if member.Identity != caller {
+		return fmt.Errorf("the caller from %s is not the identity registered for user %s in group %s", caller.MSPID, userID, groupname)
+	}
+	if member.Status == MemberStatusSuspended {
+		return fmt.Errorf("user %s is suspended in group %s", userID, groupname)
+	}
+	return nil
+}
+
+// checkAdmin fails unless the submitter of the transaction owns the group
+func checkAdmin(ctx contractapi.TransactionContextInterface, group *Group, groupname string) error {
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if group.Owner != caller {
+		return fmt.Errorf("the caller from %s is not the owner of group %s", caller.MSPID, groupname)
+	}
+	return nil
+}
+
+// checkParticipant fails unless the submitter of the transaction owns the group or is the identity of an active member
+func checkParticipant(ctx contractapi.TransactionContextInterface, group *Group, groupname string) error {
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if group.Owner == caller {
+		return nil
+	}
+	for _, member := range group.Members {
+		if member.Identity == caller && member.Status != MemberStatusSuspended {
+			return nil
+		}
+	}
+	return fmt.Errorf("the caller from %s is neither the owner nor an active member of group %s", caller.MSPID, groupname)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestRegisterUser(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"mode": "finalize"}}`)
+	register := func(caller string, groupname string, userID string) error {
+		stub.caller = caller
+		return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return new(SmartContract).RegisterUser(ctx, groupname, userID)
+		})
+	}
+
+	if err := register("u1", "g", "u1"); err == nil || !strings.Contains(err.Error(), "not the owner") {
+		t.Fatalf("RegisterUser() by a user = %v, want a not owner error", err)
+	}
+	if err := register("owner", "h", "u1"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("RegisterUser() in a missing group = %v, want a does not exist error", err)
+	}
+	if err := register("owner", "g", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := register("owner", "g", "u1"); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Fatalf("registering u1 again = %v, want an already registered error", err)
+	}
+
+	// the owner uploads for the users it registered
+	var group Group
+	stub.get(t, "g", &group)
+	if member := group.Members["u1"]; member.MSPID != "Org1MSP" || member.ID != "owner" {
+		t.Fatalf("u1 is bound to %+v, want the identity of the owner", member)
+	}
+	stub.caller = "owner"
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return new(SmartContract).UploadModelParam(ctx, "g", "0", "u1", uploadParams(1), 10, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadChecksCaller(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"mode": "finalize"}}`, "u1", "u2")
+	uploadAs := func(mspID string, caller string) error {
+		stub.mspID, stub.caller = mspID, caller
+		return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return new(SmartContract).UploadModelParam(ctx, "g", "0", "u1", uploadParams(1), 10, 1)
+		})
+	}
+
+	tests := []struct {
+		name    string
+		mspID   string
+		caller  string
+		wantErr bool
+	}{
+		{"another user", "Org1MSP", "u2", true},
+		{"same id from another MSP", "Org2MSP", "u1", true},
+		{"the registered identity", "Org1MSP", "u1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := uploadAs(test.mspID, test.caller)
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "not the identity registered") {
+					t.Fatalf("upload = %v, want an identity error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	stub.mspID = "Org1MSP"
+	err := upload(stub, "g", "0", "u3", 1)
+	if err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Fatalf("upload for an unknown user = %v, want a not registered error", err)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Member states, suspended users can not upload and do not count for the quorum
+const (
+	MemberStatusActive    = "active"
+	MemberStatusSuspended = "suspended"
+)
+
+// Member binds a user of a group to its identity
+type Member struct {
+	Identity
+	Status string `json:"status"`
+	// AddedBy is the owner that added the user, it is empty for users that registered themselves
+	// before only the owner could add users, they may not read the aggregates until the owner adds them again
+	AddedBy Identity `json:"addedBy" metadata:",optional"`
+}
+
+// GroupMember describes a user in the GetGroupMembers result
+type GroupMember struct {
+	UserID string `json:"userID"`
+	Member
+}
+
+// GroupMembers lists the owner and the users of a group
+type GroupMembers struct {
+	Owner   Identity      `json:"owner"`
+	Members []GroupMember `json:"members"`
+}
+
+// AddUser lets the group owner add a user bound to the given identity, clientID is the client identity id of the user's certificate
+func (s *SmartContract) AddUser(ctx contractapi.TransactionContextInterface, groupname string, userID string, mspID string, clientID string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkAdmin(ctx, group, groupname)
+	if err != nil {
+		return err
+	}
+	if _, exists := group.Members[userID]; exists {
+		return codedError(CodeAlreadyRegistered, "user %s is already registered in group %s", userID, groupname)
+	}
+
+	caller, err := callerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	group.addMember(userID, Identity{MSPID: mspID, ID: clientID}, caller)
+	return putGroup(ctx, groupname, group)
+}
+
+// RemoveUser lets the group owner remove a user, its uploads to the current round no longer count
+func (s *SmartContract) RemoveUser(ctx contractapi.TransactionContextInterface, groupname string, userID string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkAdmin(ctx, group, groupname)
+	if err != nil {
+		return err
+	}
+	if _, exists := group.Members[userID]; !exists {
+		return codedError(CodeNotRegistered, "user %s is not registered in group %s", userID, groupname)
+	}
+
+	wasActive := group.isActive(userID)
+	delete(group.Members, userID)
+	group.Users = removeString(group.Users, userID)
+	if wasActive {
+		err = group.checkShrink(groupname)
+		if err != nil {
+			return err
+		}
+	}
+
+	round, err := getRoundStatus(ctx, groupname, group.CurrentRound)
+	if err != nil {
+		return err
+	}
+	if round != nil && contains(round.Uploaded, userID) {
+		round.Uploaded = removeString(round.Uploaded, userID)
+		err = putRoundStatus(ctx, groupname, round)
+		if err != nil {
+			return err
+		}
+	}
+	return putGroup(ctx, groupname, group)
+}
+
+// SuspendUser lets the group owner stop a user from uploading until it is reinstated
+func (s *SmartContract) SuspendUser(ctx contractapi.TransactionContextInterface, groupname string, userID string) error {
+	return s.setMemberStatus(ctx, groupname, userID, MemberStatusSuspended)
+}
+
+// ReinstateUser lets the group owner end the suspension of a user
+func (s *SmartContract) ReinstateUser(ctx contractapi.TransactionContextInterface, groupname string, userID string) error {
+	return s.setMemberStatus(ctx, groupname, userID, MemberStatusActive)
+}
+
+// TransferOwnership lets the group owner hand the group over to the identity of an active member,
+// so the group can not end up with an owner no one holds
+func (s *SmartContract) TransferOwnership(ctx contractapi.TransactionContextInterface, groupname string, mspID string, clientID string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkAdmin(ctx, group, groupname)
+	if err != nil {
+		return err
+	}
+	if mspID == "" || clientID == "" {
+		return fmt.Errorf("the new owner of group %s needs an MSP ID and a client identity id", groupname)
+	}
+
+	owner := Identity{MSPID: mspID, ID: clientID}
+	for _, userID := range group.Users {
+		member := group.Members[userID]
+		if member.Identity == owner && member.Status != MemberStatusSuspended {
+			group.Owner = owner
+			return putGroup(ctx, groupname, group)
+		}
+	}
+	return fmt.Errorf("the new owner from %s is not the identity of an active member of group %s", mspID, groupname)
+}
+
+// GetGroupMembers returns the owner of a group and its users in registration order, to the owner and the members it added
+func (s *SmartContract) GetGroupMembers(ctx contractapi.TransactionContextInterface, groupname string) (*GroupMembers, error) {
+	err := checkGroupRead(ctx, groupname, groupname)
+	if err != nil {
+		return nil, err
+	}
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return nil, err
+	}
+
+	members := GroupMembers{Owner: group.Owner, Members: []GroupMember{}}
+	for _, userID := range group.Users {
+		member := group.Members[userID]
+		if member.Status == "" {
+			member.Status = MemberStatusActive
+		}
+		members.Members = append(members.Members, GroupMember{UserID: userID, Member: member})
+	}
+	return &members, nil
+}
+
+func (s *SmartContract) setMemberStatus(ctx contractapi.TransactionContextInterface, groupname string, userID string, status string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkAdmin(ctx, group, groupname)
+	if err != nil {
+		return err
+	}
+	member, exists := group.Members[userID]
+	if !exists {
+		return codedError(CodeNotRegistered, "user %s is not registered in group %s", userID, groupname)
+	}
+
+	wasActive := group.isActive(userID)
+	member.Status = status
+	group.Members[userID] = member
+	if wasActive && status == MemberStatusSuspended {
+		err = group.checkShrink(groupname)
+		if err != nil {
+			return err
+		}
+	}
+	return putGroup(ctx, groupname, group)
+}
+
+// addMember appends an active user bound to the identity, addedBy is the owner adding it
+func (g *Group) addMember(userID string, identity Identity, addedBy Identity) {
+	if g.Members == nil {
+		g.Members = make(map[string]Member)
+	}
+	g.Members[userID] = Member{Identity: identity, Status: MemberStatusActive, AddedBy: addedBy}
+	g.Users = append(g.Users, userID)
+}
+
+// isActive tells whether the user is a member of the group that is not suspended
+func (g *Group) isActive(userID string) bool {
+	member, exists := g.Members[userID]
+	return exists && member.Status != MemberStatusSuspended
+}
+
+// activeUsers lists the active users of the group in registration order
+func (g *Group) activeUsers() []string {
+	var users []string
+	for _, userID := range g.Users {
+		if g.isActive(userID) {
+			users = append(users, userID)
+		}
+	}
+	return users
+}
+
+// checkSize fails when the group has fewer active users than the uploads its aggregation rule needs,
+// its rounds could never be aggregated
+func (g *Group) checkSize(groupname string) error {
+	active := len(g.activeUsers())
+	if required := g.Config.Aggregation.minUploads(); active < required {
+		return fmt.Errorf("group %s has %d active users, the %s rule needs %d uploads", groupname, active, g.Config.Aggregation.Rule, required)
+	}
+	return nil
+}
+
+// checkShrink fails when losing one active user took the group below the uploads its aggregation rule needs.
+// Groups that are still being filled up may lose users, and so may groups whose rule aggregates a single upload
+func (g *Group) checkShrink(groupname string) error {
+	required := g.Config.Aggregation.minUploads()
+	if required <= 1 || len(g.activeUsers())+1 < required {
+		return nil
+	}
+	return g.checkSize(groupname)
+}
+
+// countActive counts the active users of the group in the list
+func (g *Group) countActive(users []string) int {
+	count := 0
+	for _, userID := range users {
+		if g.isActive(userID) {
+			count++
+		}
+	}
+	return count
+}
+
+func removeString(list []string, value string) []string {
+	result := make([]string, 0, len(list))
+	for _, v := range list {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestMemberManagement(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"mode": "finalize"}}`, "u1", "u2")
+	s := new(SmartContract)
+	as := func(caller string, fn func(ctx contractapi.TransactionContextInterface) error) error {
+		stub.mspID, stub.caller = "Org1MSP", caller
+		return stub.invoke(fn)
+	}
+
+	err := as("u1", func(ctx contractapi.TransactionContextInterface) error {
+		return s.AddUser(ctx, "g", "u3", "Org2MSP", "carol")
+	})
+	if err == nil || !strings.Contains(err.Error(), "not the owner") {
+		t.Fatalf("AddUser() by a user = %v, want a not owner error", err)
+	}
+	err = as("owner", func(ctx contractapi.TransactionContextInterface) error {
+		return s.AddUser(ctx, "g", "u3", "Org2MSP", "carol")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = as("owner", func(ctx contractapi.TransactionContextInterface) error {
+		return s.AddUser(ctx, "g", "u3", "Org2MSP", "carol")
+	})
+	if err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Fatalf("adding u3 twice = %v, want an already registered error", err)
+	}
+
+	// the added user uploads with the identity the owner bound it to
+	stub.mspID, stub.caller = "Org2MSP", "carol"
+	err = stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return s.UploadModelParam(ctx, "g", "0", "u3", uploadParams(1), 10, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = as("owner", func(ctx contractapi.TransactionContextInterface) error {
+		return s.SuspendUser(ctx, "g", "u2")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = upload(stub, "g", "0", "u2", 1)
+	if err == nil || !strings.Contains(err.Error(), "suspended") {
+		t.Fatalf("upload by a suspended user = %v, want a suspended error", err)
+	}
+
+	var members *GroupMembers
+	err = as("owner", func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		members, err = s.GetGroupMembers(ctx, "g")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := Identity{MSPID: "Org1MSP", ID: "owner"}
+	want := []GroupMember{
+		{UserID: "u1", Member: Member{Identity: Identity{MSPID: "Org1MSP", ID: "u1"}, Status: MemberStatusActive, AddedBy: owner}},
+		{UserID: "u2", Member: Member{Identity: Identity{MSPID: "Org1MSP", ID: "u2"}, Status: MemberStatusSuspended, AddedBy: owner}},
+		{UserID: "u3", Member: Member{Identity: Identity{MSPID: "Org2MSP", ID: "carol"}, Status: MemberStatusActive, AddedBy: owner}},
+	}
+	if members.Owner.ID != "owner" || len(members.Members) != len(want) {
+		t.Fatalf("GetGroupMembers() = %+v, want owner and %d members", members, len(want))
+	}
+	for i := range want {
+		if members.Members[i] != want[i] {
+			t.Fatalf("member %d = %+v, want %+v", i, members.Members[i], want[i])
+		}
+	}
+
+	err = as("owner", func(ctx contractapi.TransactionContextInterface) error {
+		return s.ReinstateUser(ctx, "g", "u2")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := upload(stub, "g", "0", "u2", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveUser(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"mode": "finalize"}}`, "u1", "u2")
+	if err := upload(stub, "g", "0", "u1", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	stub.caller = "owner"
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return new(SmartContract).RemoveUser(ctx, "g", "u1")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var group Group
+	stub.get(t, "g", &group)
+	if len(group.Users) != 1 || group.Users[0] != "u2" || group.Members["u1"] != (Member{}) {
+		t.Fatalf("group after removing u1 = %+v, want only u2", group)
+	}
+	if round := roundStatus(t, stub, "g", "0"); len(round.Uploaded) != 0 {
+		t.Fatalf("round 0 uploads = %v, want the upload of u1 dropped", round.Uploaded)
+	}
+	err = upload(stub, "g", "0", "u1", 1)
+	if err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Fatalf("upload by a removed user = %v, want a not registered error", err)
+	}
+}
+
+func TestTransferOwnership(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{}`, "u1")
+	s := new(SmartContract)
+	suspend := func(caller string) error {
+		stub.caller = caller
+		return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return s.SuspendUser(ctx, "g", "u1")
+		})
+	}
+
+	transfer := func(clientID string) error {
+		stub.caller = "owner"
+		return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return s.TransferOwnership(ctx, "g", "Org1MSP", clientID)
+		})
+	}
+
+	// the group can only go to an identity someone in it holds
+	err := transfer("mallory")
+	if err == nil || !strings.Contains(err.Error(), "not the identity of an active member") {
+		t.Fatalf("TransferOwnership() to an outsider = %v, want a not a member error", err)
+	}
+	if err := transfer("u1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := suspend("owner"); err == nil {
+		t.Fatal("the previous owner still administers the group")
+	}
+	if err := suspend("u1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQuorumCountsActiveUsers(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"minFraction": 1, "mode": "finalize"}}`, "u1", "u2", "u3")
+	if err := upload(stub, "g", "0", "u1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := upload(stub, "g", "0", "u2", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	stub.caller = "owner"
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return new(SmartContract).SuspendUser(ctx, "g", "u3")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var group Group
+	stub.get(t, "g", &group)
+	if !quorumReached(&group, roundStatus(t, stub, "g", "0")) {
+		t.Fatal("the quorum counted the suspended user")
+	}
+}
+
+func TestKrumGroupSize(t *testing.T) {
+	stub := newMockStub()
+	config := `{"aggregation": {"rule": "krum", "byzantineCount": 0}}`
+	setupGroup(t, stub, "g", config, "u1", "u2")
+	s := new(SmartContract)
+	owner := func(fn func(ctx contractapi.TransactionContextInterface) error) error {
+		stub.mspID, stub.caller = "Org1MSP", "owner"
+		return stub.invoke(fn)
+	}
+
+	// krum needs 2f+3 uploads, a group of two could never aggregate
+	err := upload(stub, "g", "0", "u1", 1)
+	if err == nil || !strings.Contains(err.Error(), "needs 3 uploads") {
+		t.Fatalf("upload to a group of two = %v, want a group size error", err)
+	}
+	// a group that is still being filled up may lose users
+	err = owner(func(ctx contractapi.TransactionContextInterface) error {
+		return s.RemoveUser(ctx, "g", "u2")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"u2", "u3"} {
+		err = owner(func(ctx contractapi.TransactionContextInterface) error {
+			return s.AddUser(ctx, "g", user, "Org1MSP", user)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := upload(stub, "g", "0", "u1", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	err = owner(func(ctx contractapi.TransactionContextInterface) error {
+		return s.SuspendUser(ctx, "g", "u2")
+	})
+	if err == nil || !strings.Contains(err.Error(), "needs 3 uploads") {
+		t.Fatalf("SuspendUser() below the krum minimum = %v, want a group size error", err)
+	}
+	err = owner(func(ctx contractapi.TransactionContextInterface) error {
+		return s.RemoveUser(ctx, "g", "u3")
+	})
+	if err == nil || !strings.Contains(err.Error(), "needs 3 uploads") {
+		t.Fatalf("RemoveUser() below the krum minimum = %v, want a group size error", err)
+	}
+	if uploads := len(roundStatus(t, stub, "g", "0").Uploaded); uploads != 1 {
+		t.Fatalf("round 0 uploads = %d, want the upload of u1", uploads)
+	}
+}
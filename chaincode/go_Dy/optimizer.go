@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Server optimizers a group can apply on top of the aggregated params
+const (
+	// OptimizerNone uses the aggregated params as the new global model
+	OptimizerNone = "none"
+	// OptimizerFedAvgM applies server momentum
+	OptimizerFedAvgM = "fedavgm"
+	// OptimizerFedAdam applies Adam
+	OptimizerFedAdam = "fedadam"
+	// OptimizerFedYogi applies Yogi
+	OptimizerFedYogi = "fedyogi"
+)
+
+// OptimizerConfig selects the server optimizer of a group. The optimizer treats
+// (aggregated params - previous global params) as a pseudo-gradient and steps the previous global params with it.
+// FedAvgM uses Beta1 as its momentum, FedAdam and FedYogi use Beta1, Beta2 and the adaptivity Tau.
+// Unset values take the defaults of validate, so zero can be set explicitly, e.g. a Beta1 of 0 turns the momentum off
+type OptimizerConfig struct {
+	Name         string   `json:"name"`
+	LearningRate *float64 `json:"learningRate,omitempty" metadata:",optional"`
+	Beta1        *float64 `json:"beta1,omitempty" metadata:",optional"`
+	Beta2        *float64 `json:"beta2,omitempty" metadata:",optional"`
+	Tau          *float64 `json:"tau,omitempty" metadata:",optional"`
+}
+
+// OptimizerState holds the moments of the server optimizer of a group, the key is "groupname_OPTSTATE"
+type OptimizerState struct {
+	// RoundID is the last round the optimizer stepped
+	RoundID  string                 `json:"roundID"`
+	Momentum map[string]interface{} `json:"momentum"`
+	Variance map[string]interface{} `json:"variance,omitempty" metadata:",optional"`
+}
+
+func (c *OptimizerConfig) validate() error {
+	switch c.Name {
+	case "":
+		c.Name = OptimizerNone
+		return nil
+	case OptimizerNone:
+		return nil
+	case OptimizerFedAvgM, OptimizerFedAdam, OptimizerFedYogi:
+	default:
+		return fmt.Errorf("unknown server optimizer %s", c.Name)
+	}
+
+	// defaults follow the adaptive federated optimization paper, FedAdam and FedYogi take a server learning rate
+	// of 1e-2 because their first steps move every weight by about the learning rate
+	learningRate := 1.0
+	if c.Name != OptimizerFedAvgM {
+		learningRate = 1e-2
+	}
+	setDefault(&c.LearningRate, learningRate)
+	setDefault(&c.Beta1, 0.9)
+	setDefault(&c.Beta2, 0.99)
+	setDefault(&c.Tau, 1e-3)
+	if *c.LearningRate <= 0 {
+		return fmt.Errorf("the server learning rate must be positive, got %v", *c.LearningRate)
+	}
+	if *c.Beta1 < 0 || *c.Beta1 >= 1 || *c.Beta2 < 0 || *c.Beta2 >= 1 {
+		return fmt.Errorf("the betas must be in [0, 1), got %v and %v", *c.Beta1, *c.Beta2)
+	}
+	if *c.Tau <= 0 && c.Name != OptimizerFedAvgM {
+		return fmt.Errorf("the tau must be positive, got %v", *c.Tau)
+	}
+	return nil
+}
+
+// setDefault sets an unset value of the config
+func setDefault(value **float64, def float64) {
+	if *value == nil {
+		*value = &def
+	}
+}
+
+// applyServerOptimizer steps the global model of the previous round with the aggregated params of this round.
+// Without a previous global model (the first round) the aggregated params are used as they are
+func applyServerOptimizer(ctx contractapi.TransactionContextInterface, groupname string, config OptimizerConfig, roundID string, aggreParams map[string]interface{}) (map[string]interface{}, error) {
+	if config.Name == "" || config.Name == OptimizerNone {
+		return aggreParams, nil
+	}
+	// validate fills in the values a stored config lacks
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+	learningRate, beta1, beta2, tau := *config.LearningRate, *config.Beta1, *config.Beta2, *config.Tau
+
+	round, err := strconv.Atoi(roundID)
+	if err != nil {
+		return nil, fmt.Errorf("the server optimizer needs numeric round ids, got %s", roundID)
+	}
+	previousJSON, err := ctx.GetStub().GetState(groupname + "_AGGREPARAM_" + strconv.Itoa(round-1))
+	if err != nil {
+		return nil, err
+	}
+	if previousJSON == nil {
+		return aggreParams, nil
+	}
+	var previous ModelParam
+	err = json.Unmarshal(previousJSON, &previous)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the previous global params: %v", err)
+	}
+	err = previous.expandTensors()
+	if err != nil {
+		return nil, err
+	}
+
+	stateKey := groupname + "_OPTSTATE"
+	stateJSON, err := ctx.GetStub().GetState(stateKey)
+	if err != nil {
+		return nil, err
+	}
+	var state OptimizerState
+	if stateJSON != nil {
+		err = json.Unmarshal(stateJSON, &state)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal the optimizer state: %v", err)
+		}
+	}
+	if state.RoundID == roundID {
+		return nil, fmt.Errorf("the server optimizer already stepped round %s", roundID)
+	}
+	// the moments belong to the global model they stepped, a round without a stepped predecessor starts over
+	if state.RoundID != strconv.Itoa(round-1) {
+		state = OptimizerState{}
+	}
+
+	owners := []string{"the aggregated params", "the previous global params"}
+	delta, err := combineMaps([]map[string]interface{}{aggreParams, previous.Params}, owners, func(v []float64) float64 {
+		return v[0] - v[1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	if state.Momentum == nil {
+		state.Momentum = constantLike(delta, 0)
+	}
+	if state.Variance == nil && config.Name != OptimizerFedAvgM {
+		state.Variance = constantLike(delta, tau*tau)
+	}
+
+	owners = []string{"the optimizer momentum", "the pseudo-gradient"}
+	state.Momentum, err = combineMaps([]map[string]interface{}{state.Momentum, delta}, owners, func(v []float64) float64 {
+		if config.Name == OptimizerFedAvgM {
+			return beta1*v[0] + v[1]
+		}
+		return beta1*v[0] + (1-beta1)*v[1]
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var globalParams map[string]interface{}
+	if config.Name == OptimizerFedAvgM {
+		owners = []string{"the previous global params", "the optimizer momentum"}
+		globalParams, err = combineMaps([]map[string]interface{}{previous.Params, state.Momentum}, owners, func(v []float64) float64 {
+			return v[0] + learningRate*v[1]
+		})
+	} else {
+		owners = []string{"the optimizer variance", "the pseudo-gradient"}
+		state.Variance, err = combineMaps([]map[string]interface{}{state.Variance, delta}, owners, func(v []float64) float64 {
+			squared := v[1] * v[1]
+			if config.Name == OptimizerFedYogi {
+				return v[0] - (1-beta2)*squared*sign(v[0]-squared)
+			}
+			return beta2*v[0] + (1-beta2)*squared
+		})
+		if err != nil {
+			return nil, err
+		}
+		owners = []string{"the previous global params", "the optimizer momentum", "the optimizer variance"}
+		globalParams, err = combineMaps([]map[string]interface{}{previous.Params, state.Momentum, state.Variance}, owners, func(v []float64) float64 {
+			return v[0] + learningRate*v[1]/(math.Sqrt(v[2])+tau)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state.RoundID = roundID
+	stateJSON, err = json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.GetStub().PutState(stateKey, stateJSON)
+	if err != nil {
+		return nil, err
+	}
+	return globalParams, nil
+}
+
+// constantLike returns a params tree shaped like params with every value set to value
+func constantLike(params map[string]interface{}, value float64) map[string]interface{} {
+	result, _ := combineMaps([]map[string]interface{}{params}, []string{"params"}, func([]float64) float64 {
+		return value
+	})
+	return result
+}
+
+func sign(x float64) float64 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	default:
+		return 0
+	}
+}
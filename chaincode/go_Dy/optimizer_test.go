@@ -0,0 +1,185 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func weightParams(value float64) map[string]interface{} {
+	return map[string]interface{}{"w": []interface{}{value}}
+}
+
+func stepOptimizer(stub *mockStub, config OptimizerConfig, roundID string, value float64) (float64, error) {
+	var got float64
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		params, err := applyServerOptimizer(ctx, "g", config, roundID, weightParams(value))
+		if err != nil {
+			return err
+		}
+		got = params["w"].([]interface{})[0].(float64)
+		return nil
+	})
+	return got, err
+}
+
+func TestApplyServerOptimizerFedAvgM(t *testing.T) {
+	config := OptimizerConfig{Name: OptimizerFedAvgM}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	stub := newMockStub()
+
+	// the first round has no previous global model
+	got, err := stepOptimizer(stub, config, "0", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 1 {
+		t.Fatalf("round 0 global = %v, want the aggregate 1", got)
+	}
+	stub.put(t, "g_AGGREPARAM_0", ModelParam{Params: weightParams(1)})
+
+	// momentum 0.9*0 + (3-1) = 2, global 1 + 2 = 3
+	got, err = stepOptimizer(stub, config, "1", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got-3) > 1e-12 {
+		t.Fatalf("round 1 global = %v, want 3", got)
+	}
+	stub.put(t, "g_AGGREPARAM_1", ModelParam{Params: weightParams(got)})
+
+	// momentum 0.9*2 + (4-3) = 2.8, global 3 + 2.8 = 5.8
+	got, err = stepOptimizer(stub, config, "2", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got-5.8) > 1e-12 {
+		t.Fatalf("round 2 global = %v, want 5.8", got)
+	}
+
+	_, err = stepOptimizer(stub, config, "2", 4)
+	if err == nil || !strings.Contains(err.Error(), "already stepped") {
+		t.Fatalf("stepping round 2 again: got %v, want an already stepped error", err)
+	}
+}
+
+func TestApplyServerOptimizerResetsMomentum(t *testing.T) {
+	config := OptimizerConfig{Name: OptimizerFedAvgM}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	stub := newMockStub()
+	stub.put(t, "g_AGGREPARAM_0", ModelParam{Params: weightParams(1)})
+	if _, err := stepOptimizer(stub, config, "1", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// round 2 was never aggregated, round 3 has no previous global model
+	got, err := stepOptimizer(stub, config, "3", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 7 {
+		t.Fatalf("round 3 global = %v, want the aggregate 7", got)
+	}
+	stub.put(t, "g_AGGREPARAM_3", ModelParam{Params: weightParams(7)})
+
+	// the momentum of round 1 is dropped: momentum 0 + (8-7) = 1, global 7 + 1 = 8
+	got, err = stepOptimizer(stub, config, "4", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got-8) > 1e-12 {
+		t.Fatalf("round 4 global = %v, want 8 without the momentum of round 1", got)
+	}
+}
+
+func TestApplyServerOptimizerFedAdam(t *testing.T) {
+	config := OptimizerConfig{Name: OptimizerFedAdam, LearningRate: float(0.1)}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	stub := newMockStub()
+	stub.put(t, "g_AGGREPARAM_0", ModelParam{Params: weightParams(1)})
+
+	got, err := stepOptimizer(stub, config, "1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// delta 1, m = 0.1, v = 0.99*tau^2 + 0.01
+	v := 0.99*1e-6 + 0.01
+	want := 1 + 0.1*0.1/(math.Sqrt(v)+1e-3)
+	if math.Abs(got-want) > 1e-12 {
+		t.Fatalf("round 1 global = %v, want %v", got, want)
+	}
+
+	var state OptimizerState
+	if !stub.get(t, "g_OPTSTATE", &state) || state.RoundID != "1" {
+		t.Fatalf("optimizer state = %+v, want the state of round 1", state)
+	}
+}
+
+func TestOptimizerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  OptimizerConfig
+		want    OptimizerConfig
+		wantErr bool
+	}{
+		{"fedavgm defaults", OptimizerConfig{Name: OptimizerFedAvgM},
+			OptimizerConfig{Name: OptimizerFedAvgM, LearningRate: float(1), Beta1: float(0.9), Beta2: float(0.99), Tau: float(1e-3)}, false},
+		{"fedadam defaults", OptimizerConfig{Name: OptimizerFedAdam},
+			OptimizerConfig{Name: OptimizerFedAdam, LearningRate: float(1e-2), Beta1: float(0.9), Beta2: float(0.99), Tau: float(1e-3)}, false},
+		{"explicit zero beta", OptimizerConfig{Name: OptimizerFedYogi, Beta1: float(0)},
+			OptimizerConfig{Name: OptimizerFedYogi, LearningRate: float(1e-2), Beta1: float(0), Beta2: float(0.99), Tau: float(1e-3)}, false},
+		{"zero learning rate", OptimizerConfig{Name: OptimizerFedAvgM, LearningRate: float(0)}, OptimizerConfig{}, true},
+		{"beta of one", OptimizerConfig{Name: OptimizerFedAdam, Beta2: float(1)}, OptimizerConfig{}, true},
+		{"zero tau", OptimizerConfig{Name: OptimizerFedAdam, Tau: float(0)}, OptimizerConfig{}, true},
+		{"unknown", OptimizerConfig{Name: "sgd"}, OptimizerConfig{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			err := config.validate()
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("validate() = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []float64{*config.LearningRate, *config.Beta1, *config.Beta2, *config.Tau}
+			want := []float64{*test.want.LearningRate, *test.want.Beta1, *test.want.Beta2, *test.want.Tau}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("validate() set %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyServerOptimizerNone(t *testing.T) {
+	stub := newMockStub()
+	stub.put(t, "g_AGGREPARAM_0", ModelParam{Params: weightParams(1)})
+	got, err := stepOptimizer(stub, OptimizerConfig{Name: OptimizerNone}, "1", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 5 {
+		t.Fatalf("global = %v, want the aggregate 5", got)
+	}
+	if stub.state["g_OPTSTATE"] != nil {
+		t.Fatal("the none optimizer stored a state")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestGroupPolicyQuorum(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy GroupPolicy
+		users  int
+		want   int
+	}{
+		{"default is 80% of the users", GroupPolicy{}, 10, 8},
+		{"fraction rounds to the nearest user", GroupPolicy{MinFraction: 0.5}, 5, 3},
+		{"count above the fraction", GroupPolicy{MinCount: 4, MinFraction: 0.1}, 10, 4},
+		{"fraction above the count", GroupPolicy{MinCount: 2, MinFraction: 0.5}, 10, 5},
+		{"at least one upload", GroupPolicy{MinFraction: 0.1}, 2, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := test.policy
+			if err := policy.validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := policy.quorum(test.users); got != test.want {
+				t.Fatalf("quorum(%d) = %d, want %d", test.users, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGroupPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  GroupPolicy
+		wantErr bool
+	}{
+		{"empty uses the defaults", GroupPolicy{}, false},
+		{"finalize mode", GroupPolicy{MinCount: 2, Mode: PolicyModeFinalize}, false},
+		{"negative count", GroupPolicy{MinCount: -1}, true},
+		{"fraction above one", GroupPolicy{MinFraction: 1.5}, true},
+		{"unknown mode", GroupPolicy{MinCount: 1, Mode: "lazy"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.validate()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("validate() = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestFinalizeRound(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"minCount": 2, "mode": "finalize"}}`, "u1", "u2", "u3")
+	finalize := func(caller string) error {
+		stub.caller = caller
+		return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return new(SmartContract).FinalizeRound(ctx, "g", "0")
+		})
+	}
+
+	if err := upload(stub, "g", "0", "u1", 1); err != nil {
+		t.Fatal(err)
+	}
+	err := finalize("owner")
+	if err == nil || !strings.Contains(err.Error(), "quorum") {
+		t.Fatalf("FinalizeRound() before the quorum = %v, want a quorum error", err)
+	}
+
+	if err := upload(stub, "g", "0", "u2", 3); err != nil {
+		t.Fatal(err)
+	}
+	if stub.state["g_AGGREPARAM_0"] != nil {
+		t.Fatal("a finalize group aggregated without FinalizeRound")
+	}
+	// only the owner closes the round
+	err = finalize("u1")
+	if err == nil || !strings.Contains(err.Error(), "not the owner") {
+		t.Fatalf("FinalizeRound() by a member = %v, want a not the owner error", err)
+	}
+	if err := finalize("owner"); err != nil {
+		t.Fatal(err)
+	}
+	var aggregated ModelParam
+	if !stub.get(t, "g_AGGREPARAM_0", &aggregated) {
+		t.Fatal("FinalizeRound() did not store the aggregated params")
+	}
+	if got := aggregated.Params["fc.bias"].([]interface{})[0]; got != 2.0 {
+		t.Fatalf("aggregated bias = %v, want 2", got)
+	}
+
+	err = finalize("owner")
+	if err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Fatalf("FinalizeRound() twice = %v, want a round closed error", err)
+	}
+}
+
+func TestGetGroupPolicy(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{}`, "u1")
+	var policy *GroupPolicy
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		policy, err = new(SmartContract).GetGroupPolicy(ctx, "g")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.MinFraction != defaultMinFraction || policy.Mode != PolicyModeEager {
+		t.Fatalf("GetGroupPolicy() = %+v, want the default policy", policy)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// DefaultCollection is the private data collection of groups that do not name one,
+// it has to be defined in the collection config the chaincode is deployed with.
+// The collection is shared by the member orgs on purpose: the params are aggregated by the chaincode,
+// so every endorsing peer has to hold the uploads of all users. Per-org collections would leave each
+// peer with the params of its own org only. The collection config disseminates the params to at least
+// one peer of another member org before the upload is endorsed
+const DefaultCollection = "flParamCollection"
+
+// Transient keys of UploadPrivateParam, the params travel as transient data so they never reach the public ledger
+const (
+	// TransientParams holds the params as a JSON tree
+	TransientParams = "params"
+	// TransientTensors holds the params as a binary tensor container
+	TransientTensors = "tensors"
+)
+
+// PrivateRef points to params kept in a private data collection
+type PrivateRef struct {
+	Collection string `json:"collection"`
+	// Hash is the hex encoded SHA-256 of the private value, it matches the hash Fabric keeps on the public ledger
+	Hash string `json:"hash"`
+}
+
+// privateData tells whether the group keeps its params in a private data collection
+func (c *GroupConfig) privateData() bool {
+	return c.Storage == StoragePrivate
+}
+
+// UploadPrivateParam writes the params of a user to the private data collection of the group and publishes their hash.
+// The params are passed in the transient data under TransientParams as JSON or under TransientTensors as a tensor container
+func (s *SmartContract) UploadPrivateParam(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, numSamples int, localEpochs int) error {
+	group, round, err := prepareUpload(ctx, groupname, roundID, userID, numSamples, localEpochs)
+	if err != nil {
+		return err
+	}
+	if !group.Config.privateData() {
+		return fmt.Errorf("group %s does not keep its params in a private data collection", groupname)
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to get the transient data: %s", err.Error())
+	}
+	param := ModelParam{
+		UserID:      userID,
+		RoundID:     roundID,
+		NumSamples:  numSamples,
+		LocalEpochs: localEpochs,
+	}
+	if data, exists := transient[TransientTensors]; exists {
+		param.Tensors = base64.StdEncoding.EncodeToString(data)
+	} else if data, exists := transient[TransientParams]; exists {
+		err = json.Unmarshal(data, &param.Params)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal JSON params: %s", err.Error())
+		}
+	} else {
+		return fmt.Errorf("the transient data holds neither %s nor %s", TransientParams, TransientTensors)
+	}
+	err = checkUpload(ctx, groupname, &param)
+	if err != nil {
+		return err
+	}
+
+	privateJSON, err := json.Marshal(param)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ModelParam: %s", err.Error())
+	}
+	collection := group.Config.Collection
+	paramKey := fmt.Sprintf("%s_PARAM_%s_%s", groupname, userID, roundID)
+	err = ctx.GetStub().PutPrivateData(collection, paramKey, privateJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put private data: %s", err.Error())
+	}
+
+	hash := sha256.Sum256(privateJSON)
+	public := ModelParam{
+		Private:     &PrivateRef{Collection: collection, Hash: hex.EncodeToString(hash[:])},
+		UserID:      userID,
+		RoundID:     roundID,
+		NumSamples:  numSamples,
+		LocalEpochs: localEpochs,
+	}
+	return s.storeUpload(ctx, groupname, group, round, &public, &param)
+}
+
+// GetPrivateParam returns the params stored under the key in the private data collection,
+// only peers of the orgs that are members of the collection hold them
+func (s *SmartContract) GetPrivateParam(ctx contractapi.TransactionContextInterface, key string) (*ModelParam, error) {
+	err := checkRead(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	param, err := getStoredParam(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if param == nil {
+		return nil, codedError(CodeNotFound, "the Model Params %s does not exist", key)
+	}
+	if param.Private == nil {
+		return nil, fmt.Errorf("the Model Params %s are not kept in a private data collection", key)
+	}
+	err = param.loadPrivate(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return param, nil
+}
+
+// loadPrivate replaces the public record of a param with the params kept in the private data collection,
+// they are checked against the published hash
+func (p *ModelParam) loadPrivate(ctx contractapi.TransactionContextInterface, key string) error {
+	if p.Private == nil {
+		return nil
+	}
+	data, err := ctx.GetStub().GetPrivateData(p.Private.Collection, key)
+	if err != nil {
+		return fmt.Errorf("failed to get private data: %s", err.Error())
+	}
+	if data == nil {
+		return fmt.Errorf("the private params %s are not available on this peer", key)
+	}
+	hash := sha256.Sum256(data)
+	expected, err := hex.DecodeString(p.Private.Hash)
+	if err != nil || !bytes.Equal(hash[:], expected) {
+		return fmt.Errorf("the private params %s do not match the published hash", key)
+	}
+
+	var private ModelParam
+	err = json.Unmarshal(data, &private)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON data for key %s: %v", key, err)
+	}
+	*p = private
+	return nil
+}
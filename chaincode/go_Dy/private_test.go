@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func uploadPrivate(stub *mockStub, userID string, transient map[string][]byte) error {
+	stub.caller = userID
+	stub.transient = transient
+	defer func() { stub.transient = nil }()
+	return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return new(SmartContract).UploadPrivateParam(ctx, "g", "0", userID, 10, 1)
+	})
+}
+
+func TestUploadPrivateParam(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"storage": "private", "policy": {"mode": "finalize"}}`, "u1", "u2")
+
+	err := upload(stub, "g", "0", "u1", 1)
+	if err == nil || !strings.Contains(err.Error(), "UploadPrivateParam") {
+		t.Fatalf("UploadModelParam() to a private group = %v, want an error", err)
+	}
+	err = uploadPrivate(stub, "u1", nil)
+	if err == nil || !strings.Contains(err.Error(), "neither") {
+		t.Fatalf("UploadPrivateParam() without transient data = %v, want an error", err)
+	}
+	if err := uploadPrivate(stub, "u1", map[string][]byte{TransientParams: []byte(uploadParams(1))}); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploadPrivate(stub, "u2", map[string][]byte{TransientParams: []byte(uploadParams(3))}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the world state only holds the hash of the params
+	var public ModelParam
+	stub.get(t, "g_PARAM_u1_0", &public)
+	if public.Params != nil || public.Private == nil || public.Private.Collection != DefaultCollection {
+		t.Fatalf("public record = %+v, want only a reference into %s", public, DefaultCollection)
+	}
+	if stub.private[DefaultCollection]["g_PARAM_u1_0"] == nil {
+		t.Fatal("the params are missing from the private data collection")
+	}
+
+	var private *ModelParam
+	stub.caller = "u1"
+	err = stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		private, err = new(SmartContract).GetPrivateParam(ctx, "g_PARAM_u1_0")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := private.Params["fc.bias"].([]interface{})[0]; got != 1.0 {
+		t.Fatalf("private bias = %v, want 1", got)
+	}
+
+	stub.caller = "owner"
+	err = stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return new(SmartContract).FinalizeRound(ctx, "g", "0")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var aggregated ModelParam
+	stub.get(t, "g_AGGREPARAM_0", &aggregated)
+	if got := aggregated.Params["fc.bias"].([]interface{})[0]; got != 2.0 {
+		t.Fatalf("aggregated bias = %v, want 2", got)
+	}
+}
+
+func TestLoadPrivateChecksHash(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"storage": "private", "policy": {"mode": "finalize"}}`, "u1")
+	if err := uploadPrivate(stub, "u1", map[string][]byte{TransientParams: []byte(uploadParams(1))}); err != nil {
+		t.Fatal(err)
+	}
+
+	stub.private[DefaultCollection]["g_PARAM_u1_0"] = []byte(`{"params": {"fc.bias": [100]}}`)
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := new(SmartContract).GetPrivateParam(ctx, "g_PARAM_u1_0")
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "published hash") {
+		t.Fatalf("GetPrivateParam() of altered params = %v, want a hash error", err)
+	}
+
+	delete(stub.private[DefaultCollection], "g_PARAM_u1_0")
+	err = stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := new(SmartContract).GetPrivateParam(ctx, "g_PARAM_u1_0")
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "not available on this peer") {
+		t.Fatalf("GetPrivateParam() without the private data = %v, want a not available error", err)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Round states, a round goes open -> aggregating -> closed and closing a round opens the next one.
+// A round that expires without enough uploads goes open -> failed and has to be restarted
+const (
+	RoundStatusOpen        = "open"
+	RoundStatusAggregating = "aggregating"
+	RoundStatusClosed      = "closed"
+	RoundStatusFailed      = "failed"
+)
+
+// RoundStatus tracks the lifecycle of a round of a group, the key is "groupname_ROUND_roundID"
+type RoundStatus struct {
+	RoundID  string   `json:"roundID"`
+	Status   string   `json:"status"`
+	Uploaded []string `json:"uploaded"`
+	// Deadline is the unix time in seconds after which the round expires, 0 means no deadline
+	Deadline int64 `json:"deadline,omitempty" metadata:",optional"`
+	// Attempt counts how often the round was restarted after failing
+	Attempt int `json:"attempt,omitempty" metadata:",optional"`
+}
+
+// GetRoundStatus returns the state of a round and the users that uploaded params for it, to the owner and the members it added
+func (s *SmartContract) GetRoundStatus(ctx contractapi.TransactionContextInterface, groupname string, roundID string) (*RoundStatus, error) {
+	err := checkGroupRead(ctx, groupname, groupname+"_ROUND_"+roundID)
+	if err != nil {
+		return nil, err
+	}
+	round, err := getRoundStatus(ctx, groupname, roundID)
+	if err != nil {
+		return nil, err
+	}
+	if round == nil {
+		return nil, codedError(CodeRoundClosed, "round %s of group %s is not open yet", roundID, groupname)
+	}
+	return round, nil
+}
+
+// CloseExpiredRound ends an open round after its deadline. The round is aggregated with the uploads
+// that arrived if the minimum count of the group policy is met, otherwise it fails. The owner and the active members may close it
+func (s *SmartContract) CloseExpiredRound(ctx contractapi.TransactionContextInterface, groupname string, roundID string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkParticipant(ctx, group, groupname)
+	if err != nil {
+		return err
+	}
+
+	round, err := getRoundStatus(ctx, groupname, roundID)
+	if err != nil {
+		return err
+	}
+	err = checkRoundOpen(round, groupname, roundID)
+	if err != nil {
+		return err
+	}
+	expired, err := roundExpired(ctx, round)
+	if err != nil {
+		return err
+	}
+	if !expired {
+		return fmt.Errorf("round %s of group %s has not reached its deadline", roundID, groupname)
+	}
+	return s.expireRound(ctx, groupname, group, round, nil)
+}
+
+// RestartRound reopens a failed round with a new deadline, the uploads of the failed attempt are dropped.
+// Only the group owner restarts rounds
+func (s *SmartContract) RestartRound(ctx contractapi.TransactionContextInterface, groupname string, roundID string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkAdmin(ctx, group, groupname)
+	if err != nil {
+		return err
+	}
+
+	round, err := getRoundStatus(ctx, groupname, roundID)
+	if err != nil {
+		return err
+	}
+	if round == nil || round.Status != RoundStatusFailed {
+		return fmt.Errorf("round %s of group %s has not failed", roundID, groupname)
+	}
+
+	for _, userID := range round.Uploaded {
+		key := groupname + "_PARAM_" + userID + "_" + roundID
+		param, err := getStoredParam(ctx, key)
+		if err != nil {
+			return err
+		}
+		if param != nil && param.Upload != nil {
+			err = deleteChunks(ctx, groupname, param.Upload.UploadID, param.Upload.Chunks)
+			if err != nil {
+				return err
+			}
+		}
+		if param != nil && param.Private != nil {
+			err = ctx.GetStub().DelPrivateData(param.Private.Collection, key)
+			if err != nil {
+				return err
+			}
+		}
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return err
+		}
+	}
+	err = openRound(ctx, groupname, group, roundID, round.Attempt+1)
+	if err != nil {
+		return err
+	}
+	return putGroup(ctx, groupname, group)
+}
+
+// getRoundStatus reads the state of a round, it returns nil if the round was never opened
+func getRoundStatus(ctx contractapi.TransactionContextInterface, groupname string, roundID string) (*RoundStatus, error) {
+	data, err := ctx.GetStub().GetState(groupname + "_ROUND_" + roundID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the round: %s", err.Error())
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var round RoundStatus
+	err = json.Unmarshal(data, &round)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal round: %s", err.Error())
+	}
+	return &round, nil
+}
+
+func putRoundStatus(ctx contractapi.TransactionContextInterface, groupname string, round *RoundStatus) error {
+	data, err := json.Marshal(round)
+	if err != nil {
+		return fmt.Errorf("failed to marshal round: %s", err.Error())
+	}
+	err = ctx.GetStub().PutState(groupname+"_ROUND_"+round.RoundID, data)
+	if err != nil {
+		return fmt.Errorf("failed to update round state: %s", err.Error())
+	}
+	return nil
+}
+
+// openRound opens a round of the group and makes it the current round, the caller stores the group.
+// The deadline is counted from the timestamp of the transaction so every endorser agrees on it
+func openRound(ctx contractapi.TransactionContextInterface, groupname string, group *Group, roundID string, attempt int) error {
+	round := &RoundStatus{
+		RoundID:  roundID,
+		Status:   RoundStatusOpen,
+		Uploaded: []string{},
+		Attempt:  attempt,
+	}
+	if timeout := group.Config.Policy.RoundTimeoutSeconds; timeout > 0 {
+		now, err := txTime(ctx)
+		if err != nil {
+			return err
+		}
+		round.Deadline = now + timeout
+	}
+	group.CurrentRound = roundID
+	err := openSecAggRound(ctx, groupname, group, roundID)
+	if err != nil {
+		return err
+	}
+	return putRoundStatus(ctx, groupname, round)
+}
+
+// roundExpired tells whether the deadline of the round passed at the time of the transaction
+func roundExpired(ctx contractapi.TransactionContextInterface, round *RoundStatus) (bool, error) {
+	if round.Deadline == 0 {
+		return false, nil
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return false, err
+	}
+	return now >= round.Deadline, nil
+}
+
+// txTime returns the timestamp of the transaction in unix seconds
+func txTime(ctx contractapi.TransactionContextInterface) (int64, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the transaction timestamp: %s", err.Error())
+	}
+	return timestamp.GetSeconds(), nil
+}
+
+// checkRoundOpen fails unless the round accepts uploads
+func checkRoundOpen(round *RoundStatus, groupname string, roundID string) error {
+	if round == nil {
+		return codedError(CodeRoundClosed, "round %s of group %s is not open yet", roundID, groupname)
+	}
+	switch round.Status {
+	case RoundStatusOpen:
+		return nil
+	case RoundStatusAggregating:
+		return codedError(CodeRoundClosed, "round %s of group %s is being aggregated", roundID, groupname)
+	case RoundStatusFailed:
+		return codedError(CodeRoundClosed, "round %s of group %s failed and has to be restarted", roundID, groupname)
+	default:
+		return codedError(CodeRoundClosed, "round %s of group %s is closed", roundID, groupname)
+	}
+}
+
+// closeRound aggregates an open round, closes it and opens the next round. pending is the upload
+// that closes the round, it is nil when the round is closed by a call without an upload
+func (s *SmartContract) closeRound(ctx contractapi.TransactionContextInterface, groupname string, group *Group, round *RoundStatus, pending *ModelParam) error {
+	if _, err := strconv.Atoi(round.RoundID); err != nil {
+		return fmt.Errorf("round ids must be numbers, got %s", round.RoundID)
+	}
+
+	round.Status = RoundStatusAggregating
+	err := putRoundStatus(ctx, groupname, round)
+	if err != nil {
+		return err
+	}
+	err = emitRoundEvent(ctx, EventQuorumReached, groupname, round)
+	if err != nil {
+		return err
+	}
+	// masked params are aggregated once the survivors reveal their shares, SubmitSecAggReveal closes the round
+	if group.Config.SecAgg.Enabled {
+		return beginUnmask(ctx, groupname, group, round)
+	}
+	// params kept off chain are aggregated by the aggregator, it closes the round with SubmitAggregate
+	if group.Config.offChain() {
+		return nil
+	}
+	err = s.aggregateParams(ctx, groupname, group, round.RoundID, pending)
+	if err != nil {
+		return err
+	}
+	return finishRound(ctx, groupname, group, round)
+}
+
+// expireRound ends an expired round, aggregating the uploads that arrived if the minimum count is met
+func (s *SmartContract) expireRound(ctx contractapi.TransactionContextInterface, groupname string, group *Group, round *RoundStatus, pending *ModelParam) error {
+	policy := group.Config.Policy
+	policy.setDefaults()
+	required := policy.MinCount
+	if minUploads := group.Config.Aggregation.minUploads(); minUploads > required {
+		required = minUploads
+	}
+	if group.countActive(round.Uploaded) >= required {
+		return s.closeRound(ctx, groupname, group, round, pending)
+	}
+	return failRound(ctx, groupname, round)
+}
+
+// failRound marks the round failed, it has to be restarted
+func failRound(ctx contractapi.TransactionContextInterface, groupname string, round *RoundStatus) error {
+	round.Status = RoundStatusFailed
+	err := putRoundStatus(ctx, groupname, round)
+	if err != nil {
+		return err
+	}
+	return emitRoundEvent(ctx, EventRoundFailed, groupname, round)
+}
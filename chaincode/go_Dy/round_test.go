@@ -0,0 +1,251 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestRoundLifecycle(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"minCount": 2, "minFraction": 0.1}}`, "u1", "u2", "u3")
+
+	if round := roundStatus(t, stub, "g", "0"); round.Status != RoundStatusOpen || len(round.Uploaded) != 0 {
+		t.Fatalf("round 0 = %+v, want an open round without uploads", round)
+	}
+	err := upload(stub, "g", "1", "u1", 1)
+	if err == nil || !strings.Contains(err.Error(), "not open yet") {
+		t.Fatalf("upload to round 1 = %v, want a not open error", err)
+	}
+
+	if err := upload(stub, "g", "0", "u1", 1); err != nil {
+		t.Fatal(err)
+	}
+	// uploading again replaces the params without counting the user twice
+	if err := upload(stub, "g", "0", "u1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if round := roundStatus(t, stub, "g", "0"); round.Status != RoundStatusOpen || len(round.Uploaded) != 1 {
+		t.Fatalf("round 0 = %+v, want an open round with one upload", round)
+	}
+
+	if err := upload(stub, "g", "0", "u2", 3); err != nil {
+		t.Fatal(err)
+	}
+	if round := roundStatus(t, stub, "g", "0"); round.Status != RoundStatusClosed {
+		t.Fatalf("round 0 = %+v, want it closed once the quorum uploaded", round)
+	}
+	if round := roundStatus(t, stub, "g", "1"); round.Status != RoundStatusOpen {
+		t.Fatalf("round 1 = %+v, want it opened by closing round 0", round)
+	}
+	var group Group
+	stub.get(t, "g", &group)
+	if group.CurrentRound != "1" {
+		t.Fatalf("current round = %s, want 1", group.CurrentRound)
+	}
+	if stub.state["g_AGGREPARAM_0"] == nil {
+		t.Fatal("closing round 0 did not store the aggregated params")
+	}
+
+	err = upload(stub, "g", "0", "u3", 1)
+	if err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Fatalf("late upload = %v, want a round closed error", err)
+	}
+}
+
+func TestGetRoundStatus(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"mode": "finalize"}}`, "u1")
+	if err := upload(stub, "g", "0", "u1", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	s := new(SmartContract)
+	var round *RoundStatus
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		round, err = s.GetRoundStatus(ctx, "g", "0")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if round.Status != RoundStatusOpen || len(round.Uploaded) != 1 || round.Uploaded[0] != "u1" {
+		t.Fatalf("GetRoundStatus() = %+v, want round 0 open with u1", round)
+	}
+
+	err = stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		_, err := s.GetRoundStatus(ctx, "g", "5")
+		return err
+	})
+	if err == nil {
+		t.Fatal("GetRoundStatus() of an unopened round = nil, want an error")
+	}
+}
+
+func TestRoundDeadline(t *testing.T) {
+	stub := newMockStub()
+	stub.now = 1000
+	setupGroup(t, stub, "g", `{"policy": {"minCount": 2, "minFraction": 1, "roundTimeoutSeconds": 60}}`, "u1", "u2", "u3")
+	if round := roundStatus(t, stub, "g", "0"); round.Deadline != 1060 {
+		t.Fatalf("round 0 deadline = %d, want 1060", round.Deadline)
+	}
+	s := new(SmartContract)
+	closeExpired := func(caller string) error {
+		stub.caller = caller
+		return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return s.CloseExpiredRound(ctx, "g", "0")
+		})
+	}
+	restart := func(caller string) error {
+		stub.caller = caller
+		return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return s.RestartRound(ctx, "g", "0")
+		})
+	}
+
+	stub.now = 1010
+	if err := upload(stub, "g", "0", "u1", 1); err != nil {
+		t.Fatal(err)
+	}
+	err := closeExpired("u2")
+	if err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Fatalf("CloseExpiredRound() before the deadline = %v, want a deadline error", err)
+	}
+	err = restart("owner")
+	if err == nil || !strings.Contains(err.Error(), "has not failed") {
+		t.Fatalf("RestartRound() of an open round = %v, want a not failed error", err)
+	}
+
+	// one upload is below the minimum count, the round fails
+	stub.now = 1070
+	err = closeExpired("outsider")
+	if err == nil || !strings.Contains(err.Error(), "neither the owner nor an active member") {
+		t.Fatalf("CloseExpiredRound() by an outsider = %v, want an access error", err)
+	}
+	if err := closeExpired("u2"); err != nil {
+		t.Fatal(err)
+	}
+	if round := roundStatus(t, stub, "g", "0"); round.Status != RoundStatusFailed {
+		t.Fatalf("round 0 = %+v, want it failed", round)
+	}
+	err = upload(stub, "g", "0", "u2", 1)
+	if err == nil || !strings.Contains(err.Error(), "restarted") {
+		t.Fatalf("upload to a failed round = %v, want a restart error", err)
+	}
+
+	stub.now = 1100
+	err = restart("u1")
+	if err == nil || !strings.Contains(err.Error(), "not the owner") {
+		t.Fatalf("RestartRound() by a member = %v, want a not the owner error", err)
+	}
+	if err := restart("owner"); err != nil {
+		t.Fatal(err)
+	}
+	round := roundStatus(t, stub, "g", "0")
+	if round.Status != RoundStatusOpen || round.Attempt != 1 || round.Deadline != 1160 || len(round.Uploaded) != 0 {
+		t.Fatalf("restarted round 0 = %+v, want attempt 1 open until 1160 without uploads", round)
+	}
+	if stub.state["g_PARAM_u1_0"] != nil {
+		t.Fatal("RestartRound() kept the params of the failed attempt")
+	}
+
+	// two uploads meet the minimum count, the expired round is aggregated
+	for _, user := range []string{"u1", "u2"} {
+		if err := upload(stub, "g", "0", user, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stub.now = 1200
+	if err := closeExpired("owner"); err != nil {
+		t.Fatal(err)
+	}
+	if round := roundStatus(t, stub, "g", "0"); round.Status != RoundStatusClosed {
+		t.Fatalf("round 0 = %+v, want it closed", round)
+	}
+	if round := roundStatus(t, stub, "g", "1"); round.Status != RoundStatusOpen || round.Deadline != 1260 {
+		t.Fatalf("round 1 = %+v, want it open until 1260", round)
+	}
+}
+
+func TestUploadAfterDeadline(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"minCount": 2, "minFraction": 1, "roundTimeoutSeconds": 60}}`, "u1", "u2", "u3")
+	if err := upload(stub, "g", "0", "u1", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first upload after the deadline ends the round
+	stub.now = 100
+	if err := upload(stub, "g", "0", "u2", 1); err != nil {
+		t.Fatal(err)
+	}
+	if round := roundStatus(t, stub, "g", "0"); round.Status != RoundStatusClosed || len(round.Uploaded) != 2 {
+		t.Fatalf("round 0 = %+v, want it closed with two uploads", round)
+	}
+}
+
+// the upload that closes a round is written in the same transaction as the aggregate, it has to be part of it
+func TestLastUploadClosesRound(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		users    []string
+		values   []float64
+		upload   func(stub *mockStub, userID string, value float64) error
+		wantBias float64
+	}{
+		{"single user", `{}`, []string{"u1"}, []float64{2}, nil, 2},
+		{"fedavg", `{"policy": {"minFraction": 1}}`, []string{"u1", "u2"}, []float64{1, 3}, nil, 2},
+		{"krum at the minimum uploads", `{"policy": {"minFraction": 1}, "aggregation": {"rule": "multikrum", "byzantineCount": 1, "krumSelect": 5}}`,
+			[]string{"u1", "u2", "u3", "u4", "u5"}, []float64{1, 1, 1, 1, 6}, nil, 2},
+		{"private data", `{"storage": "private", "policy": {"minFraction": 1}}`, []string{"u1", "u2"}, []float64{1, 3},
+			func(stub *mockStub, userID string, value float64) error {
+				return uploadPrivate(stub, userID, map[string][]byte{TransientParams: []byte(uploadParams(value))})
+			}, 2},
+		{"chunked", `{"policy": {"minFraction": 1}}`, []string{"u1", "u2"}, []float64{1, 3},
+			func(stub *mockStub, userID string, value float64) error {
+				u := chunkedUpload{t, stub, userID}
+				params := uploadParams(value)
+				if err := u.begin(); err != nil {
+					return err
+				}
+				if err := u.chunk(0, params); err != nil {
+					return err
+				}
+				return u.commit(params)
+			}, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := newMockStub()
+			setupGroup(t, stub, "g", test.config, test.users...)
+			for i, user := range test.users {
+				var err error
+				if test.upload != nil {
+					err = test.upload(stub, user, test.values[i])
+				} else {
+					err = upload(stub, "g", "0", user, test.values[i])
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if round := roundStatus(t, stub, "g", "0"); round.Status != RoundStatusClosed {
+				t.Fatalf("round 0 = %+v, want it closed by the last upload", round)
+			}
+			var aggregated ModelParam
+			stub.get(t, "g_AGGREPARAM_0", &aggregated)
+			if got := aggregated.Params["fc.bias"].([]interface{})[0]; got != test.wantBias {
+				t.Fatalf("aggregated bias = %v, want %v", got, test.wantBias)
+			}
+			var report AggregationReport
+			stub.get(t, "g_AGGREREPORT_0", &report)
+			last := test.users[len(test.users)-1]
+			if !contains(report.Selected, last) {
+				t.Fatalf("report selected %v, want the last upload of %s", report.Selected, last)
+			}
+		})
+	}
+}
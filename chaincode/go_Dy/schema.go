@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"Capstone_go/tensor"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// TensorSpec is the name and shape of a layer of the group model
+type TensorSpec struct {
+	Name  string `json:"name"`
+	Shape []int  `json:"shape"`
+}
+
+// ModelSchema lists the layers every upload of a group has to contain, it is kept at "groupname_SCHEMA"
+type ModelSchema struct {
+	Tensors []TensorSpec `json:"tensors"`
+}
+
+func (m *ModelSchema) validate() error {
+	if len(m.Tensors) == 0 {
+		return fmt.Errorf("the model schema has no tensors")
+	}
+	names := make(map[string]bool)
+	for _, spec := range m.Tensors {
+		if spec.Name == "" {
+			return fmt.Errorf("the model schema has a tensor without a name")
+		}
+		if names[spec.Name] {
+			return fmt.Errorf("the model schema has tensor %s twice", spec.Name)
+		}
+		names[spec.Name] = true
+		for _, dim := range spec.Shape {
+			if dim <= 0 {
+				return fmt.Errorf("tensor %s has the invalid shape %v", spec.Name, spec.Shape)
+			}
+		}
+	}
+	return nil
+}
+
+// RegisterModelSchema lets the group owner register the tensor names and shapes of the group model, schemaJson is a JSON encoded ModelSchema.
+// Later uploads with missing or extra tensors or other shapes are rejected
+func (s *SmartContract) RegisterModelSchema(ctx contractapi.TransactionContextInterface, groupname string, schemaJson string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkAdmin(ctx, group, groupname)
+	if err != nil {
+		return err
+	}
+
+	var schema ModelSchema
+	err = json.Unmarshal([]byte(schemaJson), &schema)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal model schema: %s", err.Error())
+	}
+	err = schema.validate()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(groupname+"_SCHEMA", data)
+}
+
+// GetModelSchema returns the model schema registered for a group
+func (s *SmartContract) GetModelSchema(ctx contractapi.TransactionContextInterface, groupname string) (*ModelSchema, error) {
+	schema, err := getModelSchema(ctx, groupname)
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		return nil, codedError(CodeNotFound, "group %s has no model schema", groupname)
+	}
+	return schema, nil
+}
+
+func getModelSchema(ctx contractapi.TransactionContextInterface, groupname string) (*ModelSchema, error) {
+	data, err := ctx.GetStub().GetState(groupname + "_SCHEMA")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the model schema: %s", err.Error())
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var schema ModelSchema
+	err = json.Unmarshal(data, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal model schema: %s", err.Error())
+	}
+	return &schema, nil
+}
+
+// checkUpload validates the params of an upload, they have to be finite numbers and match the model schema if the group has one.
+// Chunked params have to be reassembled and params kept off chain can not be checked
+func checkUpload(ctx contractapi.TransactionContextInterface, groupname string, param *ModelParam) error {
+	schema, err := getModelSchema(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	if param.Tensors != "" {
+		tensors, err := param.decodeTensors()
+		if err != nil {
+			return err
+		}
+		return checkTensors(schema, tensors)
+	}
+	return checkParams(schema, param.Params)
+}
+
+// checkParams validates JSON params
+func checkParams(schema *ModelSchema, params map[string]interface{}) error {
+	if len(params) == 0 {
+		return fmt.Errorf("the upload has no tensors")
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if schema == nil {
+		for _, name := range names {
+			err := checkNumeric(name, params[name], "")
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, name := range names {
+		if !schema.has(name) {
+			return fmt.Errorf("unexpected tensor %s", name)
+		}
+	}
+	for _, spec := range schema.Tensors {
+		value, exists := params[spec.Name]
+		if !exists {
+			return fmt.Errorf("missing tensor %s", spec.Name)
+		}
+		err := checkShape(spec, value, spec.Shape, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTensors validates the tensors of a container
+func checkTensors(schema *ModelSchema, tensors []tensor.Tensor) error {
+	if len(tensors) == 0 {
+		return fmt.Errorf("the upload has no tensors")
+	}
+	byName := make(map[string]*tensor.Tensor, len(tensors))
+	for i := range tensors {
+		if _, exists := byName[tensors[i].Name]; exists {
+			return fmt.Errorf("tensor %s appears twice", tensors[i].Name)
+		}
+		byName[tensors[i].Name] = &tensors[i]
+	}
+	for _, t := range tensors {
+		for i, value := range t.Data {
+			if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) {
+				return fmt.Errorf("tensor %s has the value %v at flat index %d", t.Name, value, i)
+			}
+		}
+	}
+	if schema == nil {
+		return nil
+	}
+
+	for _, t := range tensors {
+		if !schema.has(t.Name) {
+			return fmt.Errorf("unexpected tensor %s", t.Name)
+		}
+	}
+	for _, spec := range schema.Tensors {
+		t, exists := byName[spec.Name]
+		if !exists {
+			return fmt.Errorf("missing tensor %s", spec.Name)
+		}
+		if !sameShape(t.Shape, spec.Shape) {
+			return fmt.Errorf("tensor %s has shape %v, expected %v", spec.Name, t.Shape, spec.Shape)
+		}
+	}
+	return nil
+}
+
+func (m *ModelSchema) has(name string) bool {
+	for _, spec := range m.Tensors {
+		if spec.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkShape walks the nested lists of a tensor, index is the position of value in the tensor
+func checkShape(spec TensorSpec, value interface{}, shape []int, index string) error {
+	if len(shape) == 0 {
+		return checkNumber(spec.Name, value, index)
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("tensor %s has %s, expected a list of %d values for shape %v", spec.Name, describe(value, index), shape[0], spec.Shape)
+	}
+	if len(list) != shape[0] {
+		return fmt.Errorf("tensor %s has %d values%s, expected %d for shape %v", spec.Name, len(list), at(index), shape[0], spec.Shape)
+	}
+	for i, item := range list {
+		err := checkShape(spec, item, shape[1:], fmt.Sprintf("%s[%d]", index, i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNumeric checks that every value of a tensor without a schema is a finite number
+func checkNumeric(name string, value interface{}, index string) error {
+	list, ok := value.([]interface{})
+	if !ok {
+		return checkNumber(name, value, index)
+	}
+	for i, item := range list {
+		err := checkNumeric(name, item, fmt.Sprintf("%s[%d]", index, i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkNumber(name string, value interface{}, index string) error {
+	number, ok := value.(float64)
+	if !ok {
+		return fmt.Errorf("tensor %s has %s, expected a number", name, describe(value, index))
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return fmt.Errorf("tensor %s has the value %v%s", name, number, at(index))
+	}
+	return nil
+}
+
+func describe(value interface{}, index string) string {
+	switch value.(type) {
+	case []interface{}:
+		return "a list" + at(index)
+	case nil:
+		return "null" + at(index)
+	case float64:
+		return "a number" + at(index)
+	default:
+		return fmt.Sprintf("a %T value%s", value, at(index))
+	}
+}
+
+func at(index string) string {
+	if index == "" {
+		return ""
+	}
+	return " at " + index
+}
+
+func sameShape(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
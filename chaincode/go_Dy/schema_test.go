@@ -0,0 +1,152 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"Capstone_go/tensor"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+var testSchema = &ModelSchema{Tensors: []TensorSpec{
+	{Name: "fc.weight", Shape: []int{1, 2}},
+	{Name: "fc.bias", Shape: []int{1}},
+}}
+
+func TestCheckParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  *ModelSchema
+		params  map[string]interface{}
+		wantErr string
+	}{
+		{"matches the schema", testSchema, map[string]interface{}{
+			"fc.weight": []interface{}{[]interface{}{1.0, 2.0}},
+			"fc.bias":   []interface{}{1.0},
+		}, ""},
+		{"missing tensor", testSchema, map[string]interface{}{
+			"fc.weight": []interface{}{[]interface{}{1.0, 2.0}},
+		}, "missing tensor fc.bias"},
+		{"extra tensor", testSchema, map[string]interface{}{
+			"fc.weight": []interface{}{[]interface{}{1.0, 2.0}},
+			"fc.bias":   []interface{}{1.0},
+			"fc2.bias":  []interface{}{1.0},
+		}, "unexpected tensor fc2.bias"},
+		{"wrong length", testSchema, map[string]interface{}{
+			"fc.weight": []interface{}{[]interface{}{1.0, 2.0, 3.0}},
+			"fc.bias":   []interface{}{1.0},
+		}, "has 3 values at [0], expected 2"},
+		{"number instead of a list", testSchema, map[string]interface{}{
+			"fc.weight": []interface{}{1.0},
+			"fc.bias":   []interface{}{1.0},
+		}, "has a number at [0], expected a list"},
+		{"string value", testSchema, map[string]interface{}{
+			"fc.weight": []interface{}{[]interface{}{1.0, "2"}},
+			"fc.bias":   []interface{}{1.0},
+		}, "has a string value at [0][1], expected a number"},
+		{"no schema accepts any shape", nil, map[string]interface{}{
+			"w": []interface{}{[]interface{}{1.0}, 2.0},
+		}, ""},
+		{"no schema rejects nulls", nil, map[string]interface{}{
+			"w": []interface{}{1.0, nil},
+		}, "has null at [1]"},
+		{"no tensors", nil, map[string]interface{}{}, "no tensors"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkParams(test.schema, test.params)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("checkParams() = %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckTensors(t *testing.T) {
+	weight := tensor.Tensor{Name: "fc.weight", Shape: []int{1, 2}, Data: []float32{1, 2}}
+	bias := tensor.Tensor{Name: "fc.bias", Shape: []int{1}, Data: []float32{1}}
+	tests := []struct {
+		name    string
+		schema  *ModelSchema
+		tensors []tensor.Tensor
+		wantErr string
+	}{
+		{"matches the schema", testSchema, []tensor.Tensor{weight, bias}, ""},
+		{"wrong shape", testSchema, []tensor.Tensor{{Name: "fc.weight", Shape: []int{2}, Data: []float32{1, 2}}, bias}, "has shape [2], expected [1 2]"},
+		{"missing tensor", testSchema, []tensor.Tensor{weight}, "missing tensor fc.bias"},
+		{"duplicate tensor", nil, []tensor.Tensor{bias, bias}, "appears twice"},
+		{"not finite", nil, []tensor.Tensor{{Name: "w", Shape: []int{1}, Data: []float32{float32(math.Inf(1))}}}, "+Inf"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkTensors(test.schema, test.tensors)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("checkTensors() = %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestModelSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  ModelSchema
+		wantErr bool
+	}{
+		{"valid", *testSchema, false},
+		{"empty", ModelSchema{}, true},
+		{"no name", ModelSchema{Tensors: []TensorSpec{{Shape: []int{1}}}}, true},
+		{"duplicate name", ModelSchema{Tensors: []TensorSpec{{Name: "w"}, {Name: "w"}}}, true},
+		{"zero dimension", ModelSchema{Tensors: []TensorSpec{{Name: "w", Shape: []int{2, 0}}}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.schema.validate()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("validate() = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisterModelSchema(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"mode": "finalize"}}`, "u1")
+	register := func(caller string) error {
+		stub.caller = caller
+		return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return new(SmartContract).RegisterModelSchema(ctx, "g", `{"tensors": [{"name": "fc.weight", "shape": [1, 2]}, {"name": "fc.bias", "shape": [1]}]}`)
+		})
+	}
+
+	if err := register("u1"); err == nil || !strings.Contains(err.Error(), "not the owner") {
+		t.Fatalf("RegisterModelSchema() by a user = %v, want a not owner error", err)
+	}
+	if err := register("owner"); err != nil {
+		t.Fatal(err)
+	}
+
+	stub.caller = "u1"
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return new(SmartContract).UploadModelParam(ctx, "g", "0", "u1", `{"fc.weight": [[1, 2]]}`, 10, 1)
+	})
+	if err == nil || !strings.Contains(err.Error(), "missing tensor fc.bias") {
+		t.Fatalf("upload without fc.bias = %v, want a missing tensor error", err)
+	}
+	if err := upload(stub, "g", "0", "u1", 1); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,780 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"Capstone_go/secagg"
+	"Capstone_go/tensor"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Phases of a secure aggregation round
+const (
+	// SecAggPhaseKeys collects the public keys of the participants
+	SecAggPhaseKeys = "keys"
+	// SecAggPhaseShares collects the encrypted shares every participant sends to the others
+	SecAggPhaseShares = "shares"
+	// SecAggPhaseMasked collects the masked uploads
+	SecAggPhaseMasked = "masked"
+	// SecAggPhaseUnmask collects the shares the survivors reveal to remove the masks
+	SecAggPhaseUnmask = "unmask"
+	// SecAggPhaseDone means the sum was unmasked and aggregated
+	SecAggPhaseDone = "done"
+)
+
+// SecAggConfig turns on secure aggregation, the chaincode then only learns the sum of the uploads.
+// Threshold is the number of survivors needed to unmask, at least a majority of the participants
+type SecAggConfig struct {
+	Enabled   bool `json:"enabled"`
+	Threshold int  `json:"threshold,omitempty" metadata:",optional"`
+}
+
+func (c *GroupConfig) validateSecAgg() error {
+	if !c.SecAgg.Enabled {
+		return nil
+	}
+	if c.SecAgg.Threshold < 0 {
+		return fmt.Errorf("the secure aggregation threshold must not be negative, got %d", c.SecAgg.Threshold)
+	}
+	if c.Aggregation.Rule != AggregationFedAvg {
+		return fmt.Errorf("secure aggregation only supports the %s rule, got %s", AggregationFedAvg, c.Aggregation.Rule)
+	}
+	if c.Optimizer.Name != OptimizerNone {
+		return fmt.Errorf("secure aggregation does not support the server optimizer %s", c.Optimizer.Name)
+	}
+	if c.Storage != StorageOnChain {
+		return fmt.Errorf("secure aggregation needs the params on chain, got the %s storage", c.Storage)
+	}
+	if c.Collection == "" {
+		c.Collection = DefaultCollection
+	}
+	return nil
+}
+
+// threshold is the number of survivors needed to unmask a round with the given number of participants
+func (c *SecAggConfig) threshold(participants int) int {
+	threshold := participants/2 + 1
+	if c.Threshold > threshold {
+		threshold = c.Threshold
+	}
+	if threshold < 2 {
+		threshold = 2
+	}
+	return threshold
+}
+
+// SecAggRound is the state of secure aggregation in a round, it is kept at "groupname_SECAGG_roundID".
+// Participants sent their keys, Sharers sent their shares and Survivors uploaded masked params
+type SecAggRound struct {
+	RoundID      string   `json:"roundID"`
+	Phase        string   `json:"phase"`
+	Threshold    int      `json:"threshold"`
+	Keyed        []string `json:"keyed"`
+	Participants []string `json:"participants"`
+	Shared       []string `json:"shared"`
+	Sharers      []string `json:"sharers"`
+	Survivors    []string `json:"survivors"`
+	Revealed     []string `json:"revealed"`
+}
+
+// SecAggKeys are the base64 encoded X25519 public keys of a participant
+type SecAggKeys struct {
+	UserID   string `json:"userID"`
+	ShareKey string `json:"shareKey"`
+	MaskKey  string `json:"maskKey"`
+}
+
+// SecAggShares are the shares a participant encrypted for every participant, itself included, by receiver.
+// SelfSeedHash is the hex encoded SHA-256 of its self-mask seed, it checks the recovered seed
+type SecAggShares struct {
+	Shares       map[string]string `json:"shares"`
+	SelfSeedHash string            `json:"selfSeedHash"`
+}
+
+// SecAggEncryptedShare is a share addressed to a participant
+type SecAggEncryptedShare struct {
+	From       string `json:"from"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// TransientReveal is the transient key of the JSON encoded SecAggReveal of SubmitSecAggReveal,
+// the revealed shares travel as transient data and are kept in the private data collection of the group
+const TransientReveal = "reveal"
+
+// SecAggReveal holds the decrypted shares a survivor reveals, the self-mask seed shares of the survivors
+// and the mask key shares of the sharers that dropped out, by owner
+type SecAggReveal struct {
+	SelfSeeds map[string]secagg.Share `json:"selfSeeds"`
+	MaskKeys  map[string]secagg.Share `json:"maskKeys"`
+}
+
+// SubmitSecAggKeys records the share and mask public keys of a user, the key phase ends when every active user sent its keys
+func (s *SmartContract) SubmitSecAggKeys(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, shareKey string, maskKey string) error {
+	group, state, err := prepareSecAgg(ctx, groupname, roundID, userID, SecAggPhaseKeys)
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{shareKey, maskKey} {
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(raw) != 32 {
+			return fmt.Errorf("the public keys must be base64 encoded 32 byte X25519 keys")
+		}
+	}
+
+	keys := SecAggKeys{UserID: userID, ShareKey: shareKey, MaskKey: maskKey}
+	err = putSecAggValue(ctx, groupname, "KEYS", roundID, userID, keys)
+	if err != nil {
+		return err
+	}
+	if !contains(state.Keyed, userID) {
+		state.Keyed = append(state.Keyed, userID)
+	}
+	if group.countActive(state.Keyed) == len(group.activeUsers()) {
+		err = closeSecAggKeys(group, state, groupname)
+		if err != nil {
+			return err
+		}
+	}
+	return putSecAggRound(ctx, groupname, state)
+}
+
+// SubmitSecAggShares records the encrypted shares of a user, sharesJson is a JSON encoded SecAggShares.
+// The share phase ends when every participant sent its shares
+func (s *SmartContract) SubmitSecAggShares(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, sharesJson string) error {
+	_, state, err := prepareSecAgg(ctx, groupname, roundID, userID, SecAggPhaseShares)
+	if err != nil {
+		return err
+	}
+	if !contains(state.Participants, userID) {
+		return fmt.Errorf("user %s did not send its keys for round %s of group %s", userID, roundID, groupname)
+	}
+
+	var shares SecAggShares
+	err = json.Unmarshal([]byte(sharesJson), &shares)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal shares: %s", err.Error())
+	}
+	if len(shares.Shares) != len(state.Participants) {
+		return fmt.Errorf("expected shares for the %d participants, got %d", len(state.Participants), len(shares.Shares))
+	}
+	for _, participant := range state.Participants {
+		if _, exists := shares.Shares[participant]; !exists {
+			return fmt.Errorf("the shares for participant %s are missing", participant)
+		}
+	}
+	hash, err := hex.DecodeString(shares.SelfSeedHash)
+	if err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("the self seed hash must be a hex encoded SHA-256")
+	}
+
+	err = putSecAggValue(ctx, groupname, "SHARES", roundID, userID, shares)
+	if err != nil {
+		return err
+	}
+	if !contains(state.Shared, userID) {
+		state.Shared = append(state.Shared, userID)
+	}
+	if len(state.Shared) == len(state.Participants) {
+		err = closeSecAggShares(state, groupname)
+		if err != nil {
+			return err
+		}
+	}
+	return putSecAggRound(ctx, groupname, state)
+}
+
+// AdvanceSecAgg lets the group owner end the key or share phase without the users that did not respond
+func (s *SmartContract) AdvanceSecAgg(ctx contractapi.TransactionContextInterface, groupname string, roundID string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkAdmin(ctx, group, groupname)
+	if err != nil {
+		return err
+	}
+	state, err := getSecAggRound(ctx, groupname, roundID)
+	if err != nil {
+		return err
+	}
+
+	switch state.Phase {
+	case SecAggPhaseKeys:
+		err = closeSecAggKeys(group, state, groupname)
+	case SecAggPhaseShares:
+		err = closeSecAggShares(state, groupname)
+	default:
+		err = fmt.Errorf("round %s of group %s is in the %s phase, only the key and share phases can be ended", roundID, groupname, state.Phase)
+	}
+	if err != nil {
+		return err
+	}
+	return putSecAggRound(ctx, groupname, state)
+}
+
+// UploadMaskedParam records the masked params of a user, maskedJson is a JSON encoded secagg.MaskedVector.
+// The values are the fixed-point params scaled by numSamples plus the self mask and the pairwise masks
+func (s *SmartContract) UploadMaskedParam(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, maskedJson string, numSamples int, localEpochs int) error {
+	group, round, err := prepareUpload(ctx, groupname, roundID, userID, numSamples, localEpochs)
+	if err != nil {
+		return err
+	}
+	state, err := getSecAggRound(ctx, groupname, roundID)
+	if err != nil {
+		return err
+	}
+	if state.Phase != SecAggPhaseMasked {
+		return codedError(CodeRoundClosed, "round %s of group %s is in the %s phase, not accepting masked params", roundID, groupname, state.Phase)
+	}
+	if !contains(state.Sharers, userID) {
+		return fmt.Errorf("user %s did not send its shares for round %s of group %s", userID, roundID, groupname)
+	}
+
+	var masked secagg.MaskedVector
+	err = json.Unmarshal([]byte(maskedJson), &masked)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal masked params: %s", err.Error())
+	}
+	_, err = masked.Unpack()
+	if err != nil {
+		return err
+	}
+	err = checkMaskedLayout(ctx, groupname, masked.Layout)
+	if err != nil {
+		return err
+	}
+
+	param := ModelParam{
+		Masked:      &masked,
+		UserID:      userID,
+		RoundID:     roundID,
+		NumSamples:  numSamples,
+		LocalEpochs: localEpochs,
+	}
+	return s.storeUpload(ctx, groupname, group, round, &param, &param)
+}
+
+// SubmitSecAggReveal records the shares a survivor reveals, passed in the transient data under TransientReveal.
+// They are kept in the private data collection of the group, so only the peers that aggregate see them.
+// Once the threshold of survivors revealed, the masks are removed and the round is aggregated and closed
+func (s *SmartContract) SubmitSecAggReveal(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string) error {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	err = checkMember(ctx, group, groupname, userID)
+	if err != nil {
+		return err
+	}
+	round, err := getRoundStatus(ctx, groupname, roundID)
+	if err != nil {
+		return err
+	}
+	state, err := getSecAggRound(ctx, groupname, roundID)
+	if err != nil {
+		return err
+	}
+	if round == nil || round.Status != RoundStatusAggregating || state.Phase != SecAggPhaseUnmask {
+		return fmt.Errorf("round %s of group %s is not being unmasked", roundID, groupname)
+	}
+	if !contains(state.Survivors, userID) {
+		return fmt.Errorf("user %s did not upload masked params for round %s of group %s", userID, roundID, groupname)
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to get the transient data: %s", err.Error())
+	}
+	revealJSON, exists := transient[TransientReveal]
+	if !exists {
+		return fmt.Errorf("the transient data holds no %s", TransientReveal)
+	}
+	var reveal SecAggReveal
+	err = json.Unmarshal(revealJSON, &reveal)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal revealed shares: %s", err.Error())
+	}
+	// a survivor must never reveal both secrets of a user, that would unmask its params
+	for _, sharer := range state.Sharers {
+		_, seedRevealed := reveal.SelfSeeds[sharer]
+		_, keyRevealed := reveal.MaskKeys[sharer]
+		if contains(state.Survivors, sharer) && (!seedRevealed || keyRevealed) {
+			return fmt.Errorf("the reveal must hold the self seed share and no mask key share of survivor %s", sharer)
+		}
+		if !contains(state.Survivors, sharer) && (seedRevealed || !keyRevealed) {
+			return fmt.Errorf("the reveal must hold the mask key share and no self seed share of dropped user %s", sharer)
+		}
+	}
+	if len(reveal.SelfSeeds)+len(reveal.MaskKeys) != len(state.Sharers) {
+		return fmt.Errorf("the reveal holds shares of users that did not send shares")
+	}
+
+	data, err := json.Marshal(reveal)
+	if err != nil {
+		return fmt.Errorf("failed to marshal revealed shares: %s", err.Error())
+	}
+	err = ctx.GetStub().PutPrivateData(group.Config.Collection, secAggKey(groupname, "REVEAL", roundID, userID), data)
+	if err != nil {
+		return fmt.Errorf("failed to put private data: %s", err.Error())
+	}
+	if !contains(state.Revealed, userID) {
+		state.Revealed = append(state.Revealed, userID)
+	}
+	if len(state.Revealed) < state.Threshold {
+		return putSecAggRound(ctx, groupname, state)
+	}
+
+	// private data written by this transaction cannot be read back, the reveal of the caller is used as is
+	reveals := make([]SecAggReveal, state.Threshold)
+	for i, revealer := range state.Revealed[:state.Threshold] {
+		if revealer == userID {
+			reveals[i] = reveal
+			continue
+		}
+		err = getSecAggReveal(ctx, group, groupname, roundID, revealer, &reveals[i])
+		if err != nil {
+			return err
+		}
+	}
+	err = unmaskRound(ctx, groupname, group, state, reveals)
+	if err != nil {
+		return err
+	}
+	// the shares are of no use once the round is unmasked
+	for _, revealer := range state.Revealed {
+		if revealer == userID {
+			continue
+		}
+		err = ctx.GetStub().DelPrivateData(group.Config.Collection, secAggKey(groupname, "REVEAL", roundID, revealer))
+		if err != nil {
+			return fmt.Errorf("failed to delete private data: %s", err.Error())
+		}
+	}
+	state.Phase = SecAggPhaseDone
+	err = putSecAggRound(ctx, groupname, state)
+	if err != nil {
+		return err
+	}
+	return finishRound(ctx, groupname, group, round)
+}
+
+// GetSecAggRound returns the secure aggregation state of a round
+func (s *SmartContract) GetSecAggRound(ctx contractapi.TransactionContextInterface, groupname string, roundID string) (*SecAggRound, error) {
+	return getSecAggRound(ctx, groupname, roundID)
+}
+
+// GetSecAggKeys returns the public keys the users sent for a round
+func (s *SmartContract) GetSecAggKeys(ctx contractapi.TransactionContextInterface, groupname string, roundID string) ([]SecAggKeys, error) {
+	state, err := getSecAggRound(ctx, groupname, roundID)
+	if err != nil {
+		return nil, err
+	}
+	result := []SecAggKeys{}
+	for _, userID := range state.Keyed {
+		var keys SecAggKeys
+		err = getSecAggValue(ctx, groupname, "KEYS", roundID, userID, &keys)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, keys)
+	}
+	return result, nil
+}
+
+// GetSecAggShares returns the encrypted shares sent to a user in a round
+func (s *SmartContract) GetSecAggShares(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string) ([]SecAggEncryptedShare, error) {
+	state, err := getSecAggRound(ctx, groupname, roundID)
+	if err != nil {
+		return nil, err
+	}
+	result := []SecAggEncryptedShare{}
+	for _, sender := range state.Shared {
+		var shares SecAggShares
+		err = getSecAggValue(ctx, groupname, "SHARES", roundID, sender, &shares)
+		if err != nil {
+			return nil, err
+		}
+		if ciphertext, exists := shares.Shares[userID]; exists {
+			result = append(result, SecAggEncryptedShare{From: sender, Ciphertext: ciphertext})
+		}
+	}
+	return result, nil
+}
+
+// openSecAggRound starts the key phase of a round of a group with secure aggregation
+func openSecAggRound(ctx contractapi.TransactionContextInterface, groupname string, group *Group, roundID string) error {
+	if !group.Config.SecAgg.Enabled {
+		return nil
+	}
+	state := &SecAggRound{
+		RoundID:      roundID,
+		Phase:        SecAggPhaseKeys,
+		Keyed:        []string{},
+		Participants: []string{},
+		Shared:       []string{},
+		Sharers:      []string{},
+		Survivors:    []string{},
+		Revealed:     []string{},
+	}
+	return putSecAggRound(ctx, groupname, state)
+}
+
+// beginUnmask fixes the survivors of a round whose masked uploads reached the quorum, the round fails if they are fewer than the threshold
+func beginUnmask(ctx contractapi.TransactionContextInterface, groupname string, group *Group, round *RoundStatus) error {
+	state, err := getSecAggRound(ctx, groupname, round.RoundID)
+	if err != nil {
+		return err
+	}
+	state.Survivors = []string{}
+	for _, userID := range state.Sharers {
+		if contains(round.Uploaded, userID) && group.isActive(userID) {
+			state.Survivors = append(state.Survivors, userID)
+		}
+	}
+	if len(state.Survivors) < state.Threshold {
+		return failRound(ctx, groupname, round)
+	}
+	state.Phase = SecAggPhaseUnmask
+	return putSecAggRound(ctx, groupname, state)
+}
+
+// secAggReady tells whether enough sharers uploaded masked params to unmask the round
+func secAggReady(ctx contractapi.TransactionContextInterface, groupname string, group *Group, round *RoundStatus) (bool, error) {
+	state, err := getSecAggRound(ctx, groupname, round.RoundID)
+	if err != nil {
+		return false, err
+	}
+	if state.Phase != SecAggPhaseMasked {
+		return false, nil
+	}
+	uploaded := 0
+	for _, userID := range state.Sharers {
+		if contains(round.Uploaded, userID) && group.isActive(userID) {
+			uploaded++
+		}
+	}
+	return uploaded >= state.Threshold, nil
+}
+
+func closeSecAggKeys(group *Group, state *SecAggRound, groupname string) error {
+	participants := []string{}
+	for _, userID := range group.activeUsers() {
+		if contains(state.Keyed, userID) {
+			participants = append(participants, userID)
+		}
+	}
+	threshold := group.Config.SecAgg.threshold(len(participants))
+	if len(participants) < threshold {
+		return fmt.Errorf("round %s of group %s has %d participants, secure aggregation needs %d", state.RoundID, groupname, len(participants), threshold)
+	}
+	state.Participants = participants
+	state.Threshold = threshold
+	state.Phase = SecAggPhaseShares
+	return nil
+}
+
+func closeSecAggShares(state *SecAggRound, groupname string) error {
+	sharers := []string{}
+	for _, userID := range state.Participants {
+		if contains(state.Shared, userID) {
+			sharers = append(sharers, userID)
+		}
+	}
+	if len(sharers) < state.Threshold {
+		return fmt.Errorf("round %s of group %s has %d sharers, secure aggregation needs %d", state.RoundID, groupname, len(sharers), state.Threshold)
+	}
+	state.Sharers = sharers
+	state.Phase = SecAggPhaseMasked
+	return nil
+}
+
+// unmaskRound sums the masked uploads of the survivors, removes their self masks and the pairwise masks
+// they share with dropped users with the reveals of the threshold of survivors, and stores the weighted average
+// as the aggregated params
+func unmaskRound(ctx contractapi.TransactionContextInterface, groupname string, group *Group, state *SecAggRound, reveals []SecAggReveal) error {
+	roundID := state.RoundID
+	maskKeys := make(map[string][]byte)
+	for _, userID := range state.Sharers {
+		var keys SecAggKeys
+		err := getSecAggValue(ctx, groupname, "KEYS", roundID, userID, &keys)
+		if err != nil {
+			return err
+		}
+		maskKeys[userID], _ = base64.StdEncoding.DecodeString(keys.MaskKey)
+	}
+
+	var sum []uint64
+	var layout []secagg.TensorSpec
+	totalSamples := 0
+	for _, userID := range state.Survivors {
+		param, err := getStoredParam(ctx, fmt.Sprintf("%s_PARAM_%s_%s", groupname, userID, roundID))
+		if err != nil {
+			return err
+		}
+		if param == nil || param.Masked == nil {
+			return fmt.Errorf("the masked params of user %s are missing", userID)
+		}
+		values, err := param.Masked.Unpack()
+		if err != nil {
+			return err
+		}
+		if sum == nil {
+			sum = make([]uint64, len(values))
+			layout = param.Masked.Layout
+		}
+		if !sameLayout(layout, param.Masked.Layout) {
+			return fmt.Errorf("the masked params of user %s have another layout", userID)
+		}
+		for i, value := range values {
+			sum[i] += value
+		}
+		totalSamples += sampleWeight(param)
+	}
+
+	for _, userID := range state.Sharers {
+		if contains(state.Survivors, userID) {
+			// the self mask of a survivor is removed with its recovered seed
+			var shares []secagg.Share
+			for _, reveal := range reveals {
+				shares = append(shares, reveal.SelfSeeds[userID])
+			}
+			seed, err := secagg.Combine(shares, 32)
+			if err != nil {
+				return fmt.Errorf("failed to recover the self seed of user %s: %v", userID, err)
+			}
+			var sent SecAggShares
+			err = getSecAggValue(ctx, groupname, "SHARES", roundID, userID, &sent)
+			if err != nil {
+				return err
+			}
+			hash := sha256.Sum256(seed)
+			if hex.EncodeToString(hash[:]) != sent.SelfSeedHash {
+				return fmt.Errorf("the revealed shares do not recover the self seed of user %s", userID)
+			}
+			err = secagg.AddMask(sum, seed, -1)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// the pairwise masks the survivors share with a dropped user are recomputed with its recovered mask key
+		var shares []secagg.Share
+		for _, reveal := range reveals {
+			shares = append(shares, reveal.MaskKeys[userID])
+		}
+		maskKey, err := secagg.Combine(shares, 32)
+		if err != nil {
+			return fmt.Errorf("failed to recover the mask key of user %s: %v", userID, err)
+		}
+		publicKey, err := secagg.PublicKey(maskKey)
+		if err != nil || base64.StdEncoding.EncodeToString(publicKey) != base64.StdEncoding.EncodeToString(maskKeys[userID]) {
+			return fmt.Errorf("the revealed shares do not recover the mask key of user %s", userID)
+		}
+		for _, survivor := range state.Survivors {
+			seed, err := secagg.PairSeed(maskKey, maskKeys[survivor])
+			if err != nil {
+				return err
+			}
+			err = secagg.AddMask(sum, seed, -pairSign(state.Participants, survivor, userID))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	values := secagg.Decode(sum, float64(totalSamples))
+	tensors := make([]tensor.Tensor, 0, len(layout))
+	offset := 0
+	for _, spec := range layout {
+		size := tensor.Size(spec.Shape)
+		data := make([]float32, size)
+		for i := range data {
+			data[i] = float32(values[offset+i])
+		}
+		offset += size
+		tensors = append(tensors, tensor.Tensor{Name: spec.Name, DType: tensor.Float32, Shape: spec.Shape, Data: data})
+	}
+	encoded, err := tensor.Encode(tensors, tensor.Gzip)
+	if err != nil {
+		return err
+	}
+
+	report := AggregationReport{
+		RoundID:   roundID,
+		Rule:      AggregationFedAvg,
+		Selected:  state.Survivors,
+		Rejected:  []string{},
+		Optimizer: OptimizerNone,
+	}
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(groupname+"_AGGREREPORT_"+roundID, reportJSON)
+	if err != nil {
+		return err
+	}
+	rule := group.Config.Aggregation
+	param := ModelParam{
+		Tensors:     base64.StdEncoding.EncodeToString(encoded),
+		UserID:      "ALL",
+		RoundID:     roundID,
+		NumSamples:  totalSamples,
+		Aggregation: &rule,
+	}
+	paramJSON, err := json.Marshal(param)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(groupname+"_AGGREPARAM_"+roundID, paramJSON)
+}
+
+// pairSign is the sign user applies to the mask it shares with peer, the one earlier in the participants adds it
+func pairSign(participants []string, user string, peer string) int {
+	for _, participant := range participants {
+		if participant == user {
+			return 1
+		}
+		if participant == peer {
+			return -1
+		}
+	}
+	return 1
+}
+
+// checkMaskedLayout compares the layout of masked params with the model schema of the group
+func checkMaskedLayout(ctx contractapi.TransactionContextInterface, groupname string, layout []secagg.TensorSpec) error {
+	if len(layout) == 0 {
+		return fmt.Errorf("the masked params have no tensors")
+	}
+	schema, err := getModelSchema(ctx, groupname)
+	if err != nil || schema == nil {
+		return err
+	}
+	if len(layout) != len(schema.Tensors) {
+		return fmt.Errorf("the masked params have %d tensors, expected %d", len(layout), len(schema.Tensors))
+	}
+	for _, spec := range layout {
+		found := false
+		for _, expected := range schema.Tensors {
+			if expected.Name == spec.Name {
+				found = true
+				if !sameShape(spec.Shape, expected.Shape) {
+					return fmt.Errorf("tensor %s has shape %v, expected %v", spec.Name, spec.Shape, expected.Shape)
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("unexpected tensor %s", spec.Name)
+		}
+	}
+	return nil
+}
+
+func sameLayout(a []secagg.TensorSpec, b []secagg.TensorSpec) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || !sameShape(a[i].Shape, b[i].Shape) {
+			return false
+		}
+	}
+	return true
+}
+
+// prepareSecAgg checks the caller and that the round is open and in the phase
+func prepareSecAgg(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, phase string) (*Group, *SecAggRound, error) {
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !group.Config.SecAgg.Enabled {
+		return nil, nil, fmt.Errorf("group %s does not use secure aggregation", groupname)
+	}
+	err = checkMember(ctx, group, groupname, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	round, err := getRoundStatus(ctx, groupname, roundID)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = checkRoundOpen(round, groupname, roundID)
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := getSecAggRound(ctx, groupname, roundID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state.Phase != phase {
+		return nil, nil, fmt.Errorf("round %s of group %s is in the %s phase, not the %s phase", roundID, groupname, state.Phase, phase)
+	}
+	return group, state, nil
+}
+
+func getSecAggRound(ctx contractapi.TransactionContextInterface, groupname string, roundID string) (*SecAggRound, error) {
+	data, err := ctx.GetStub().GetState(groupname + "_SECAGG_" + roundID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the secure aggregation state: %s", err.Error())
+	}
+	if data == nil {
+		return nil, codedError(CodeNotFound, "round %s of group %s has no secure aggregation state", roundID, groupname)
+	}
+	var state SecAggRound
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the secure aggregation state: %s", err.Error())
+	}
+	return &state, nil
+}
+
+func putSecAggRound(ctx contractapi.TransactionContextInterface, groupname string, state *SecAggRound) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(groupname+"_SECAGG_"+state.RoundID, data)
+}
+
+// secAggKey is the key of the keys, shares or reveal of a user in a round
+func secAggKey(groupname string, kind string, roundID string, userID string) string {
+	return fmt.Sprintf("%s_SECAGG%s_%s_%s", groupname, kind, roundID, userID)
+}
+
+func putSecAggValue(ctx contractapi.TransactionContextInterface, groupname string, kind string, roundID string, userID string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(secAggKey(groupname, kind, roundID, userID), data)
+}
+
+// getSecAggReveal reads the reveal of a user from the private data collection of the group
+func getSecAggReveal(ctx contractapi.TransactionContextInterface, group *Group, groupname string, roundID string, userID string, reveal *SecAggReveal) error {
+	data, err := ctx.GetStub().GetPrivateData(group.Config.Collection, secAggKey(groupname, "REVEAL", roundID, userID))
+	if err != nil {
+		return fmt.Errorf("failed to get private data: %s", err.Error())
+	}
+	if data == nil {
+		return fmt.Errorf("the revealed shares of user %s for round %s are not available on this peer", userID, roundID)
+	}
+	return json.Unmarshal(data, reveal)
+}
+
+func getSecAggValue(ctx contractapi.TransactionContextInterface, groupname string, kind string, roundID string, userID string, value interface{}) error {
+	data, err := ctx.GetStub().GetState(secAggKey(groupname, kind, roundID, userID))
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("the secure aggregation %s of user %s for round %s are missing", kind, userID, roundID)
+	}
+	return json.Unmarshal(data, value)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Storage modes of a group
+const (
+	// StorageOnChain keeps the params in the world state and aggregates them in the chaincode
+	StorageOnChain = "onchain"
+	// StorageOffChain keeps the params in a content-addressed store, the ledger only records their digest.
+	// An off-chain aggregator posts the aggregated params with SubmitAggregate
+	StorageOffChain = "offchain"
+	// StoragePrivate keeps the params in the private data collection of the group, the world state only records their hash
+	StoragePrivate = "private"
+)
+
+// ParamRef points to params kept in a content-addressed store
+type ParamRef struct {
+	// Digest is the hex encoded SHA-256 of the stored params
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+	URI    string `json:"uri"`
+}
+
+func (r *ParamRef) validate() error {
+	digest, err := hex.DecodeString(r.Digest)
+	if err != nil || len(digest) != 32 {
+		return fmt.Errorf("the digest must be a hex encoded SHA-256, got %s", r.Digest)
+	}
+	if r.Size <= 0 {
+		return fmt.Errorf("the size must be positive, got %d", r.Size)
+	}
+	if r.URI == "" {
+		return fmt.Errorf("the URI of the params is empty")
+	}
+	return nil
+}
+
+// validateStorage checks the storage mode, the off-chain aggregator only implements weighted FedAvg without a server optimizer.
+// Groups with private storage use the default collection unless they name one
+func (c *GroupConfig) validateStorage() error {
+	switch c.Storage {
+	case "", StorageOnChain:
+		c.Storage = StorageOnChain
+		return nil
+	case StorageOffChain:
+		if c.Aggregation.Rule != AggregationFedAvg {
+			return fmt.Errorf("groups with off-chain storage only support the %s rule, got %s", AggregationFedAvg, c.Aggregation.Rule)
+		}
+		if c.Optimizer.Name != OptimizerNone {
+			return fmt.Errorf("groups with off-chain storage do not support the server optimizer %s", c.Optimizer.Name)
+		}
+		return nil
+	case StoragePrivate:
+		if c.Collection == "" {
+			c.Collection = DefaultCollection
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown storage mode %s", c.Storage)
+	}
+}
+
+// offChain tells whether the group keeps its params in a content-addressed store
+func (c *GroupConfig) offChain() bool {
+	return c.Storage == StorageOffChain
+}
+
+// UploadParamRef records the digest, size and URI of params the user wrote to the content-addressed store
+func (s *SmartContract) UploadParamRef(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, digest string, size int64, uri string, numSamples int, localEpochs int) error {
+	ref := &ParamRef{Digest: digest, Size: size, URI: uri}
+	err := ref.validate()
+	if err != nil {
+		return err
+	}
+
+	group, round, err := prepareUpload(ctx, groupname, roundID, userID, numSamples, localEpochs)
+	if err != nil {
+		return err
+	}
+	if !group.Config.offChain() {
+		return fmt.Errorf("group %s keeps its params on chain, upload them with UploadModelParam", groupname)
+	}
+
+	param := ModelParam{
+		Ref:         ref,
+		UserID:      userID,
+		RoundID:     roundID,
+		NumSamples:  numSamples,
+		LocalEpochs: localEpochs,
+	}
+	return s.storeUpload(ctx, groupname, group, round, &param, &param)
+}
+
+// SubmitAggregate lets the group owner post the params aggregated off-chain for a round that reached its quorum, the round is then closed
+func (s *SmartContract) SubmitAggregate(ctx contractapi.TransactionContextInterface, groupname string, roundID string, digest string, size int64, uri string) error {
+	ref := &ParamRef{Digest: digest, Size: size, URI: uri}
+	err := ref.validate()
+	if err != nil {
+		return err
+	}
+
+	group, err := getGroup(ctx, groupname)
+	if err != nil {
+		return err
+	}
+	if !group.Config.offChain() {
+		return fmt.Errorf("group %s aggregates its params on chain", groupname)
+	}
+	err = checkAdmin(ctx, group, groupname)
+	if err != nil {
+		return err
+	}
+	round, err := getRoundStatus(ctx, groupname, roundID)
+	if err != nil {
+		return err
+	}
+	if round == nil || round.Status != RoundStatusAggregating {
+		return fmt.Errorf("round %s of group %s is not waiting for an aggregate", roundID, groupname)
+	}
+
+	uploads, err := loadRoundParams(ctx, groupname, group.activeUsers(), roundID, nil)
+	if err != nil {
+		return err
+	}
+	report := AggregationReport{
+		RoundID:   roundID,
+		Rule:      AggregationFedAvg,
+		Selected:  []string{},
+		Rejected:  []string{},
+		Optimizer: OptimizerNone,
+	}
+	totalSamples := 0
+	for _, upload := range uploads {
+		totalSamples += sampleWeight(upload)
+		report.Selected = append(report.Selected, upload.UserID)
+	}
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(groupname+"_AGGREREPORT_"+roundID, reportJSON)
+	if err != nil {
+		return err
+	}
+
+	rule := group.Config.Aggregation
+	param := ModelParam{
+		Ref:         ref,
+		UserID:      "ALL",
+		RoundID:     roundID,
+		NumSamples:  totalSamples,
+		Aggregation: &rule,
+	}
+	paramJSON, err := json.Marshal(param)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(groupname+"_AGGREPARAM_"+roundID, paramJSON)
+	if err != nil {
+		return err
+	}
+	return finishRound(ctx, groupname, group, round)
+}
+
+// finishRound closes an aggregated round and opens the next one
+func finishRound(ctx contractapi.TransactionContextInterface, groupname string, group *Group, round *RoundStatus) error {
+	roundNumber, err := strconv.Atoi(round.RoundID)
+	if err != nil {
+		return fmt.Errorf("round ids must be numbers, got %s", round.RoundID)
+	}
+
+	round.Status = RoundStatusClosed
+	err = putRoundStatus(ctx, groupname, round)
+	if err != nil {
+		return err
+	}
+	err = emitRoundEvent(ctx, EventRoundAggregated, groupname, round)
+	if err != nil {
+		return err
+	}
+	err = openRound(ctx, groupname, group, strconv.Itoa(roundNumber+1), 0)
+	if err != nil {
+		return err
+	}
+	return putGroup(ctx, groupname, group)
+}
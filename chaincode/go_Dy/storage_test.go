@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const testDigest = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestValidateStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"on chain by default", `{}`, ""},
+		{"off chain fedavg", `{"storage": "offchain"}`, ""},
+		{"off chain median", `{"storage": "offchain", "aggregation": {"rule": "median"}}`, "only support"},
+		{"off chain optimizer", `{"storage": "offchain", "optimizer": {"name": "fedavgm"}}`, "server optimizer"},
+		{"unknown mode", `{"storage": "tape"}`, "unknown storage mode"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := newMockStub()
+			err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+				return new(SmartContract).CreateGroup(ctx, "g", test.config)
+			})
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("CreateGroup() = %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParamRefValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		ref     ParamRef
+		wantErr bool
+	}{
+		{"valid", ParamRef{Digest: testDigest, Size: 10, URI: "file:///params/a"}, false},
+		{"short digest", ParamRef{Digest: "9f86", Size: 10, URI: "file:///params/a"}, true},
+		{"not hex", ParamRef{Digest: strings.Repeat("z", 64), Size: 10, URI: "file:///params/a"}, true},
+		{"empty size", ParamRef{Digest: testDigest, URI: "file:///params/a"}, true},
+		{"no URI", ParamRef{Digest: testDigest, Size: 10}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.ref.validate()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("validate() = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestOffChainRound(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"storage": "offchain", "policy": {"minFraction": 1}}`, "u1", "u2")
+	s := new(SmartContract)
+	uploadRef := func(userID string, samples int) error {
+		stub.caller = userID
+		return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return s.UploadParamRef(ctx, "g", "0", userID, testDigest, 10, "file:///params/"+userID, samples, 1)
+		})
+	}
+	submit := func(caller string) error {
+		stub.caller = caller
+		return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return s.SubmitAggregate(ctx, "g", "0", testDigest, 10, "file:///params/all")
+		})
+	}
+
+	err := upload(stub, "g", "0", "u1", 1)
+	if err == nil {
+		t.Fatal("UploadModelParam() to an off-chain group = nil, want an error")
+	}
+	if err := uploadRef("u1", 10); err != nil {
+		t.Fatal(err)
+	}
+	err = submit("owner")
+	if err == nil || !strings.Contains(err.Error(), "not waiting") {
+		t.Fatalf("SubmitAggregate() of an open round = %v, want a not waiting error", err)
+	}
+
+	// the quorum moves the round to the aggregator
+	if err := uploadRef("u2", 30); err != nil {
+		t.Fatal(err)
+	}
+	if round := roundStatus(t, stub, "g", "0"); round.Status != RoundStatusAggregating {
+		t.Fatalf("round 0 = %+v, want it waiting for the aggregate", round)
+	}
+	if stub.state["g_AGGREPARAM_0"] != nil {
+		t.Fatal("the chaincode aggregated params kept off chain")
+	}
+
+	err = submit("u1")
+	if err == nil || !strings.Contains(err.Error(), "not the owner") {
+		t.Fatalf("SubmitAggregate() by a user = %v, want a not owner error", err)
+	}
+	if err := submit("owner"); err != nil {
+		t.Fatal(err)
+	}
+	var aggregated ModelParam
+	if !stub.get(t, "g_AGGREPARAM_0", &aggregated) || aggregated.Ref == nil || aggregated.Ref.URI != "file:///params/all" || aggregated.NumSamples != 40 {
+		t.Fatalf("aggregated params = %+v, want the submitted ref over 40 samples", aggregated)
+	}
+	var report AggregationReport
+	stub.get(t, "g_AGGREREPORT_0", &report)
+	if len(report.Selected) != 2 {
+		t.Fatalf("report selected %v, want both users", report.Selected)
+	}
+	if round := roundStatus(t, stub, "g", "0"); round.Status != RoundStatusClosed {
+		t.Fatalf("round 0 = %+v, want it closed", round)
+	}
+	if round := roundStatus(t, stub, "g", "1"); round.Status != RoundStatusOpen {
+		t.Fatalf("round 1 = %+v, want it open", round)
+	}
+}
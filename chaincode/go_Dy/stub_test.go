@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// mockStub is an in-memory ledger for the chaincode tests. Like a peer it keeps the writes of a
+// transaction apart until the transaction commits, so GetState only sees committed state
+type mockStub struct {
+	shim.ChaincodeStubInterface
+	state   map[string][]byte
+	writes  map[string][]byte
+	deletes map[string]bool
+	txCount int
+	// private holds the private data by collection and key, like the state it is written when the transaction commits
+	private        map[string]map[string][]byte
+	privateWrites  map[string]map[string][]byte
+	privateDeletes map[string]map[string]bool
+	// transient is the transient data of the next transactions
+	transient map[string][]byte
+	// eventName and eventPayload are the chaincode event of the last transaction,
+	// like a peer the stub keeps only the last event set by a transaction
+	eventName    string
+	eventPayload []byte
+	// now is the timestamp of the next transactions in unix seconds
+	now int64
+	// mspID and caller are the identity that submits the next transactions
+	mspID  string
+	caller string
+}
+
+func newMockStub() *mockStub {
+	return &mockStub{state: make(map[string][]byte), private: make(map[string]map[string][]byte), mspID: "Org1MSP", caller: "owner"}
+}
+
+// mockIdentity is the client identity of a test transaction
+type mockIdentity struct {
+	cid.ClientIdentity
+	mspID string
+	id    string
+}
+
+func (i mockIdentity) GetID() (string, error) {
+	return i.id, nil
+}
+
+func (i mockIdentity) GetMSPID() (string, error) {
+	return i.mspID, nil
+}
+
+// invoke runs fn as one transaction, its writes are committed only when fn succeeds
+func (s *mockStub) invoke(fn func(ctx contractapi.TransactionContextInterface) error) error {
+	s.writes = make(map[string][]byte)
+	s.deletes = make(map[string]bool)
+	s.privateWrites = make(map[string]map[string][]byte)
+	s.privateDeletes = make(map[string]map[string]bool)
+	s.txCount++
+	s.eventName, s.eventPayload = "", nil
+	ctx := new(EventContext)
+	ctx.SetStub(s)
+	ctx.SetClientIdentity(mockIdentity{mspID: s.mspID, id: s.caller})
+	err := fn(ctx)
+	if err != nil {
+		s.eventName, s.eventPayload = "", nil
+		return err
+	}
+	for key := range s.deletes {
+		delete(s.state, key)
+	}
+	for key, value := range s.writes {
+		s.state[key] = value
+	}
+	for collection, keys := range s.privateDeletes {
+		for key := range keys {
+			delete(s.private[collection], key)
+		}
+	}
+	for collection, writes := range s.privateWrites {
+		if s.private[collection] == nil {
+			s.private[collection] = make(map[string][]byte)
+		}
+		for key, value := range writes {
+			s.private[collection][key] = value
+		}
+	}
+	return nil
+}
+
+func (s *mockStub) GetTxID() string {
+	return fmt.Sprintf("tx%d", s.txCount)
+}
+
+func (s *mockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.now}, nil
+}
+
+func (s *mockStub) GetState(key string) ([]byte, error) {
+	return s.state[key], nil
+}
+
+func (s *mockStub) PutState(key string, value []byte) error {
+	delete(s.deletes, key)
+	s.writes[key] = value
+	return nil
+}
+
+func (s *mockStub) DelState(key string) error {
+	delete(s.writes, key)
+	s.deletes[key] = true
+	return nil
+}
+
+func (s *mockStub) SetEvent(name string, payload []byte) error {
+	s.eventName, s.eventPayload = name, payload
+	return nil
+}
+
+func (s *mockStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+func (s *mockStub) GetPrivateData(collection string, key string) ([]byte, error) {
+	return s.private[collection][key], nil
+}
+
+func (s *mockStub) PutPrivateData(collection string, key string, value []byte) error {
+	delete(s.privateDeletes[collection], key)
+	if s.privateWrites[collection] == nil {
+		s.privateWrites[collection] = make(map[string][]byte)
+	}
+	s.privateWrites[collection][key] = value
+	return nil
+}
+
+func (s *mockStub) DelPrivateData(collection string, key string) error {
+	delete(s.privateWrites[collection], key)
+	if s.privateDeletes[collection] == nil {
+		s.privateDeletes[collection] = make(map[string]bool)
+	}
+	s.privateDeletes[collection][key] = true
+	return nil
+}
+
+// put commits value as JSON under key
+func (s *mockStub) put(t *testing.T, key string, value interface{}) {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.state[key] = data
+}
+
+// get unmarshals the committed value of key into value, it reports whether the key exists
+func (s *mockStub) get(t *testing.T, key string, value interface{}) bool {
+	t.Helper()
+	data := s.state[key]
+	if data == nil {
+		return false
+	}
+	err := json.Unmarshal(data, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return true
+}
+
+// events returns the round events of the last transaction
+func (s *mockStub) events(t *testing.T) []RoundEvent {
+	t.Helper()
+	if s.eventPayload == nil {
+		return nil
+	}
+	var events []RoundEvent
+	err := json.Unmarshal(s.eventPayload, &events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// uploadParams is the JSON of the params a test user uploads, every layer is set to value
+func uploadParams(value float64) string {
+	return fmt.Sprintf(`{"fc.weight": [[%v, %v]], "fc.bias": [%v]}`, value, value, value)
+}
+
+// setupGroup creates a group with the config as "owner" and adds the users to it, every user
+// is bound to an identity named like the user
+func setupGroup(t *testing.T, stub *mockStub, groupname string, config string, users ...string) {
+	t.Helper()
+	s := new(SmartContract)
+	stub.mspID, stub.caller = "Org1MSP", "owner"
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return s.CreateGroup(ctx, groupname, config)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range users {
+		err = stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return s.AddUser(ctx, groupname, user, "Org1MSP", user)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// upload uploads params as the user, each upload is its own transaction
+func upload(stub *mockStub, groupname string, roundID string, userID string, value float64) error {
+	stub.caller = userID
+	return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return new(SmartContract).UploadModelParam(ctx, groupname, roundID, userID, uploadParams(value), 10, 1)
+	})
+}
+
+// roundStatus reads the committed state of a round
+func roundStatus(t *testing.T, stub *mockStub, groupname string, roundID string) *RoundStatus {
+	t.Helper()
+	var round RoundStatus
+	if !stub.get(t, groupname+"_ROUND_"+roundID, &round) {
+		t.Fatalf("round %s of group %s was never opened", roundID, groupname)
+	}
+	return &round
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"Capstone_go/tensor"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// UploadModelParamTensor allows a user to upload their model parameters as a binary tensor container,
+// tensorsBase64 is the base64 encoded container. Rounds where every upload is a container are averaged
+// without converting the params to JSON trees
+func (s *SmartContract) UploadModelParamTensor(ctx contractapi.TransactionContextInterface, groupname string, roundID string, userID string, tensorsBase64 string, numSamples int, localEpochs int) error {
+	group, round, err := prepareUpload(ctx, groupname, roundID, userID, numSamples, localEpochs)
+	if err != nil {
+		return err
+	}
+	if group.Config.offChain() {
+		return fmt.Errorf("group %s keeps its params off chain, upload a reference with UploadParamRef", groupname)
+	}
+
+	param := ModelParam{
+		Tensors:     tensorsBase64,
+		UserID:      userID,
+		RoundID:     roundID,
+		NumSamples:  numSamples,
+		LocalEpochs: localEpochs,
+	}
+	err = checkUpload(ctx, groupname, &param)
+	if err != nil {
+		return err
+	}
+	return s.storeUpload(ctx, groupname, group, round, &param, &param)
+}
+
+// decodeTensors reads the tensor container of the param
+func (p *ModelParam) decodeTensors() ([]tensor.Tensor, error) {
+	data, err := base64.StdEncoding.DecodeString(p.Tensors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the tensors of user %s: %s", p.UserID, err.Error())
+	}
+	tensors, err := tensor.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the tensors of user %s: %s", p.UserID, err.Error())
+	}
+	return tensors, nil
+}
+
+// expandTensors fills Params from the tensor container so the param can go through the JSON tree code
+func (p *ModelParam) expandTensors() error {
+	if p.Tensors == "" {
+		return nil
+	}
+	tensors, err := p.decodeTensors()
+	if err != nil {
+		return err
+	}
+	p.Params = tensor.ToParams(tensors)
+	p.Tensors = ""
+	return nil
+}
+
+// allTensors tells whether every upload is a tensor container
+func allTensors(uploads []*ModelParam) bool {
+	for _, upload := range uploads {
+		if upload.Tensors == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// weightedMeanTensors averages tensor containers weighted by their sample count, the result is a gzip compressed float32 container
+func weightedMeanTensors(uploads []*ModelParam) (string, error) {
+	sets := make([][]tensor.Tensor, len(uploads))
+	weights := make([]float64, len(uploads))
+	for i, upload := range uploads {
+		tensors, err := upload.decodeTensors()
+		if err != nil {
+			return "", err
+		}
+		sets[i] = tensors
+		weights[i] = float64(sampleWeight(upload))
+	}
+
+	result, err := tensor.WeightedMean(sets, weights)
+	if err != nil {
+		return "", err
+	}
+	for i := range result {
+		result[i].DType = tensor.Float32
+	}
+	data, err := tensor.Encode(result, tensor.Gzip)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/base64"
+	"math"
+	"testing"
+
+	"Capstone_go/tensor"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func encodeTensors(t *testing.T, value float32) string {
+	t.Helper()
+	data, err := tensor.Encode([]tensor.Tensor{{Name: "fc.weight", DType: tensor.Float16, Shape: []int{2}, Data: []float32{value, -value}}}, tensor.Gzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestTensorRound(t *testing.T) {
+	stub := newMockStub()
+	setupGroup(t, stub, "g", `{"policy": {"mode": "finalize"}}`, "u1", "u2")
+	s := new(SmartContract)
+	uploadTensors := func(userID string, tensors string, samples int) error {
+		stub.caller = userID
+		return stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+			return s.UploadModelParamTensor(ctx, "g", "0", userID, tensors, samples, 1)
+		})
+	}
+
+	if err := uploadTensors("u1", "not a container", 10); err == nil {
+		t.Fatal("UploadModelParamTensor() with invalid tensors = nil, want an error")
+	}
+	if err := uploadTensors("u1", encodeTensors(t, 1), 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploadTensors("u2", encodeTensors(t, 4), 30); err != nil {
+		t.Fatal(err)
+	}
+	stub.caller = "owner"
+	err := stub.invoke(func(ctx contractapi.TransactionContextInterface) error {
+		return s.FinalizeRound(ctx, "g", "0")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var aggregated ModelParam
+	stub.get(t, "g_AGGREPARAM_0", &aggregated)
+	if aggregated.Tensors == "" || aggregated.Params != nil {
+		t.Fatalf("aggregated params = %+v, want a tensor container", aggregated)
+	}
+	tensors, err := aggregated.decodeTensors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (1*10 + 4*30) / 40
+	want := []float32{3.25, -3.25}
+	if len(tensors) != 1 || tensors[0].DType != tensor.Float32 || len(tensors[0].Data) != len(want) {
+		t.Fatalf("aggregated tensors = %+v, want one float32 tensor of 2 values", tensors)
+	}
+	for i := range want {
+		if math.Abs(float64(tensors[0].Data[i]-want[i])) > 1e-6 {
+			t.Fatalf("aggregated tensor = %v, want %v", tensors[0].Data, want)
+		}
+	}
+}
+
+func TestExpandTensors(t *testing.T) {
+	param := ModelParam{UserID: "u1", Tensors: encodeTensors(t, 2)}
+	if err := param.expandTensors(); err != nil {
+		t.Fatal(err)
+	}
+	weights, ok := param.Params["fc.weight"].([]interface{})
+	if param.Tensors != "" || !ok || len(weights) != 2 || weights[0] != 2.0 || weights[1] != -2.0 {
+		t.Fatalf("expanded params = %+v, want fc.weight [2 -2]", param.Params)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"Capstone_go/API"
+	"Capstone_go/orchestrator"
+	"Capstone_go/trainer"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// commands lists the commands of flctl in the order of the usage
+var commands = []command{
+	{path: "group create", short: "create a group with the given aggregation and policy", required: []string{"group"}, setup: groupCreate},
+	{path: "group list", short: "list the existing groups", setup: groupList},
+	{path: "group members", short: "list the owner and the users of a group", required: []string{"group"}, setup: groupMembers},
+	{path: "user register", short: "add a user to a group, bound to its wallet identity if it has one", required: []string{"group", "user"}, setup: userRegister},
+	{path: "param upload", short: "upload the params file of a user for a round", required: []string{"group", "round", "user", "file"}, setup: paramUpload},
+	{path: "param get", short: "save the params a user uploaded for a round", required: []string{"group", "round", "user"}, setup: paramGet},
+	{path: "round status", short: "show the state of a round and who uploaded", required: []string{"group", "round"}, setup: roundStatus},
+	{path: "round finalize", short: "aggregate a round of a group in finalize mode", required: []string{"group", "round"}, setup: roundFinalize},
+	{path: "aggregate get", short: "save the aggregated params of a round and show its report", required: []string{"group", "round"}, setup: aggregateGet},
+	{path: "run", short: "train the users and run the rounds of a group", required: []string{"group", "users"}, setup: runRounds},
+}
+
+// groupFlags defines the flags of the group config, their defaults are the orchestrator's
+func groupFlags(flags *flag.FlagSet) *API.GroupConfig {
+	config := orchestrator.DefaultGroupConfig()
+	flags.StringVar(&config.Aggregation.Rule, "rule", config.Aggregation.Rule, "aggregation rule: fedavg, median, trimmedmean, krum or multikrum")
+	flags.Float64Var(&config.Aggregation.TrimRatio, "trim-ratio", config.Aggregation.TrimRatio, "fraction of the largest and smallest values of every coordinate trimmedmean drops, in [0, 0.5)")
+	flags.IntVar(&config.Aggregation.ByzantineCount, "byzantine", config.Aggregation.ByzantineCount, "number of attackers krum and multikrum assume")
+	flags.IntVar(&config.Aggregation.KrumSelect, "krum-select", config.Aggregation.KrumSelect, "number of uploads multikrum averages, 0 for all but -byzantine")
+	flags.StringVar(&config.Optimizer.Name, "optimizer", config.Optimizer.Name, "server optimizer: none, fedavgm, fedadam or fedyogi")
+	flags.StringVar(&config.Storage, "storage", config.Storage, "where the params are kept: onchain, offchain or private")
+	flags.BoolVar(&config.SecAgg.Enabled, "secagg", config.SecAgg.Enabled, "upload masked params so the chaincode only sees their sum")
+	flags.IntVar(&config.Policy.MinCount, "min-count", config.Policy.MinCount, "least number of uploads to aggregate")
+	flags.Float64Var(&config.Policy.MinFraction, "min-fraction", config.Policy.MinFraction, "least fraction of the users that upload to aggregate")
+	flags.StringVar(&config.Policy.Mode, "mode", config.Policy.Mode, "aggregate at quorum (eager) or on round finalize (finalize)")
+	flags.Int64Var(&config.Policy.RoundTimeoutSeconds, "round-timeout", config.Policy.RoundTimeoutSeconds, "seconds after which a round expires, 0 for never")
+	return &config
+}
+
+func groupCreate(flags *flag.FlagSet) func(ctx context.Context, e *env) error {
+	group := flags.String("group", "", "name of the group")
+	config := groupFlags(flags)
+	return func(ctx context.Context, e *env) error {
+		err := e.client.CreateGroup(ctx, *group, *config)
+		if err != nil {
+			return err
+		}
+		return e.out.printStatus(map[string]string{"group": *group, "status": "created"})
+	}
+}
+
+func groupList(flags *flag.FlagSet) func(ctx context.Context, e *env) error {
+	return func(ctx context.Context, e *env) error {
+		groups, err := e.client.GetExistGroupNameList(ctx)
+		if err != nil {
+			return err
+		}
+		rows := [][]string{{"GROUP"}}
+		for _, name := range groups.GroupsName {
+			rows = append(rows, []string{name})
+		}
+		return e.out.print(groups, rows)
+	}
+}
+
+func groupMembers(flags *flag.FlagSet) func(ctx context.Context, e *env) error {
+	group := flags.String("group", "", "name of the group")
+	return func(ctx context.Context, e *env) error {
+		members, err := e.client.GetGroupMembers(ctx, *group)
+		if err != nil {
+			return err
+		}
+		rows := [][]string{{"USER", "MSP", "STATUS"}, {"(owner)", members.Owner.MSPID, "owner"}}
+		for _, member := range members.Members {
+			rows = append(rows, []string{member.UserID, member.MSPID, member.Status})
+		}
+		return e.out.print(members, rows)
+	}
+}
+
+func userRegister(flags *flag.FlagSet) func(ctx context.Context, e *env) error {
+	group := flags.String("group", "", "name of the group")
+	user := flags.String("user", "", "id of the user")
+	return func(ctx context.Context, e *env) error {
+		err := orchestrator.New(e.client, e.wallet, e.profile).Register(ctx, *group, *user)
+		if err != nil {
+			return err
+		}
+		return e.out.printStatus(map[string]string{"group": *group, "user": *user, "status": "registered"})
+	}
+}
+
+func paramUpload(flags *flag.FlagSet) func(ctx context.Context, e *env) error {
+	group := flags.String("group", "", "name of the group")
+	round := flags.String("round", "", "id of the round")
+	user := flags.String("user", "", "id of the user, it uploads with its wallet identity if it has one")
+	storage := flags.String("storage", "", "storage of the group: onchain, offchain or private")
+	var result trainer.TrainResult
+	flags.StringVar(&result.ParamsPath, "file", "", "JSON params file written by the training")
+	flags.IntVar(&result.NumSamples, "samples", 1, "number of samples the user trained on")
+	flags.IntVar(&result.LocalEpochs, "epochs", 0, "number of local epochs")
+	return func(ctx context.Context, e *env) error {
+		c, err := e.userClient(*user)
+		if err != nil {
+			return err
+		}
+		o := orchestrator.New(e.client, e.wallet, e.profile)
+		o.GroupConfig.Storage = *storage
+		err = o.Upload(ctx, c, *group, *round, *user, result)
+		if err != nil {
+			return err
+		}
+		return e.out.printStatus(map[string]string{"group": *group, "round": *round, "user": *user, "status": "uploaded"})
+	}
+}
+
+// paramResult is the output of the commands that save params
+type paramResult struct {
+	Key         string `json:"key"`
+	UserID      string `json:"userID"`
+	RoundID     string `json:"roundID"`
+	NumSamples  int    `json:"numSamples"`
+	LocalEpochs int    `json:"localEpochs,omitempty"`
+	File        string `json:"file"`
+}
+
+// saveParams reads the params under the key and writes them to "<key>_Dy.json" in dir,
+// like API.Client.ReadUserModel_Dy does
+func saveParams(ctx context.Context, c *API.Client, key string, dir string) (*paramResult, error) {
+	modelParam, err := c.GetModelParamDy(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(modelParam.Params, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal params: %w", err)
+	}
+	file := filepath.Join(dir, key+"_Dy.json")
+	err = os.WriteFile(file, data, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write params: %w", err)
+	}
+	return &paramResult{
+		Key:         key,
+		UserID:      modelParam.UserID,
+		RoundID:     modelParam.RoundID,
+		NumSamples:  modelParam.NumSamples,
+		LocalEpochs: modelParam.LocalEpochs,
+		File:        file,
+	}, nil
+}
+
+func (r *paramResult) rows() [][]string {
+	return [][]string{
+		{"KEY", "USER", "ROUND", "SAMPLES", "EPOCHS", "FILE"},
+		{r.Key, r.UserID, r.RoundID, strconv.Itoa(r.NumSamples), strconv.Itoa(r.LocalEpochs), r.File},
+	}
+}
+
+func paramGet(flags *flag.FlagSet) func(ctx context.Context, e *env) error {
+	group := flags.String("group", "", "name of the group")
+	round := flags.String("round", "", "id of the round")
+	user := flags.String("user", "", "id of the user, the params are read with its wallet identity if it has one")
+	dir := flags.String("dir", "", "directory the params are saved to, the data dir of the profile by default")
+	return func(ctx context.Context, e *env) error {
+		c, err := e.userClient(*user)
+		if err != nil {
+			return err
+		}
+		if *dir == "" {
+			*dir = e.profile.DataDir
+		}
+		result, err := saveParams(ctx, c, *group+"_PARAM_"+*user+"_"+*round, *dir)
+		if err != nil {
+			return err
+		}
+		return e.out.print(result, result.rows())
+	}
+}
+
+// statusRows lists the rounds as a table
+func statusRows(statuses ...*API.RoundStatus) [][]string {
+	rows := [][]string{{"ROUND", "STATUS", "ATTEMPT", "UPLOADED"}}
+	for _, status := range statuses {
+		rows = append(rows, []string{status.RoundID, status.Status, strconv.Itoa(status.Attempt), strings.Join(status.Uploaded, ",")})
+	}
+	return rows
+}
+
+func roundStatus(flags *flag.FlagSet) func(ctx context.Context, e *env) error {
+	group := flags.String("group", "", "name of the group")
+	round := flags.String("round", "", "id of the round")
+	return func(ctx context.Context, e *env) error {
+		status, err := e.client.GetRoundStatus(ctx, *group, *round)
+		if err != nil {
+			return err
+		}
+		return e.out.print(status, statusRows(status))
+	}
+}
+
+func roundFinalize(flags *flag.FlagSet) func(ctx context.Context, e *env) error {
+	group := flags.String("group", "", "name of the group")
+	round := flags.String("round", "", "id of the round")
+	return func(ctx context.Context, e *env) error {
+		err := e.client.FinalizeRound(ctx, *group, *round)
+		if err != nil {
+			return err
+		}
+		status, err := e.client.GetRoundStatus(ctx, *group, *round)
+		if err != nil {
+			return err
+		}
+		return e.out.print(status, statusRows(status))
+	}
+}
+
+func aggregateGet(flags *flag.FlagSet) func(ctx context.Context, e *env) error {
+	group := flags.String("group", "", "name of the group")
+	round := flags.String("round", "", "id of the round")
+	dir := flags.String("dir", "", "directory the params are saved to, the data dir of the profile by default")
+	return func(ctx context.Context, e *env) error {
+		if *dir == "" {
+			*dir = e.profile.DataDir
+		}
+		result, err := saveParams(ctx, e.client, *group+"_AGGREPARAM_"+*round, *dir)
+		if err != nil {
+			return err
+		}
+		report, err := e.client.GetAggregationReport(ctx, *group, *round)
+		if err != nil {
+			return err
+		}
+		rows := [][]string{
+			{"ROUND", "RULE", "OPTIMIZER", "SELECTED", "REJECTED", "FILE"},
+			{report.RoundID, report.Rule, report.Optimizer, strings.Join(report.Selected, ","), strings.Join(report.Rejected, ","), result.File},
+		}
+		return e.out.print(struct {
+			*paramResult
+			Report *API.AggregationReport `json:"report"`
+		}{result, report}, rows)
+	}
+}
+
+func runRounds(flags *flag.FlagSet) func(ctx context.Context, e *env) error {
+	group := flags.String("group", "", "name of the group, it is created if it does not exist")
+	users := flags.String("users", "", "comma separated ids of the users, at most 10")
+	rounds := flags.Int("rounds", 1, "number of rounds")
+	config := groupFlags(flags)
+	return func(ctx context.Context, e *env) error {
+		if *rounds < 1 {
+			return usagef("-rounds must be at least 1")
+		}
+		userlist := strings.Split(*users, ",")
+		o := orchestrator.New(e.client, e.wallet, e.profile)
+		o.GroupConfig = *config
+		runErr := o.TotalProcess(ctx, *group, userlist, *rounds)
+
+		var statuses []*API.RoundStatus
+		for i := 0; i < *rounds; i++ {
+			status, err := e.client.GetRoundStatus(ctx, *group, strconv.Itoa(i))
+			if err != nil {
+				break
+			}
+			statuses = append(statuses, status)
+		}
+		err := e.out.print(statuses, statusRows(statuses...))
+		if runErr != nil {
+			return runErr
+		}
+		return err
+	}
+}
@@ -0,0 +1,283 @@
+// Command flctl manages the federated learning groups on the FL chaincode and runs their rounds.
+//
+//	flctl [-config file] [-profile name] [-output table|json] <command> [subcommand] [flags]
+//
+// The connection is read from the profile of flconfig.yaml, see the config package. Results are printed to stdout,
+// progress and errors to stderr, and the exit code tells what went wrong, see the exit* constants
+package main
+
+import (
+	"Capstone_go/API"
+	"Capstone_go/config"
+	"Capstone_go/orchestrator"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes of flctl
+const (
+	exitOK = 0
+	// exitError is any failure not covered below
+	exitError = 1
+	// exitUsage is an unknown command or a missing or invalid flag
+	exitUsage = 2
+	// exitConfig is a config file or profile that cannot be loaded, or a connection that cannot be set up
+	exitConfig = 3
+	// exitNotFound is a group, round, param or participant that does not exist
+	exitNotFound = 4
+	// exitDenied is a user that is not a member of the group or a read the chaincode refused
+	exitDenied = 5
+	// exitConflict is a group or user that already exists
+	exitConflict = 6
+	// exitRound is a round that no longer takes uploads or did not close
+	exitRound = 7
+	// exitTransport is a gateway that could not be reached or did not answer in time
+	exitTransport = 8
+	// exitRejected is a transaction the peers refused to endorse or commit for another reason
+	exitRejected = 9
+)
+
+// usageError is a command line the command cannot run with
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+// configError is a profile that cannot be loaded or connected with
+type configError struct {
+	err error
+}
+
+func (e *configError) Error() string {
+	return e.err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+// exitCode maps the error of a command to the exit code of flctl
+func exitCode(err error) int {
+	var usage *usageError
+	var conf *configError
+	var denied *API.AccessDeniedError
+	var transport *API.TransportError
+	var endorse *API.EndorseError
+	var commit *API.CommitError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.As(err, &conf):
+		return exitConfig
+	case errors.Is(err, API.ErrNotFound), errors.Is(err, API.ErrUnknownParticipant):
+		return exitNotFound
+	case errors.Is(err, API.ErrNotRegistered), errors.As(err, &denied):
+		return exitDenied
+	case errors.Is(err, API.ErrAlreadyRegistered):
+		return exitConflict
+	case errors.Is(err, API.ErrRoundClosed), errors.Is(err, orchestrator.ErrRoundIncomplete):
+		return exitRound
+	case errors.As(err, &transport):
+		return exitTransport
+	case errors.As(err, &endorse), errors.As(err, &commit):
+		return exitRejected
+	}
+	return exitError
+}
+
+// command is a leaf of the command tree, e.g. "group create". setup defines the flags of the command
+// and returns the function running it with their values, the required flags must not be empty
+type command struct {
+	path     string
+	short    string
+	required []string
+	setup    func(flags *flag.FlagSet) func(ctx context.Context, e *env) error
+}
+
+// env is what the commands share: the profile, its connection and the printer of the results
+type env struct {
+	profile *config.Profile
+	client  *API.Client
+	wallet  *API.Wallet
+	out     *printer
+}
+
+// userClient returns the client of the user's identity in the wallet, or the client of the profile if the user has none
+func (e *env) userClient(userId string) (*API.Client, error) {
+	if !e.wallet.Has(userId) {
+		return e.client, nil
+	}
+	return e.wallet.Client(userId)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run parses the command line, runs the command and returns the exit code
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("flctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configFile := flags.String("config", "", "config file, FL_CONFIG or "+config.DefaultFile+" by default")
+	profileName := flags.String("profile", "", "profile of the config file, FL_PROFILE or the default profile by default")
+	output := flags.String("output", "table", "output format, table or json")
+	flags.Usage = func() { usage(stderr, flags) }
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		return exitUsage
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "flctl: unknown output format %q, use table or json\n", *output)
+		return exitUsage
+	}
+
+	cmd, rest := findCommand(flags.Args())
+	if cmd == nil {
+		if flags.NArg() > 0 {
+			fmt.Fprintf(stderr, "flctl: unknown command %q\n", strings.Join(flags.Args(), " "))
+		}
+		usage(stderr, flags)
+		return exitUsage
+	}
+
+	err = runCommand(ctx, cmd, rest, *configFile, *profileName, &printer{w: stdout, json: *output == "json"}, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "flctl %s: %v\n", cmd.path, err)
+	}
+	return exitCode(err)
+}
+
+// runCommand connects with the profile and runs the command
+func runCommand(ctx context.Context, cmd *command, args []string, configFile string, profileName string, out *printer, stderr io.Writer) error {
+	// the flags are checked before connecting so a wrong command line fails fast
+	flags := flag.NewFlagSet("flctl "+cmd.path, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	runner := cmd.setup(flags)
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	if err != nil {
+		return &usageError{message: err.Error()}
+	}
+	if flags.NArg() > 0 {
+		return usagef("unexpected arguments %s", strings.Join(flags.Args(), " "))
+	}
+	for _, name := range cmd.required {
+		if flags.Lookup(name).Value.String() == "" {
+			return usagef("flag -%s is required", name)
+		}
+	}
+
+	e := &env{out: out}
+	e.profile, err = config.Load(configFile, profileName)
+	if err != nil {
+		return &configError{err: err}
+	}
+	// the clients, the orchestrator and the training scripts report their progress to stderr
+	e.profile.Logger = log.New(stderr, "", 0)
+	e.client, err = API.NewClient(e.profile.ClientConfig())
+	if err != nil {
+		return &configError{err: err}
+	}
+	defer e.client.Close()
+	e.wallet = e.profile.NewWallet()
+	defer e.wallet.Close()
+
+	return runner(ctx, e)
+}
+
+// findCommand looks up the command named by the first one or two arguments
+func findCommand(args []string) (*command, []string) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if len(args) > 1 {
+		path := args[0] + " " + args[1]
+		for i := range commands {
+			if commands[i].path == path {
+				return &commands[i], args[2:]
+			}
+		}
+	}
+	for i := range commands {
+		if commands[i].path == args[0] {
+			return &commands[i], args[1:]
+		}
+	}
+	return nil, nil
+}
+
+func usage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintf(w, "usage: flctl [flags] <command> [subcommand] [flags]\n\nflags:\n")
+	flags.PrintDefaults()
+	fmt.Fprintf(w, "\ncommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.path, cmd.short)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nrun \"flctl <command> -h\" for the flags of a command\n")
+}
+
+// printer writes the results of the commands as JSON or as a table
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes v as indented JSON, or the rows as a table whose first row is the header
+func (p *printer) print(v interface{}, rows [][]string) error {
+	if p.json {
+		encoder := json.NewEncoder(p.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// printStatus writes the outcome of a command that has no result of its own
+func (p *printer) printStatus(fields map[string]string) error {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	rows := make([][]string, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, []string{strings.ToUpper(key), fields[key]})
+	}
+	return p.print(fields, rows)
+}
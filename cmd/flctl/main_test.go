@@ -0,0 +1,105 @@
+package main
+
+import (
+	"Capstone_go/API"
+	"Capstone_go/orchestrator"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{"no command", nil, exitUsage, "usage: flctl"},
+		{"help", []string{"-h"}, exitOK, "commands:"},
+		{"unknown flag", []string{"-verbose", "group", "list"}, exitUsage, "flag provided but not defined"},
+		{"unknown output", []string{"-output", "xml", "group", "list"}, exitUsage, `unknown output format "xml"`},
+		{"unknown command", []string{"frobnicate"}, exitUsage, `unknown command "frobnicate"`},
+		{"unknown subcommand", []string{"group", "drop"}, exitUsage, `unknown command "group drop"`},
+		{"command help", []string{"group", "create", "-h"}, exitOK, "-rule string"},
+		{"missing required flag", []string{"user", "register", "-group", "g"}, exitUsage, "flag -user is required"},
+		{"bad command flag", []string{"round", "status", "-group", "g", "-round", "x", "-bogus"}, exitUsage, "flag provided but not defined: -bogus"},
+		{"extra argument", []string{"group", "list", "extra"}, exitUsage, "unexpected arguments extra"},
+		{"missing config", []string{"-config", missing, "group", "list"}, exitConfig, "failed to read config file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(context.Background(), test.args, &stdout, &stderr)
+			if code != test.wantCode {
+				t.Fatalf("run(%q) = %d, want %d, stderr:\n%s", test.args, code, test.wantCode, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), test.wantStderr) {
+				t.Fatalf("run(%q) stderr:\n%s\nwant it to contain %q", test.args, stderr.String(), test.wantStderr)
+			}
+			if stdout.Len() != 0 {
+				t.Fatalf("run(%q) wrote %q to stdout, results only", test.args, stdout.String())
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	transaction := &API.TransactionError{Transaction: "UploadModelParam"}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitOK},
+		{"usage", usagef("flag -group is required"), exitUsage},
+		{"config", &configError{err: errors.New("no profile")}, exitConfig},
+		{"not found", fmt.Errorf("get param: %w", API.ErrNotFound), exitNotFound},
+		{"unknown participant", fmt.Errorf("wallet: %w", API.ErrUnknownParticipant), exitNotFound},
+		{"not registered", fmt.Errorf("upload: %w", API.ErrNotRegistered), exitDenied},
+		{"access denied", fmt.Errorf("get param: %w", &API.AccessDeniedError{Key: "g_PARAM_u1_0"}), exitDenied},
+		{"already registered", API.ErrAlreadyRegistered, exitConflict},
+		{"round closed", fmt.Errorf("upload: %w", API.ErrRoundClosed), exitRound},
+		{"round incomplete", fmt.Errorf("round 0: %w", orchestrator.ErrRoundIncomplete), exitRound},
+		{"transport", &API.TransportError{TransactionError: transaction}, exitTransport},
+		{"endorse", &API.EndorseError{TransactionError: transaction}, exitRejected},
+		{"commit", fmt.Errorf("upload: %w", &API.CommitError{TransactionError: transaction}), exitRejected},
+		{"other", errors.New("disk full"), exitError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := exitCode(test.err); got != test.want {
+				t.Fatalf("exitCode(%v) = %d, want %d", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	fields := map[string]string{"round": "3", "group": "g"}
+	tests := []struct {
+		name string
+		json bool
+		want string
+	}{
+		{"table", false, "GROUP  g\nROUND  3\n"},
+		{"json", true, "{\n  \"group\": \"g\",\n  \"round\": \"3\"\n}\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := &printer{w: &out, json: test.json}
+			if err := p.printStatus(fields); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Fatalf("printStatus() wrote %q, want %q", out.String(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+// Package config loads the connection and training settings of the orchestrator from a YAML or JSON file.
+// The file holds named profiles, one per org or machine, the profile in use is picked by name, FL_PROFILE
+// or the default of the file. Environment variables override single settings of the profile
+package config
+
+import (
+	"Capstone_go/API"
+	"Capstone_go/trainer"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the config file used when FL_CONFIG is not set
+const DefaultFile = "flconfig.yaml"
+
+// Profile holds the settings of one org or machine. Relative paths in the file are resolved against the directory of the file
+type Profile struct {
+	Name string `yaml:"-" json:"-"`
+	// MSPID is the MSP of the org the client identity belongs to
+	MSPID string `yaml:"mspID" json:"mspID"`
+	// Endpoint is the address of the gateway peer, e.g. "localhost:7051"
+	Endpoint string `yaml:"peerEndpoint" json:"peerEndpoint"`
+	// GatewayPeer is the host name in the TLS certificate of the gateway peer
+	GatewayPeer string `yaml:"gatewayPeer" json:"gatewayPeer"`
+	// TLSCACert is the PEM file of the CA that signed the TLS certificate of the gateway peer
+	TLSCACert string `yaml:"tlsCACert" json:"tlsCACert"`
+	// Cert is the PEM file of the X.509 certificate of the client identity
+	Cert string `yaml:"cert" json:"cert"`
+	// KeyDir is the keystore directory of the private key, or the key file itself
+	KeyDir    string `yaml:"keyDir" json:"keyDir"`
+	Channel   string `yaml:"channel" json:"channel"`
+	Chaincode string `yaml:"chaincode" json:"chaincode"`
+	// Python is the interpreter that runs the training scripts
+	Python string `yaml:"python" json:"python"`
+	// TrainScript trains a client from scratch and LoadTrainScript from the aggregated params of the last round
+	TrainScript     string `yaml:"trainScript" json:"trainScript"`
+	LoadTrainScript string `yaml:"loadTrainScript" json:"loadTrainScript"`
+	// TrainerURL is the train endpoint of a long-lived trainer worker, when set it trains the clients instead of the scripts
+	TrainerURL string `yaml:"trainerURL" json:"trainerURL"`
+	// DataDir keeps the params files of the clients and the params read from the ledger, "modelData" by default
+	DataDir  string   `yaml:"dataDir" json:"dataDir"`
+	Timeouts Timeouts `yaml:"timeouts" json:"timeouts"`
+	// Wallet maps the participants of a run to their own identities, participants missing from it use the profile identity
+	Wallet map[string]Participant `yaml:"wallet" json:"wallet"`
+	// Logger receives the progress of the clients, the orchestrator and the training scripts of the profile,
+	// it is set by the program, nothing is logged when nil
+	Logger *log.Logger `yaml:"-" json:"-"`
+}
+
+// Participant is the identity of one participant in the wallet of a profile. Participants of another org
+// may name a peer of their org, the others connect through the peer of the profile
+type Participant struct {
+	MSPID       string `yaml:"mspID" json:"mspID"`
+	Cert        string `yaml:"cert" json:"cert"`
+	KeyDir      string `yaml:"keyDir" json:"keyDir"`
+	Endpoint    string `yaml:"peerEndpoint" json:"peerEndpoint"`
+	GatewayPeer string `yaml:"gatewayPeer" json:"gatewayPeer"`
+	TLSCACert   string `yaml:"tlsCACert" json:"tlsCACert"`
+}
+
+// Timeouts of the gRPC calls written as durations such as "15s", zero keeps the default of the gateway client
+type Timeouts struct {
+	Evaluate     time.Duration `yaml:"evaluate" json:"evaluate"`
+	Endorse      time.Duration `yaml:"endorse" json:"endorse"`
+	Submit       time.Duration `yaml:"submit" json:"submit"`
+	CommitStatus time.Duration `yaml:"commitStatus" json:"commitStatus"`
+}
+
+// File is the layout of a config file
+type File struct {
+	// Default is the profile used when none is asked for
+	Default  string             `yaml:"default" json:"default"`
+	Profiles map[string]Profile `yaml:"profiles" json:"profiles"`
+}
+
+// envOverrides maps the environment variables to the settings they override, their paths are taken as they are
+var envOverrides = []struct {
+	name    string
+	setting func(*Profile) *string
+}{
+	{"FL_MSP_ID", func(p *Profile) *string { return &p.MSPID }},
+	{"FL_PEER_ENDPOINT", func(p *Profile) *string { return &p.Endpoint }},
+	{"FL_GATEWAY_PEER", func(p *Profile) *string { return &p.GatewayPeer }},
+	{"FL_TLS_CA_CERT", func(p *Profile) *string { return &p.TLSCACert }},
+	{"FL_CERT", func(p *Profile) *string { return &p.Cert }},
+	{"FL_KEY_DIR", func(p *Profile) *string { return &p.KeyDir }},
+	{"CHANNEL_NAME", func(p *Profile) *string { return &p.Channel }},
+	{"CHAINCODE_NAME", func(p *Profile) *string { return &p.Chaincode }},
+	{"FL_PYTHON", func(p *Profile) *string { return &p.Python }},
+	{"FL_TRAIN_SCRIPT", func(p *Profile) *string { return &p.TrainScript }},
+	{"FL_LOAD_TRAIN_SCRIPT", func(p *Profile) *string { return &p.LoadTrainScript }},
+	{"FL_DATA_DIR", func(p *Profile) *string { return &p.DataDir }},
+	{"FL_TRAINER_URL", func(p *Profile) *string { return &p.TrainerURL }},
+}
+
+// Load reads the profile from the config file at path, FL_CONFIG or DefaultFile if path is empty.
+// An empty name selects FL_PROFILE or the default of the file. The environment overrides are applied and the profile is validated
+func Load(path string, name string) (*Profile, error) {
+	if path == "" {
+		path = os.Getenv("FL_CONFIG")
+	}
+	if path == "" {
+		path = DefaultFile
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	// JSON is valid YAML, so both formats go through the YAML decoder
+	var file File
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if name == "" {
+		name = os.Getenv("FL_PROFILE")
+	}
+	if name == "" {
+		name = file.Default
+	}
+	if name == "" && len(file.Profiles) == 1 {
+		for only := range file.Profiles {
+			name = only
+		}
+	}
+	profile, exists := file.Profiles[name]
+	if !exists {
+		return nil, fmt.Errorf("config file %s has no profile %q", path, name)
+	}
+	profile.Name = name
+	if profile.DataDir == "" {
+		profile.DataDir = "modelData"
+	}
+	profile.resolve(filepath.Dir(path))
+	profile.applyEnv()
+
+	err = profile.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// resolve makes the relative paths of the profile relative to dir
+func (p *Profile) resolve(dir string) {
+	for _, setting := range []*string{&p.TLSCACert, &p.Cert, &p.KeyDir, &p.TrainScript, &p.LoadTrainScript, &p.DataDir} {
+		if *setting != "" && !isAbs(*setting) {
+			*setting = filepath.Join(dir, *setting)
+		}
+	}
+	for name, participant := range p.Wallet {
+		for _, setting := range []*string{&participant.Cert, &participant.KeyDir, &participant.TLSCACert} {
+			if *setting != "" && !isAbs(*setting) {
+				*setting = filepath.Join(dir, *setting)
+			}
+		}
+		p.Wallet[name] = participant
+	}
+	// a bare interpreter name such as "python3" is looked up in PATH
+	if p.Python != "" && !isAbs(p.Python) && filepath.Base(p.Python) != p.Python {
+		p.Python = filepath.Join(dir, p.Python)
+	}
+}
+
+// isAbs also takes Windows paths such as "E:/fabric-test" as absolute, so a shared file keeps them on other systems
+func isAbs(path string) bool {
+	if filepath.IsAbs(path) {
+		return true
+	}
+	return len(path) >= 3 && path[1] == ':' && (path[2] == '/' || path[2] == '\\')
+}
+
+// applyEnv overrides the settings of the profile with the environment variables that are set
+func (p *Profile) applyEnv() {
+	for _, override := range envOverrides {
+		if value := os.Getenv(override.name); value != "" {
+			*override.setting(p) = value
+		}
+	}
+}
+
+// setting is a named value of a profile that has to be set
+type setting struct {
+	key   string
+	value string
+}
+
+// Validate reports every missing connection setting and every file of the profile that does not exist.
+// The training settings are optional, but the interpreter and scripts that are set have to exist
+func (p *Profile) Validate() error {
+	var problems []error
+	required := []setting{
+		{"mspID", p.MSPID},
+		{"peerEndpoint", p.Endpoint},
+		{"gatewayPeer", p.GatewayPeer},
+		{"tlsCACert", p.TLSCACert},
+		{"cert", p.Cert},
+		{"keyDir", p.KeyDir},
+		{"channel", p.Channel},
+		{"chaincode", p.Chaincode},
+	}
+	for _, setting := range required {
+		if setting.value == "" {
+			problems = append(problems, fmt.Errorf("%s is not set", setting.key))
+		}
+	}
+
+	files := []struct {
+		key  string
+		path string
+	}{
+		{"tlsCACert", p.TLSCACert},
+		{"cert", p.Cert},
+		{"trainScript", p.TrainScript},
+		{"loadTrainScript", p.LoadTrainScript},
+	}
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			problems = append(problems, fmt.Errorf("%s %s does not exist", file.key, file.path))
+		}
+	}
+	if p.KeyDir != "" {
+		problems = append(problems, checkKeyDir("keyDir", p.KeyDir)...)
+	}
+	if p.Python != "" {
+		if filepath.Base(p.Python) == p.Python {
+			if _, err := exec.LookPath(p.Python); err != nil {
+				problems = append(problems, fmt.Errorf("python %s is not in PATH", p.Python))
+			}
+		} else if _, err := os.Stat(p.Python); err != nil {
+			problems = append(problems, fmt.Errorf("python %s does not exist", p.Python))
+		}
+	}
+
+	names := make([]string, 0, len(p.Wallet))
+	for name := range p.Wallet {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		problems = append(problems, p.Wallet[name].validate("wallet."+name)...)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid profile %q: %w", p.Name, errors.Join(problems...))
+	}
+	return nil
+}
+
+// validate reports the missing settings and files of a participant, prefix names it in the messages
+func (p Participant) validate(prefix string) []error {
+	var problems []error
+	required := []setting{
+		{"mspID", p.MSPID},
+		{"cert", p.Cert},
+		{"keyDir", p.KeyDir},
+	}
+	if p.Endpoint != "" {
+		required = append(required, setting{"gatewayPeer", p.GatewayPeer}, setting{"tlsCACert", p.TLSCACert})
+	}
+	for _, setting := range required {
+		if setting.value == "" {
+			problems = append(problems, fmt.Errorf("%s.%s is not set", prefix, setting.key))
+		}
+	}
+	for _, file := range []string{p.Cert, p.TLSCACert} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			problems = append(problems, fmt.Errorf("%s file %s does not exist", prefix, file))
+		}
+	}
+	if p.KeyDir != "" {
+		problems = append(problems, checkKeyDir(prefix+".keyDir", p.KeyDir)...)
+	}
+	return problems
+}
+
+// checkKeyDir reports a key dir that does not exist or holds no key, a key file is taken as it is
+func checkKeyDir(key string, keyDir string) []error {
+	info, err := os.Stat(keyDir)
+	if err != nil {
+		return []error{fmt.Errorf("%s %s does not exist", key, keyDir)}
+	}
+	if info.IsDir() {
+		if entries, err := os.ReadDir(keyDir); err != nil || len(entries) == 0 {
+			return []error{fmt.Errorf("%s %s holds no private key", key, keyDir)}
+		}
+	}
+	return nil
+}
+
+// NewWallet creates the wallet of the participants of the profile, they connect with its channel, chaincode and timeouts
+func (p *Profile) NewWallet() *API.Wallet {
+	identities := make(map[string]API.WalletIdentity)
+	for name, participant := range p.Wallet {
+		identities[name] = API.WalletIdentity{
+			MSPID:       participant.MSPID,
+			CertPath:    participant.Cert,
+			KeyPath:     participant.KeyDir,
+			Endpoint:    participant.Endpoint,
+			GatewayPeer: participant.GatewayPeer,
+			TLSCertPath: participant.TLSCACert,
+		}
+	}
+	return API.NewWallet(p.ClientConfig(), identities)
+}
+
+// NewTrainer creates the trainer of the profile, the worker at TrainerURL if it is set and the training scripts otherwise
+func (p *Profile) NewTrainer() trainer.Trainer {
+	if p.TrainerURL != "" {
+		return &trainer.HTTPTrainer{URL: p.TrainerURL}
+	}
+	return &trainer.ScriptTrainer{
+		Python:          p.Python,
+		TrainScript:     p.TrainScript,
+		LoadTrainScript: p.LoadTrainScript,
+		DataDir:         p.DataDir,
+		Logger:          p.Logger,
+	}
+}
+
+// ClientConfig is the connection of the profile for API.NewClient
+func (p *Profile) ClientConfig() API.Config {
+	return API.Config{
+		Endpoint:            p.Endpoint,
+		GatewayPeer:         p.GatewayPeer,
+		MSPID:               p.MSPID,
+		CertPath:            p.Cert,
+		KeyPath:             p.KeyDir,
+		TLSCertPath:         p.TLSCACert,
+		Channel:             p.Channel,
+		Chaincode:           p.Chaincode,
+		EvaluateTimeout:     p.Timeouts.Evaluate,
+		EndorseTimeout:      p.Timeouts.Endorse,
+		SubmitTimeout:       p.Timeouts.Submit,
+		CommitStatusTimeout: p.Timeouts.CommitStatus,
+		Logger:              p.Logger,
+	}
+}
@@ -1,6 +1,17 @@
 module Capstone_go
 
-go 1.20
+go 1.22
+
+require (
+	github.com/golang/protobuf v1.5.4
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20240124143825-7dec3c7e7d45
+	github.com/hyperledger/fabric-contract-api-go v1.2.2
+	github.com/hyperledger/fabric-gateway v1.5.0
+	github.com/hyperledger/fabric-protos-go-apiv2 v0.3.3
+	github.com/klauspost/compress v1.18.0
+	google.golang.org/grpc v1.62.1
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/go-openapi/jsonpointer v0.20.3 // indirect
@@ -10,12 +21,7 @@ require (
 	github.com/gobuffalo/envy v1.10.2 // indirect
 	github.com/gobuffalo/packd v1.0.2 // indirect
 	github.com/gobuffalo/packr v1.30.1 // indirect
-	github.com/golang/protobuf v1.5.4 // indirect
-	github.com/hyperledger/fabric-chaincode-go v0.0.0-20240124143825-7dec3c7e7d45 // indirect
-	github.com/hyperledger/fabric-contract-api-go v1.2.2 // indirect
-	github.com/hyperledger/fabric-gateway v1.5.0 // indirect
 	github.com/hyperledger/fabric-protos-go v0.3.3 // indirect
-	github.com/hyperledger/fabric-protos-go-apiv2 v0.3.3 // indirect
 	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
@@ -30,7 +36,5 @@ require (
 	golang.org/x/sys v0.18.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240308144416-29370a3891b7 // indirect
-	google.golang.org/grpc v1.62.1 // indirect
 	google.golang.org/protobuf v1.33.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,476 @@
+// Package orchestrator runs the federated learning rounds of a group: it trains the users with the training scripts
+// of the profile, uploads their params through their own identities and reads back the aggregated params
+package orchestrator
+
+import (
+	"Capstone_go/API"
+	"Capstone_go/aggregator"
+	"Capstone_go/config"
+	"Capstone_go/privacy"
+	"Capstone_go/store"
+	"Capstone_go/tensor"
+	"Capstone_go/trainer"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// maxSingleUploadSize is the largest params file sent in one transaction, bigger files are uploaded in chunks
+const maxSingleUploadSize = 16 << 20
+
+// paramStorePath is the content-addressed store used by groups with off-chain storage
+const paramStorePath = "./paramStore"
+
+// secAggPath keeps the secure aggregation keys of the users, they must stay on the client
+const secAggPath = "./secaggKeys"
+
+// eventCheckpointPath keeps the position in the chaincode event stream, a restarted orchestrator resumes from it
+const eventCheckpointPath = "./events_checkpoint.json"
+
+// roundEventTimeout is how long the orchestrator waits for a round to be aggregated or to fail
+const roundEventTimeout = 10 * time.Minute
+
+// maxRoundAttempts is how often a failed round is restarted before giving up
+const maxRoundAttempts = 3
+
+// ErrRoundIncomplete is returned for a round that did not close, e.g. it failed or is still waiting for uploads
+var ErrRoundIncomplete = errors.New("round did not close")
+
+// Orchestrator runs the rounds of the groups it creates
+type Orchestrator struct {
+	client *API.Client
+	// wallet holds the identities of the users, a user without one acts through the client,
+	// whose identity also owns the groups the orchestrator creates
+	wallet *API.Wallet
+	// profile holds the data dir of this machine
+	profile *config.Profile
+
+	// GroupConfig is used to create the group before the users register,
+	// switch the rule to "median", "trimmedmean", "krum" or "multikrum" to tolerate poisoned uploads
+	// and the optimizer to "fedavgm", "fedadam" or "fedyogi" when the client data is non-IID.
+	// Set Storage to "offchain" to keep the params in paramStorePath, the group then has to use fedavg without an optimizer,
+	// or to "private" to keep them in the private data collection defined in chaincode/go_Dy/collections_config.json.
+	// Enable SecAgg to upload masked params so the chaincode only sees their sum, it also needs fedavg without an optimizer
+	GroupConfig API.GroupConfig
+	// UploadOptions sends the on-chain uploads as compact tensor containers by default,
+	// leave it empty to upload the JSON files as they are
+	UploadOptions []API.UploadOption
+	// Privacy turns on differential privacy for the uploads when set, e.g.
+	// &privacy.Config{ClipNorm: 1, NoiseMultiplier: 1.1, Delta: 1e-5, Budget: 8, AccountantDir: "./privacy"}
+	Privacy *privacy.Config
+	// Trainer trains the users, the trainer of the profile by default
+	Trainer trainer.Trainer
+	// Logger receives the progress of the rounds, the logger of the profile by default, nothing is logged when nil
+	Logger *log.Logger
+}
+
+// DefaultGroupConfig is the group config of a new orchestrator: plain fedavg once 80% of the users uploaded,
+// rounds expire after an hour
+func DefaultGroupConfig() API.GroupConfig {
+	return API.GroupConfig{
+		Aggregation: API.AggregationConfig{Rule: "fedavg"},
+		Optimizer:   API.OptimizerConfig{Name: "none"},
+		Policy:      API.GroupPolicy{MinFraction: 0.8, Mode: "eager", RoundTimeoutSeconds: 3600},
+	}
+}
+
+// New creates an orchestrator with the default group config, the wallet may be nil
+func New(client *API.Client, wallet *API.Wallet, profile *config.Profile) *Orchestrator {
+	return &Orchestrator{
+		client:        client,
+		wallet:        wallet,
+		profile:       profile,
+		GroupConfig:   DefaultGroupConfig(),
+		UploadOptions: []API.UploadOption{API.WithTensorEncoding(tensor.Float32, tensor.Zstd)},
+		Trainer:       profile.NewTrainer(),
+		Logger:        profile.Logger,
+	}
+}
+
+// logf reports the progress to the logger, if there is one
+func (o *Orchestrator) logf(format string, args ...interface{}) {
+	if o.Logger != nil {
+		o.Logger.Printf(format, args...)
+	}
+}
+
+// maxUser number is 10,depend on flower config
+// results holds the training result of each user, nil for a user whose training failed, it must be as long as userlist.
+// It is filled by TrainProcess when the users are not registered yet.
+// The error is ErrRoundIncomplete when the round did not close
+func (o *Orchestrator) RoundProcess(ctx context.Context, groupname string, userlist []string, roundid string, haveRegister bool, results []*trainer.TrainResult) error {
+	if len(userlist) > 10 {
+		return fmt.Errorf("user number exceed, %d users but at most 10", len(userlist))
+	}
+
+	//register user
+	if !haveRegister {
+		results = o.TrainProcess(ctx, userlist, "")
+		err := o.client.CreateGroup(ctx, groupname, o.GroupConfig)
+		if errors.Is(err, API.ErrAlreadyRegistered) {
+			o.logf("group %s already exists, keeping its config", groupname)
+		} else if err != nil {
+			o.logf("%v", err)
+		}
+		//the first trained user's params define the layers every upload has to match
+		for _, result := range results {
+			if result == nil {
+				continue
+			}
+			schema, err := API.SchemaFromFile(result.ParamsPath)
+			if err == nil {
+				err = o.client.RegisterModelSchema(ctx, groupname, schema)
+			}
+			if err != nil {
+				o.logf("%v", err)
+			}
+			break
+		}
+		for i := 0; i < len(userlist); i++ {
+			err := o.Register(ctx, groupname, userlist[i])
+			if errors.Is(err, API.ErrAlreadyRegistered) {
+				o.logf("user %s is already registered in group %s", userlist[i], groupname)
+			} else if err != nil {
+				o.logf("%v", err)
+			}
+		}
+	}
+	if len(results) != len(userlist) {
+		return fmt.Errorf("%d training results for %d users", len(results), len(userlist))
+	}
+
+	//the round events tell when the aggregation happened, it may not be done by the last upload
+	events, err := o.client.SubscribeRoundEvents(ctx, eventCheckpointPath)
+	if err != nil {
+		o.logf("%v", err)
+	} else {
+		defer events.Close()
+	}
+
+	//upload user model param, a round that failed for missing uploads is restarted
+	for attempt := 1; ; attempt++ {
+		if o.GroupConfig.SecAgg.Enabled {
+			o.secureRound(ctx, groupname, userlist, roundid, results)
+		} else {
+			o.uploadRound(ctx, groupname, userlist, roundid, results)
+		}
+		if events != nil {
+			o.waitForRound(ctx, events, groupname, roundid)
+		}
+		status, err := o.client.GetRoundStatus(ctx, groupname, roundid)
+		if err != nil {
+			o.logf("%v", err)
+			break
+		}
+		if status.Status == "open" && status.Deadline != 0 && time.Now().Unix() >= status.Deadline {
+			err = o.client.CloseExpiredRound(ctx, groupname, roundid)
+			if err != nil {
+				o.logf("%v", err)
+			}
+			status, err = o.client.GetRoundStatus(ctx, groupname, roundid)
+			if err != nil {
+				o.logf("%v", err)
+				break
+			}
+		}
+		if status.Status != "failed" || attempt >= maxRoundAttempts {
+			break
+		}
+		o.logf("round %s failed with %d uploads, restarting it", roundid, len(status.Uploaded))
+		err = o.client.RestartRound(ctx, groupname, roundid)
+		if err != nil {
+			o.logf("%v", err)
+			break
+		}
+	}
+
+	//params kept off chain are aggregated here once the round reached its quorum
+	if o.GroupConfig.Storage == "offchain" {
+		o.aggregateOffChain(ctx, groupname, roundid)
+	}
+
+	//get model param, masked params are meaningless on their own
+	for i := 0; i < len(userlist) && !o.GroupConfig.SecAgg.Enabled; i++ {
+		key := groupname + "_PARAM_" + userlist[i] + "_" + roundid
+		user, err := o.userClient(userlist[i])
+		if err == nil {
+			err = user.ReadUserModel_Dy(ctx, key, o.profile.DataDir)
+		}
+		if err != nil {
+			o.logf("%v", err)
+		}
+	}
+
+	//the aggregated param only exists once the round is closed
+	status, err := o.client.GetRoundStatus(ctx, groupname, roundid)
+	if err != nil {
+		return err
+	}
+	if status.Status != "closed" {
+		return fmt.Errorf("%w: round %s is %s, %d users uploaded", ErrRoundIncomplete, roundid, status.Status, len(status.Uploaded))
+	}
+	Aggrekey := groupname + "_AGGREPARAM_" + roundid
+	return o.client.ReadUserModel_Dy(ctx, Aggrekey, o.profile.DataDir)
+}
+
+// uploadRound uploads the model param of every active user and finalizes the round if the group does not aggregate at quorum
+func (o *Orchestrator) uploadRound(ctx context.Context, groupname string, userlist []string, roundid string, results []*trainer.TrainResult) {
+	active, err := o.activeMembers(ctx, groupname)
+	if err != nil {
+		o.logf("%v", err)
+	}
+	for i := 0; i < len(userlist); i++ {
+		if active != nil && !active[userlist[i]] {
+			o.logf("user %s is not an active member of group %s, skipping its upload", userlist[i], groupname)
+			continue
+		}
+		if results[i] == nil {
+			o.logf("user %s has no trained params, skipping its upload", userlist[i])
+			continue
+		}
+		user, err := o.userClient(userlist[i])
+		if err == nil {
+			err = o.Upload(ctx, user, groupname, roundid, userlist[i], *results[i])
+		}
+		if err != nil {
+			o.logf("%v", err)
+		}
+	}
+
+	if o.GroupConfig.Policy.Mode == "finalize" {
+		err = o.client.FinalizeRound(ctx, groupname, roundid)
+		if err != nil {
+			o.logf("%v", err)
+		}
+	}
+}
+
+// Upload uploads the params file of a training result the way the storage of the group config requires,
+// on-chain files bigger than maxSingleUploadSize are sent in chunks
+func (o *Orchestrator) Upload(ctx context.Context, user *API.Client, groupname string, roundid string, userId string, result trainer.TrainResult) error {
+	filePath := result.ParamsPath
+	// the options of a round must not write into the backing array of o.UploadOptions
+	options := slices.Clone(o.UploadOptions)
+	if o.Privacy != nil {
+		options = append(options, API.WithDifferentialPrivacy(*o.Privacy, o.previousGlobalParams(groupname, roundid)))
+	}
+	switch o.GroupConfig.Storage {
+	case "private":
+		return user.UploadModelParamPrivate(ctx, filePath, groupname, roundid, userId, result.NumSamples, result.LocalEpochs, options...)
+	case "offchain":
+		paramStore, err := store.NewFileStore(paramStorePath)
+		if err != nil {
+			return err
+		}
+		return user.UploadModelParamRef(ctx, filePath, groupname, roundid, userId, result.NumSamples, result.LocalEpochs, paramStore, options...)
+	}
+	if info, err := os.Stat(filePath); err == nil && info.Size() > maxSingleUploadSize {
+		return user.UploadModelParamChunked(ctx, filePath, groupname, roundid, userId, result.NumSamples, result.LocalEpochs, API.DefaultChunkSize, options...)
+	}
+	return user.UploadModelParamDy(ctx, filePath, groupname, roundid, userId, result.NumSamples, result.LocalEpochs, options...)
+}
+
+// secureRound runs the secure aggregation phases for every active user: keys, shares, masked uploads and the reveal
+// of the shares that unmask the sum. Phases the users did not all finish are ended through the group owner
+func (o *Orchestrator) secureRound(ctx context.Context, groupname string, userlist []string, roundid string, results []*trainer.TrainResult) {
+	active, err := o.activeMembers(ctx, groupname)
+	if err != nil {
+		o.logf("%v", err)
+	}
+	var users []int
+	userClients := make(map[int]*API.Client)
+	for i := 0; i < len(userlist); i++ {
+		if active != nil && !active[userlist[i]] {
+			o.logf("user %s is not an active member of group %s, skipping its upload", userlist[i], groupname)
+			continue
+		}
+		if results[i] == nil {
+			o.logf("user %s has no trained params, skipping its upload", userlist[i])
+			continue
+		}
+		user, err := o.userClient(userlist[i])
+		if err != nil {
+			o.logf("%v", err)
+			continue
+		}
+		users = append(users, i)
+		userClients[i] = user
+	}
+	options := slices.Clone(o.UploadOptions)
+	if o.Privacy != nil {
+		options = append(options, API.WithDifferentialPrivacy(*o.Privacy, o.previousGlobalParams(groupname, roundid)))
+	}
+
+	phases := []struct {
+		name string
+		run  func(i int) error
+	}{
+		{"keys", func(i int) error {
+			return userClients[i].SecAggAdvertiseKeys(ctx, groupname, roundid, userlist[i], secAggPath)
+		}},
+		{"shares", func(i int) error {
+			return userClients[i].SecAggShareKeys(ctx, groupname, roundid, userlist[i], secAggPath)
+		}},
+	}
+	for _, phase := range phases {
+		for _, i := range users {
+			err = phase.run(i)
+			if err != nil {
+				o.logf("%v", err)
+			}
+		}
+		state, err := o.client.GetSecAggRound(ctx, groupname, roundid)
+		if err != nil {
+			o.logf("%v", err)
+			return
+		}
+		if state.Phase == phase.name {
+			err = o.client.AdvanceSecAgg(ctx, groupname, roundid)
+			if err != nil {
+				o.logf("%v", err)
+				return
+			}
+		}
+	}
+
+	for _, i := range users {
+		err = userClients[i].UploadMaskedParam(ctx, results[i].ParamsPath, groupname, roundid, userlist[i], results[i].NumSamples, results[i].LocalEpochs, secAggPath, options...)
+		if err != nil {
+			o.logf("%v", err)
+		}
+	}
+	if o.GroupConfig.Policy.Mode == "finalize" {
+		err = o.client.FinalizeRound(ctx, groupname, roundid)
+		if err != nil {
+			o.logf("%v", err)
+		}
+	}
+
+	for _, i := range users {
+		state, err := o.client.GetSecAggRound(ctx, groupname, roundid)
+		if err != nil {
+			o.logf("%v", err)
+			return
+		}
+		if state.Phase != "unmask" {
+			return
+		}
+		if !slices.Contains(state.Survivors, userlist[i]) {
+			continue
+		}
+		err = userClients[i].SecAggReveal(ctx, groupname, roundid, userlist[i], secAggPath)
+		if err != nil {
+			o.logf("%v", err)
+		}
+	}
+}
+
+// waitForRound blocks until the round is aggregated or fails, groups with off-chain storage only wait for the quorum
+// because their aggregate is computed by the orchestrator afterwards
+func (o *Orchestrator) waitForRound(ctx context.Context, events *API.EventSubscription, groupname string, roundid string) {
+	ctx, cancel := context.WithTimeout(ctx, roundEventTimeout)
+	defer cancel()
+	names := []string{API.EventRoundAggregated, API.EventRoundFailed}
+	if o.GroupConfig.Storage == "offchain" {
+		names = []string{API.EventQuorumReached, API.EventRoundFailed}
+	}
+	event, err := events.WaitForRound(ctx, groupname, roundid, names...)
+	if err != nil {
+		o.logf("%v", err)
+		return
+	}
+	o.logf("round %s of group %s: %s with %d uploads", roundid, groupname, event.Event, event.Uploaded)
+}
+
+// previousGlobalParams loads the aggregated params of the previous round saved by RoundProcess, nil in the first round
+func (o *Orchestrator) previousGlobalParams(groupname string, roundid string) map[string]interface{} {
+	round, err := strconv.Atoi(roundid)
+	if err != nil || round == 0 {
+		return nil
+	}
+	params, err := API.LoadParamsFile(filepath.Join(o.profile.DataDir, fmt.Sprintf("%s_AGGREPARAM_%d_Dy.json", groupname, round-1)))
+	if err != nil {
+		o.logf("%v", err)
+		return nil
+	}
+	return params
+}
+
+// aggregateOffChain runs the off-chain aggregator for a round waiting for its aggregate
+func (o *Orchestrator) aggregateOffChain(ctx context.Context, groupname string, roundid string) {
+	status, err := o.client.GetRoundStatus(ctx, groupname, roundid)
+	if err != nil {
+		o.logf("%v", err)
+		return
+	}
+	if status.Status != "aggregating" {
+		return
+	}
+	paramStore, err := store.NewFileStore(paramStorePath)
+	if err != nil {
+		o.logf("%v", err)
+		return
+	}
+	_, err = aggregator.FedAvg(ctx, o.client, groupname, roundid, paramStore)
+	if err != nil {
+		o.logf("%v", err)
+	}
+}
+
+// Register adds the user to the group through the group owner, bound to the user's wallet identity if it has one
+// and to the identity of the owner otherwise
+func (o *Orchestrator) Register(ctx context.Context, groupname string, userId string) error {
+	if o.wallet == nil || !o.wallet.Has(userId) {
+		return o.client.RegisterUser(ctx, groupname, userId)
+	}
+	config, err := o.wallet.Config(userId)
+	if err != nil {
+		return err
+	}
+	return o.client.AddUser(ctx, groupname, userId, config.MSPID, config.CertPath)
+}
+
+// userClient returns the client of the user's identity in the wallet, or the client of the profile if the user has none
+func (o *Orchestrator) userClient(userId string) (*API.Client, error) {
+	if o.wallet == nil || !o.wallet.Has(userId) {
+		return o.client, nil
+	}
+	return o.wallet.Client(userId)
+}
+
+// activeMembers returns the users of the group that are not suspended
+func (o *Orchestrator) activeMembers(ctx context.Context, groupname string) (map[string]bool, error) {
+	members, err := o.client.GetGroupMembers(ctx, groupname)
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[string]bool)
+	for _, member := range members.Members {
+		if member.Status != "suspended" {
+			active[member.UserID] = true
+		}
+	}
+	return active, nil
+}
+
+// TotalProcess trains the users and runs roundNum rounds, after each round the users train on the aggregated params.
+// It stops at the first round that does not close
+func (o *Orchestrator) TotalProcess(ctx context.Context, groupname string, userlist []string, roundNum int) error {
+	var results []*trainer.TrainResult
+	for i := 0; i < roundNum; i++ {
+		err := o.RoundProcess(ctx, groupname, userlist, fmt.Sprintf("%d", i), i != 0, results)
+		if err != nil {
+			return err
+		}
+		//load aggre param , train data and save model param
+		Aggrekey := groupname + "_AGGREPARAM_" + fmt.Sprintf("%d", i)
+		results = o.TrainProcess(ctx, userlist, filepath.Join(o.profile.DataDir, Aggrekey+"_Dy.json"))
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package orchestrator
+
+import (
+	"Capstone_go/trainer"
+	"context"
+	"sync"
+)
+
+// TrainProcess trains every user with the trainer, the user at index i trains on data part i starting from
+// initialParamsPath, empty for a fresh model. A user whose training failed or whose result is missing or does not
+// match its params has a nil result and sits the round out
+func (o *Orchestrator) TrainProcess(ctx context.Context, userlist []string, initialParamsPath string) []*trainer.TrainResult {
+	results := make([]*trainer.TrainResult, len(userlist))
+	var wg sync.WaitGroup
+	//train data and save model param
+	for i := 0; i < len(userlist); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := o.Trainer.Train(ctx, initialParamsPath, i)
+			if err == nil {
+				err = result.Validate()
+			}
+			if err != nil {
+				o.logf("training of user %s failed: %v", userlist[i], err)
+				return
+			}
+			o.logf("user %s trained on %d samples, loss %.4f, accuracy %.4f", userlist[i], result.NumSamples, result.Loss, result.Accuracy)
+			results[i] = &result
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
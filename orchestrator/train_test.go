@@ -0,0 +1,141 @@
+package orchestrator
+
+import (
+	"Capstone_go/trainer"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// flakyTrainer fails the clients in fail and corrupts the params of the clients in corrupt after training them
+type flakyTrainer struct {
+	trainer.Trainer
+	fail    map[int]bool
+	corrupt map[int]bool
+}
+
+func (t *flakyTrainer) Train(ctx context.Context, initialParamsPath string, clientIndex int) (trainer.TrainResult, error) {
+	if t.fail[clientIndex] {
+		return trainer.TrainResult{}, errors.New("training diverged")
+	}
+	result, err := t.Trainer.Train(ctx, initialParamsPath, clientIndex)
+	if err == nil && t.corrupt[clientIndex] {
+		err = os.WriteFile(result.ParamsPath, []byte(`{"fc.bias": [0]}`), 0644)
+	}
+	return result, err
+}
+
+func TestTrainProcess(t *testing.T) {
+	layers := map[string][]int{"fc.weight": {2, 3}, "fc.bias": {2}}
+	tests := []struct {
+		name    string
+		users   []string
+		fail    map[int]bool
+		corrupt map[int]bool
+		trained []bool
+	}{
+		{name: "all users train", users: []string{"a", "b", "c"}, trained: []bool{true, true, true}},
+		{name: "no users", users: nil, trained: []bool{}},
+		{name: "failed training sits out", users: []string{"a", "b", "c"}, fail: map[int]bool{1: true}, trained: []bool{true, false, true}},
+		{name: "params not matching the checksum sit out", users: []string{"a", "b"}, corrupt: map[int]bool{0: true}, trained: []bool{false, true}},
+		{name: "every training failed", users: []string{"a", "b"}, fail: map[int]bool{0: true, 1: true}, trained: []bool{false, false}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &trainer.FakeTrainer{Dir: t.TempDir(), Layers: layers, NumSamples: 4}
+			o := &Orchestrator{Trainer: &flakyTrainer{Trainer: fake, fail: test.fail, corrupt: test.corrupt}}
+			results := o.TrainProcess(context.Background(), test.users, "")
+			if len(results) != len(test.users) {
+				t.Fatalf("got %d results for %d users", len(results), len(test.users))
+			}
+			for i, result := range results {
+				if (result != nil) != test.trained[i] {
+					t.Fatalf("result of user %s = %+v, trained %v", test.users[i], result, test.trained[i])
+				}
+				if result == nil {
+					continue
+				}
+				if result.NumSamples != 4 || result.Validate() != nil {
+					t.Fatalf("result of user %s = %+v is not valid", test.users[i], result)
+				}
+			}
+		})
+	}
+}
+
+func TestTrainProcessFromAggregate(t *testing.T) {
+	dir := t.TempDir()
+	o := &Orchestrator{Trainer: &trainer.FakeTrainer{Dir: dir, Layers: map[string][]int{"fc.bias": {2}}}}
+	users := []string{"a", "b"}
+	first := o.TrainProcess(context.Background(), users, "")
+
+	aggregatePath := filepath.Join(dir, "aggregate.json")
+	err := os.WriteFile(aggregatePath, []byte(`{"fc.bias": [0, 0]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := o.TrainProcess(context.Background(), users, aggregatePath)
+	for i := range users {
+		if first[i] == nil || second[i] == nil {
+			t.Fatalf("user %s did not train", users[i])
+		}
+		if second[i].Loss >= first[i].Loss {
+			t.Fatalf("loss of user %s went from %v to %v, want it to fall", users[i], first[i].Loss, second[i].Loss)
+		}
+		data, err := os.ReadFile(second[i].ParamsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var params map[string][]float64
+		err = json.Unmarshal(data, &params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the fake trainer moves the aggregate half way to (i+1)/10
+		want := float64(i+1) / 20
+		if got := params["fc.bias"]; len(got) != 2 || got[0] != want {
+			t.Fatalf("params of user %s = %v, want %v", users[i], got, want)
+		}
+	}
+}
+
+func TestTrainProcessCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	o := &Orchestrator{Trainer: &trainer.FakeTrainer{Dir: t.TempDir()}}
+	for i, result := range o.TrainProcess(ctx, []string{"a", "b"}, "") {
+		if result != nil {
+			t.Fatalf("user %d trained after the context was canceled", i)
+		}
+	}
+}
+
+func TestRoundProcessChecksResults(t *testing.T) {
+	fake := &trainer.FakeTrainer{Dir: t.TempDir(), Layers: map[string][]int{"fc.bias": {2}}}
+	o := &Orchestrator{Trainer: fake}
+	users := []string{"a", "b", "c"}
+	results := o.TrainProcess(context.Background(), users, "")
+
+	tests := []struct {
+		name    string
+		users   []string
+		results []*trainer.TrainResult
+	}{
+		{"fewer results than users", users, results[:2]},
+		{"more results than users", users[:2], results},
+		{"no results", users, nil},
+		{"too many users", []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"}, results},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the checks fail the round before it reaches the network, so the orchestrator has no client
+			err := o.RoundProcess(context.Background(), "group", test.users, "0", true, test.results)
+			if err == nil {
+				t.Fatal("RoundProcess() = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package privacy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// ErrBudgetExceeded is returned when an upload would spend more than the privacy budget
+var ErrBudgetExceeded = errors.New("the privacy budget is exceeded")
+
+// orders are the Rényi orders the epsilon is optimized over
+var orders = func() []float64 {
+	var result []float64
+	for alpha := 2; alpha <= 64; alpha++ {
+		result = append(result, float64(alpha))
+	}
+	return append(result, 80, 96, 128, 192, 256, 512)
+}()
+
+// Step is one noised upload
+type Step struct {
+	GroupName       string  `json:"groupName"`
+	RoundID         string  `json:"roundID"`
+	NoiseMultiplier float64 `json:"noiseMultiplier"`
+	SampleRate      float64 `json:"sampleRate"`
+}
+
+// Accountant tracks the steps of a user, it is persisted as JSON in its file
+type Accountant struct {
+	UserID string `json:"userID"`
+	Steps  []Step `json:"steps"`
+	path   string
+}
+
+// LoadAccountant reads the accountant of the user from dir, a user without a file starts with no steps
+func LoadAccountant(dir string, userID string) (*Accountant, error) {
+	accountant := &Accountant{UserID: userID, Steps: []Step{}, path: filepath.Join(dir, userID+"_accountant.json")}
+	data, err := os.ReadFile(accountant.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return accountant, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read privacy accountant: %w", err)
+	}
+	err = json.Unmarshal(data, accountant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal privacy accountant: %w", err)
+	}
+	return accountant, nil
+}
+
+// Epsilon returns the epsilon spent by the steps for the given delta
+func (a *Accountant) Epsilon(delta float64) float64 {
+	return epsilon(a.Steps, delta)
+}
+
+// Spend records the step if the epsilon after it stays within the budget and persists the accountant.
+// The step is recorded before the upload, an upload that fails afterwards still counts
+func (a *Accountant) Spend(step Step, config Config) (float64, error) {
+	for _, recorded := range a.Steps {
+		if recorded.GroupName == step.GroupName && recorded.RoundID == step.RoundID {
+			return 0, fmt.Errorf("%w: user %s already released noised params for round %s of group %s", ErrBudgetExceeded, a.UserID, step.RoundID, step.GroupName)
+		}
+	}
+	spent := epsilon(append(append([]Step{}, a.Steps...), step), config.Delta)
+	if spent > config.Budget {
+		return spent, fmt.Errorf("%w: user %s would reach epsilon %.4f, the budget is %.4f", ErrBudgetExceeded, a.UserID, spent, config.Budget)
+	}
+
+	a.Steps = append(a.Steps, step)
+	err := a.save()
+	if err != nil {
+		a.Steps = a.Steps[:len(a.Steps)-1]
+		return 0, err
+	}
+	return spent, nil
+}
+
+func (a *Accountant) save() error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(a.path), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create privacy accountant directory: %w", err)
+	}
+	tmp := a.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write privacy accountant: %w", err)
+	}
+	return os.Rename(tmp, a.path)
+}
+
+// epsilon composes the RDP of the steps and converts it to (epsilon, delta)-DP at the best order
+func epsilon(steps []Step, delta float64) float64 {
+	if len(steps) == 0 {
+		return 0
+	}
+	best := math.Inf(1)
+	for _, alpha := range orders {
+		rdp := 0.0
+		for _, step := range steps {
+			rdp += gaussianRDP(step.SampleRate, step.NoiseMultiplier, alpha)
+		}
+		eps := rdp + math.Log(1/delta)/(alpha-1)
+		if eps < best {
+			best = eps
+		}
+	}
+	return best
+}
+
+// gaussianRDP is the RDP at integer order alpha of the Gaussian mechanism with noise multiplier sigma, subsampled with rate q.
+// Without subsampling it is alpha/(2 sigma^2), otherwise the binomial expansion of Mironov et al. is summed in log space
+func gaussianRDP(q float64, sigma float64, alpha float64) float64 {
+	if q >= 1 {
+		return alpha / (2 * sigma * sigma)
+	}
+	if q <= 0 {
+		return 0
+	}
+
+	n := int(alpha)
+	logA := math.Inf(-1)
+	for k := 0; k <= n; k++ {
+		logBinomial := lgamma(float64(n)+1) - lgamma(float64(k)+1) - lgamma(float64(n-k)+1)
+		term := logBinomial + float64(k)*math.Log(q) + float64(n-k)*math.Log1p(-q) + float64(k*k-k)/(2*sigma*sigma)
+		logA = logAdd(logA, term)
+	}
+	return logA / (alpha - 1)
+}
+
+func lgamma(x float64) float64 {
+	value, _ := math.Lgamma(x)
+	return value
+}
+
+func logAdd(a float64, b float64) float64 {
+	if math.IsInf(a, -1) {
+		return b
+	}
+	if math.IsInf(b, -1) {
+		return a
+	}
+	if a < b {
+		a, b = b, a
+	}
+	return a + math.Log1p(math.Exp(b-a))
+}
@@ -0,0 +1,115 @@
+package privacy
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestGaussianRDP(t *testing.T) {
+	tests := []struct {
+		name  string
+		q     float64
+		sigma float64
+		alpha float64
+		want  float64
+	}{
+		// without subsampling the RDP of the Gaussian mechanism is alpha/(2 sigma^2)
+		{"full batch", 1, 1, 2, 1},
+		{"full batch sigma 2", 1, 2, 8, 1},
+		{"no sampling", 0, 1, 8, 0},
+		// at order 2 the binomial expansion is log(1 + q^2 (e^(1/sigma^2) - 1))
+		{"subsampled order 2", 0.1, 1, 2, math.Log1p(0.01 * (math.E - 1))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := gaussianRDP(test.q, test.sigma, test.alpha); math.Abs(got-test.want) > 1e-9 {
+				t.Fatalf("gaussianRDP(%v, %v, %v) = %v, want %v", test.q, test.sigma, test.alpha, got, test.want)
+			}
+		})
+	}
+
+	// subsampling amplifies privacy
+	for _, alpha := range []float64{2, 8, 32} {
+		if full, sampled := gaussianRDP(1, 1.1, alpha), gaussianRDP(0.01, 1.1, alpha); sampled >= full {
+			t.Errorf("order %v: subsampled RDP %v is not below the full RDP %v", alpha, sampled, full)
+		}
+	}
+}
+
+func TestEpsilon(t *testing.T) {
+	const delta = 1e-5
+	if got := epsilon(nil, delta); got != 0 {
+		t.Fatalf("epsilon of no steps = %v, want 0", got)
+	}
+
+	step := Step{NoiseMultiplier: 1, SampleRate: 1}
+	// one full batch step: the best order of alpha/2 + log(1/delta)/(alpha-1)
+	want := math.Inf(1)
+	for _, alpha := range orders {
+		want = math.Min(want, alpha/2+math.Log(1/delta)/(alpha-1))
+	}
+	if got := epsilon([]Step{step}, delta); math.Abs(got-want) > 1e-9 {
+		t.Fatalf("epsilon of one step = %v, want %v", got, want)
+	}
+
+	previous := 0.0
+	steps := []Step{}
+	for i := 0; i < 5; i++ {
+		steps = append(steps, step)
+		spent := epsilon(steps, delta)
+		if spent <= previous {
+			t.Fatalf("epsilon after %d steps = %v, not above %v", len(steps), spent, previous)
+		}
+		previous = spent
+	}
+	if noisier := epsilon([]Step{{NoiseMultiplier: 4, SampleRate: 1}}, delta); noisier >= epsilon([]Step{step}, delta) {
+		t.Fatalf("more noise spent epsilon %v, not below %v", noisier, epsilon([]Step{step}, delta))
+	}
+}
+
+func TestAccountantSpend(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{ClipNorm: 1, NoiseMultiplier: 2, SampleRate: 1, Delta: 1e-5, Budget: 5, AccountantDir: dir}
+	accountant, err := LoadAccountant(dir, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := accountant.Spend(Step{GroupName: "g", RoundID: "0", NoiseMultiplier: 2, SampleRate: 1}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first <= 0 || first > config.Budget {
+		t.Fatalf("first step spent %v, want it in (0, %v]", first, config.Budget)
+	}
+
+	_, err = accountant.Spend(Step{GroupName: "g", RoundID: "0", NoiseMultiplier: 2, SampleRate: 1}, config)
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("second release of a round = %v, want ErrBudgetExceeded", err)
+	}
+
+	// the steps are persisted, a new accountant of the user picks them up
+	reloaded, err := LoadAccountant(dir, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.Steps) != 1 || reloaded.Epsilon(config.Delta) != first {
+		t.Fatalf("reloaded accountant has %d steps and epsilon %v, want 1 and %v", len(reloaded.Steps), reloaded.Epsilon(config.Delta), first)
+	}
+
+	var spent float64
+	round := 1
+	for ; round < 100; round++ {
+		spent, err = reloaded.Spend(Step{GroupName: "g", RoundID: strconv.Itoa(round), NoiseMultiplier: 2, SampleRate: 1}, config)
+		if err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrBudgetExceeded) || spent <= config.Budget {
+		t.Fatalf("spending past the budget = %v, %v, want ErrBudgetExceeded above %v", spent, err, config.Budget)
+	}
+	if len(reloaded.Steps) != round {
+		t.Fatalf("the refused step was recorded, %d steps after %d rounds", len(reloaded.Steps), round)
+	}
+}
@@ -0,0 +1,176 @@
+// Package privacy adds differential privacy to the client upload path.
+// The update of a client, its params minus the previous global params, is clipped to an L2 norm bound
+// and Gaussian noise calibrated to that bound is added before the params leave the client.
+// An accountant kept on the client's disk tracks the privacy spent across rounds with Rényi DP
+package privacy
+
+import (
+	crand "crypto/rand"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// Config holds the privacy settings of a client
+type Config struct {
+	// ClipNorm bounds the L2 norm of the update
+	ClipNorm float64 `json:"clipNorm"`
+	// NoiseMultiplier is the standard deviation of the noise relative to ClipNorm
+	NoiseMultiplier float64 `json:"noiseMultiplier"`
+	// SampleRate is the probability that the client takes part in a round, 1 when it takes part in every round
+	SampleRate float64 `json:"sampleRate,omitempty"`
+	// Delta is the delta of the reported (epsilon, delta) guarantee
+	Delta float64 `json:"delta"`
+	// Budget is the largest epsilon the client may spend, uploads beyond it are refused
+	Budget float64 `json:"budget"`
+	// AccountantDir is where the accountant of every user is persisted
+	AccountantDir string `json:"accountantDir"`
+}
+
+// Validate checks the config and fills in the defaults
+func (c *Config) Validate() error {
+	if c.SampleRate == 0 {
+		c.SampleRate = 1
+	}
+	if c.AccountantDir == "" {
+		c.AccountantDir = "./privacy"
+	}
+	if c.ClipNorm <= 0 {
+		return fmt.Errorf("the clip norm must be positive, got %v", c.ClipNorm)
+	}
+	if c.NoiseMultiplier <= 0 {
+		return fmt.Errorf("the noise multiplier must be positive, got %v", c.NoiseMultiplier)
+	}
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("the sample rate must be in (0, 1], got %v", c.SampleRate)
+	}
+	if c.Delta <= 0 || c.Delta >= 1 {
+		return fmt.Errorf("delta must be in (0, 1), got %v", c.Delta)
+	}
+	if c.Budget <= 0 {
+		return fmt.Errorf("the budget must be positive, got %v", c.Budget)
+	}
+	return nil
+}
+
+// Privatize clips the update of params against global to ClipNorm and adds Gaussian noise with standard deviation NoiseMultiplier*ClipNorm.
+// A nil global counts the whole params as the update, e.g. in the first round. It returns the new params and the norm of the update before clipping
+func Privatize(params map[string]interface{}, global map[string]interface{}, config Config) (map[string]interface{}, float64, error) {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// the update is computed once to get its norm, then clipped and noised
+	squaredNorm := 0.0
+	for _, name := range names {
+		var reference interface{}
+		if global != nil {
+			var exists bool
+			reference, exists = global[name]
+			if !exists {
+				return nil, 0, fmt.Errorf("the global params have no tensor %s", name)
+			}
+		}
+		err := walk(params[name], reference, name, func(value float64, base float64) float64 {
+			squaredNorm += (value - base) * (value - base)
+			return value
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	norm := math.Sqrt(squaredNorm)
+	scale := 1.0
+	if norm > config.ClipNorm {
+		scale = config.ClipNorm / norm
+	}
+
+	rng, err := newRand()
+	if err != nil {
+		return nil, 0, err
+	}
+	stddev := config.NoiseMultiplier * config.ClipNorm
+	result := make(map[string]interface{}, len(params))
+	for _, name := range names {
+		var reference interface{}
+		if global != nil {
+			reference = global[name]
+		}
+		value := deepCopy(params[name])
+		err := walk(value, reference, name, func(value float64, base float64) float64 {
+			return base + (value-base)*scale + rng.NormFloat64()*stddev
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		result[name] = value
+	}
+	return result, norm, nil
+}
+
+// walk calls f for every number of value with the number at the same position of reference, 0 without reference.
+// Lists are changed in place with the results of f
+func walk(value interface{}, reference interface{}, name string, f func(float64, float64) float64) error {
+	list, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("tensor %s is not a list", name)
+	}
+	var referenceList []interface{}
+	if reference != nil {
+		referenceList, ok = reference.([]interface{})
+		if !ok || len(referenceList) != len(list) {
+			return fmt.Errorf("tensor %s does not match the shape of the global params", name)
+		}
+	}
+	for i, item := range list {
+		var base interface{}
+		if referenceList != nil {
+			base = referenceList[i]
+		}
+		switch v := item.(type) {
+		case float64:
+			baseValue := 0.0
+			if base != nil {
+				number, ok := base.(float64)
+				if !ok {
+					return fmt.Errorf("tensor %s does not match the shape of the global params", name)
+				}
+				baseValue = number
+			}
+			list[i] = f(v, baseValue)
+		case []interface{}:
+			err := walk(v, base, name, f)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("tensor %s has a non-numeric value", name)
+		}
+	}
+	return nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	copied := make([]interface{}, len(list))
+	for i, item := range list {
+		copied[i] = deepCopy(item)
+	}
+	return copied
+}
+
+// newRand seeds a ChaCha8 generator from the operating system, the noise must not be predictable
+func newRand() (*rand.Rand, error) {
+	var seed [32]byte
+	_, err := crand.Read(seed[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to seed the noise generator: %w", err)
+	}
+	return rand.New(rand.NewChaCha8(seed)), nil
+}
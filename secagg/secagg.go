@@ -0,0 +1,331 @@
+// Package secagg implements the cryptography of secure aggregation with pairwise additive masks (Bonawitz et al., CCS 2017).
+//
+// Every client advertises two X25519 public keys, one to encrypt the shares it sends and one to agree on mask seeds.
+// It Shamir-shares the private mask key and a random self-mask seed with the other clients, then uploads its
+// fixed-point update plus the self mask plus the pairwise masks, which cancel in the sum. To unmask, the surviving
+// clients reveal the self-mask shares of the survivors and the mask key shares of the clients that dropped out,
+// so the pairwise masks of dropped clients can be recomputed and removed.
+package secagg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// FractionBits is the fixed-point precision of the masked values
+const FractionBits = 24
+
+// prime is the Mersenne prime 2^521 - 1, the Shamir field is large enough for 32 byte secrets
+var prime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 521), big.NewInt(1))
+
+// KeyPair is an X25519 key pair
+type KeyPair struct {
+	Private []byte `json:"private"`
+	Public  []byte `json:"public"`
+}
+
+// GenerateKeyPair creates a random X25519 key pair
+func GenerateKeyPair() (KeyPair, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("failed to generate key pair: %w", err)
+	}
+	return KeyPair{Private: key.Bytes(), Public: key.PublicKey().Bytes()}, nil
+}
+
+// PublicKey derives the public key of an X25519 private key
+func PublicKey(private []byte) ([]byte, error) {
+	key, err := ecdh.X25519().NewPrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return key.PublicKey().Bytes(), nil
+}
+
+// agree runs X25519 and hashes the shared secret with the purpose label
+func agree(private []byte, peerPublic []byte, label string) ([]byte, error) {
+	key, err := ecdh.X25519().NewPrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	peer, err := ecdh.X25519().NewPublicKey(peerPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	secret, err := key.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to agree on a key: %w", err)
+	}
+	sum := sha256.Sum256(append([]byte(label), secret...))
+	return sum[:], nil
+}
+
+// PairSeed is the mask seed two clients agree on with their mask keys
+func PairSeed(private []byte, peerPublic []byte) ([]byte, error) {
+	return agree(private, peerPublic, "secagg pairwise mask")
+}
+
+// NewSeed returns a random 32 byte self-mask seed
+func NewSeed() ([]byte, error) {
+	seed := make([]byte, 32)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate seed: %w", err)
+	}
+	return seed, nil
+}
+
+// AddMask adds sign times the mask expanded from seed to vector, modulo 2^64.
+// The mask is the AES-256-CTR keystream of the seed with a zero IV
+func AddMask(vector []uint64, seed []byte, sign int) error {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return fmt.Errorf("invalid seed: %w", err)
+	}
+	stream := cipher.NewCTR(block, make([]byte, aes.BlockSize))
+	buffer := make([]byte, 8*len(vector))
+	stream.XORKeyStream(buffer, buffer)
+	for i := range vector {
+		mask := binary.LittleEndian.Uint64(buffer[8*i:])
+		if sign < 0 {
+			vector[i] -= mask
+		} else {
+			vector[i] += mask
+		}
+	}
+	return nil
+}
+
+// Encode scales the values by weight and encodes them as fixed-point numbers in the ring of 2^64.
+// The sum of the encodings of clients clients only decodes right if it does not wrap, so every client
+// keeps clients·|value·weight| below 2^(63-FractionBits), then no sum of at most clients values can wrap
+func Encode(values []float64, weight float64, clients int) ([]uint64, error) {
+	if clients < 1 {
+		return nil, fmt.Errorf("the number of clients must be positive, got %d", clients)
+	}
+	encoded := make([]uint64, len(values))
+	limit := math.Ldexp(1, 63-FractionBits) / float64(clients)
+	for i, value := range values {
+		scaled := value * weight
+		if math.IsNaN(scaled) || math.Abs(scaled) >= limit {
+			return nil, fmt.Errorf("value %v at index %d with weight %v can not be summed over %d clients", value, i, weight, clients)
+		}
+		encoded[i] = uint64(int64(math.Round(math.Ldexp(scaled, FractionBits))))
+	}
+	return encoded, nil
+}
+
+// Decode turns a sum of encoded values back into floats divided by the total weight
+func Decode(sum []uint64, totalWeight float64) []float64 {
+	decoded := make([]float64, len(sum))
+	for i, value := range sum {
+		decoded[i] = math.Ldexp(float64(int64(value)), -FractionBits) / totalWeight
+	}
+	return decoded
+}
+
+// Share is a Shamir share of a secret, X is the 1-based index of the receiving client
+type Share struct {
+	X int    `json:"x"`
+	Y string `json:"y"`
+}
+
+// Split shares the secret among n clients so that any t of them can recover it
+func Split(secret []byte, n int, t int) ([]Share, error) {
+	if t < 1 || t > n {
+		return nil, fmt.Errorf("the threshold must be in [1, %d], got %d", n, t)
+	}
+	coefficients := []*big.Int{new(big.Int).SetBytes(secret)}
+	for i := 1; i < t; i++ {
+		coefficient, err := rand.Int(rand.Reader, prime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate a share: %w", err)
+		}
+		coefficients = append(coefficients, coefficient)
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		x := big.NewInt(int64(i + 1))
+		y := new(big.Int)
+		for j := len(coefficients) - 1; j >= 0; j-- {
+			y.Mul(y, x)
+			y.Add(y, coefficients[j])
+			y.Mod(y, prime)
+		}
+		shares[i] = Share{X: i + 1, Y: y.Text(16)}
+	}
+	return shares, nil
+}
+
+// Combine recovers a secret of size bytes from at least the threshold of distinct shares
+func Combine(shares []Share, size int) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no shares to combine")
+	}
+	xs := make([]*big.Int, len(shares))
+	ys := make([]*big.Int, len(shares))
+	for i, share := range shares {
+		y, ok := new(big.Int).SetString(share.Y, 16)
+		if !ok || share.X <= 0 {
+			return nil, fmt.Errorf("invalid share %d", share.X)
+		}
+		for j := 0; j < i; j++ {
+			if shares[j].X == share.X {
+				return nil, fmt.Errorf("share %d appears twice", share.X)
+			}
+		}
+		xs[i] = big.NewInt(int64(share.X))
+		ys[i] = y
+	}
+
+	// Lagrange interpolation at 0
+	secret := new(big.Int)
+	for i := range shares {
+		numerator := big.NewInt(1)
+		denominator := big.NewInt(1)
+		for j := range shares {
+			if i == j {
+				continue
+			}
+			numerator.Mul(numerator, new(big.Int).Neg(xs[j]))
+			numerator.Mod(numerator, prime)
+			denominator.Mul(denominator, new(big.Int).Sub(xs[i], xs[j]))
+			denominator.Mod(denominator, prime)
+		}
+		term := new(big.Int).Mul(ys[i], numerator)
+		term.Mul(term, new(big.Int).ModInverse(denominator, prime))
+		secret.Add(secret, term)
+		secret.Mod(secret, prime)
+	}
+	if secret.BitLen() > 8*size {
+		return nil, fmt.Errorf("the shares do not combine to a %d byte secret", size)
+	}
+	return secret.FillBytes(make([]byte, size)), nil
+}
+
+// SharePair is what a client sends to another client: its shares of the mask key and of the self-mask seed
+type SharePair struct {
+	MaskKey  Share `json:"maskKey"`
+	SelfSeed Share `json:"selfSeed"`
+}
+
+// EncryptShares encrypts the shares for the receiver with AES-GCM under a key agreed with the share keys,
+// aad binds the ciphertext to the group, round, sender and receiver
+func EncryptShares(private []byte, peerPublic []byte, aad string, pair SharePair) (string, error) {
+	key, err := agree(private, peerPublic, "secagg share encryption")
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := json.Marshal(pair)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	ciphertext := aead.Seal(nonce, nonce, plaintext, []byte(aad))
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptShares opens shares encrypted by EncryptShares
+func DecryptShares(private []byte, peerPublic []byte, aad string, encrypted string) (SharePair, error) {
+	key, err := agree(private, peerPublic, "secagg share encryption")
+	if err != nil {
+		return SharePair{}, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return SharePair{}, fmt.Errorf("failed to decode shares: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return SharePair{}, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return SharePair{}, fmt.Errorf("the encrypted shares are truncated")
+	}
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], []byte(aad))
+	if err != nil {
+		return SharePair{}, fmt.Errorf("failed to decrypt shares: %w", err)
+	}
+	var pair SharePair
+	err = json.Unmarshal(plaintext, &pair)
+	if err != nil {
+		return SharePair{}, fmt.Errorf("failed to unmarshal shares: %w", err)
+	}
+	return pair, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ShareAAD is the associated data of the shares sent from one client to another in a round
+func ShareAAD(groupname string, roundID string, from string, to string) string {
+	return groupname + "|" + roundID + "|" + from + "|" + to
+}
+
+// TensorSpec is the name and shape of a tensor in a masked vector
+type TensorSpec struct {
+	Name  string `json:"name"`
+	Shape []int  `json:"shape"`
+}
+
+// MaskedVector is a masked upload, the values of the tensors in layout order as base64 encoded little-endian uint64
+type MaskedVector struct {
+	Layout []TensorSpec `json:"layout"`
+	Values string       `json:"values"`
+}
+
+// Pack encodes masked values
+func Pack(layout []TensorSpec, values []uint64) MaskedVector {
+	data := make([]byte, 8*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint64(data[8*i:], value)
+	}
+	return MaskedVector{Layout: layout, Values: base64.StdEncoding.EncodeToString(data)}
+}
+
+// Unpack decodes masked values and checks them against the layout
+func (m MaskedVector) Unpack() ([]uint64, error) {
+	data, err := base64.StdEncoding.DecodeString(m.Values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode masked values: %w", err)
+	}
+	size := 0
+	for _, spec := range m.Layout {
+		count := 1
+		for _, dim := range spec.Shape {
+			count *= dim
+		}
+		size += count
+	}
+	if len(data) != 8*size {
+		return nil, fmt.Errorf("the masked values have %d bytes, the layout needs %d", len(data), 8*size)
+	}
+	values := make([]uint64, size)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint64(data[8*i:])
+	}
+	return values, nil
+}
@@ -0,0 +1,219 @@
+package secagg
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret, err := NewSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		shares []Share
+		ok     bool
+	}{
+		{"threshold", shares[:3], true},
+		{"other threshold", []Share{shares[4], shares[1], shares[2]}, true},
+		{"all shares", shares, true},
+		{"below threshold", shares[:2], false},
+		{"repeated share", []Share{shares[0], shares[0], shares[1]}, false},
+		{"no shares", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Combine(test.shares, len(secret))
+			if test.ok && (err != nil || !bytes.Equal(got, secret)) {
+				t.Fatalf("Combine() = %x, %v, want %x", got, err, secret)
+			}
+			// below the threshold the interpolation gives some other number, never the secret
+			if !test.ok && err == nil && bytes.Equal(got, secret) {
+				t.Fatal("Combine() recovered the secret from too few shares")
+			}
+		})
+	}
+
+	for _, bad := range [][2]int{{3, 0}, {3, 4}} {
+		if _, err := Split(secret, bad[0], bad[1]); err == nil {
+			t.Errorf("Split(n=%d, t=%d) = nil, want an error", bad[0], bad[1])
+		}
+	}
+}
+
+func TestMasksCancel(t *testing.T) {
+	values := [][]float64{{0.5, -1, 2}, {1.5, 0.25, -2}, {-1, 3, 0.125}}
+	weights := []float64{1, 2, 3}
+	n := len(values)
+
+	maskKeys := make([]KeyPair, n)
+	selfSeeds := make([][]byte, n)
+	selfSeedShares := make([][]Share, n)
+	maskKeyShares := make([][]Share, n)
+	for i := range maskKeys {
+		var err error
+		maskKeys[i], err = GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		selfSeeds[i], err = NewSeed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		selfSeedShares[i], err = Split(selfSeeds[i], n, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		maskKeyShares[i], err = Split(maskKeys[i].Private, n, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// client i adds the pairwise masks of the clients after it and subtracts those of the clients before it
+	sign := func(i int, j int) int {
+		if i < j {
+			return 1
+		}
+		return -1
+	}
+
+	// client 2 shared its keys and dropped out before uploading
+	survivors := []int{0, 1}
+	dropped := 2
+	sum := make([]uint64, len(values[0]))
+	for _, i := range survivors {
+		masked, err := Encode(values[i], weights[i], n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = AddMask(masked, selfSeeds[i], 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < n; j++ {
+			if j == i {
+				continue
+			}
+			seed, err := PairSeed(maskKeys[i].Private, maskKeys[j].Public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = AddMask(masked, seed, sign(i, j))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		for k := range sum {
+			sum[k] += masked[k]
+		}
+	}
+
+	// the survivors reveal the self seed shares of the survivors and the mask key shares of the dropped client
+	for _, i := range survivors {
+		seed, err := Combine([]Share{selfSeedShares[i][0], selfSeedShares[i][1]}, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = AddMask(sum, seed, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	maskKey, err := Combine([]Share{maskKeyShares[dropped][0], maskKeyShares[dropped][1]}, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range survivors {
+		// the pairwise seed is symmetric, the dropped client's key recomputes what survivor i added
+		seed, err := PairSeed(maskKey, maskKeys[i].Public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = AddMask(sum, seed, -sign(i, dropped))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	total := weights[0] + weights[1]
+	for k, got := range Decode(sum, total) {
+		want := (values[0][k]*weights[0] + values[1][k]*weights[1]) / total
+		if math.Abs(got-want) > 1e-6 {
+			t.Fatalf("value %d = %v, want %v", k, got, want)
+		}
+	}
+}
+
+func TestEncodeBound(t *testing.T) {
+	limit := math.Ldexp(1, 63-FractionBits)
+	tests := []struct {
+		name    string
+		value   float64
+		weight  float64
+		clients int
+		ok      bool
+	}{
+		{"small", 0.5, 10, 5, true},
+		{"negative", -3, 100, 5, true},
+		{"just below the share of one client", limit/4 - 1, 1, 4, true},
+		{"share of one client", limit / 4, 1, 4, false},
+		{"weight pushes it over", limit / 8, 2, 4, false},
+		{"one client", limit - 1, 1, 1, true},
+		{"nan", math.NaN(), 1, 1, false},
+		{"infinite", math.Inf(-1), 1, 1, false},
+		{"no clients", 1, 1, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := Encode([]float64{test.value}, test.weight, test.clients)
+			if !test.ok {
+				if err == nil {
+					t.Fatal("Encode() = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// every client at the bound still sums without wrapping
+			sum := make([]uint64, 1)
+			for i := 0; i < test.clients; i++ {
+				sum[0] += encoded[0]
+			}
+			got := Decode(sum, float64(test.clients)*test.weight)[0]
+			if math.Abs(got-test.value) > math.Abs(test.value)*1e-9+1e-6 {
+				t.Fatalf("sum of %d encodings decodes to %v, want %v", test.clients, got, test.value)
+			}
+		})
+	}
+}
+
+func TestEncryptShares(t *testing.T) {
+	sender, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair := SharePair{MaskKey: Share{X: 2, Y: "ab"}, SelfSeed: Share{X: 2, Y: "cd"}}
+	aad := ShareAAD("group", "0", "a", "b")
+	encrypted, err := EncryptShares(sender.Private, receiver.Public, aad, pair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecryptShares(receiver.Private, sender.Public, aad, encrypted)
+	if err != nil || got != pair {
+		t.Fatalf("DecryptShares() = %+v, %v, want %+v", got, err, pair)
+	}
+	if _, err := DecryptShares(receiver.Private, sender.Public, ShareAAD("group", "1", "a", "b"), encrypted); err == nil {
+		t.Fatal("DecryptShares() opened the shares of another round")
+	}
+}
@@ -0,0 +1,157 @@
+// Package store keeps model params outside the ledger in a content-addressed store.
+// Objects are named by the SHA-256 of their content, the ledger only records the digest, size and URI
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrDigestMismatch is returned when downloaded content does not hash to the recorded digest
+var ErrDigestMismatch = errors.New("the content does not match its digest")
+
+// Object describes stored content, it is what the chaincode records in a ParamRef
+type Object struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+	URI    string `json:"uri"`
+}
+
+// Store writes content under its digest
+type Store interface {
+	Put(data []byte) (Object, error)
+}
+
+// FileStore keeps objects in a local directory laid out as <root>/sha256/<first two hex digits>/<digest>.
+// It stands in for an object store, a MinIO or S3 bucket served over http(s) can be read with Get as well
+type FileStore struct {
+	Root string
+}
+
+// NewFileStore creates the store directory if needed
+func NewFileStore(root string) (*FileStore, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve store directory: %w", err)
+	}
+	err = os.MkdirAll(absRoot, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return &FileStore{Root: absRoot}, nil
+}
+
+// Put writes the content unless an object with the same digest exists and returns its description
+func (s *FileStore) Put(data []byte) (Object, error) {
+	digest := Digest(data)
+	objectPath := filepath.Join(s.Root, "sha256", digest[:2], digest)
+	object := Object{Digest: digest, Size: int64(len(data)), URI: fileURI(objectPath)}
+
+	if _, err := os.Stat(objectPath); err == nil {
+		return object, nil
+	}
+	err := os.MkdirAll(filepath.Dir(objectPath), 0755)
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to create object directory: %w", err)
+	}
+	// write to a temporary file first so a reader never sees a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(objectPath), digest+".tmp*")
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to create object file: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return Object{}, fmt.Errorf("failed to write object file: %w", err)
+	}
+	err = os.Rename(tmp.Name(), objectPath)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return Object{}, fmt.Errorf("failed to write object file: %w", err)
+	}
+	return object, nil
+}
+
+// Get downloads the object from its URI, file and http(s) URIs are supported, and verifies its size and digest
+func Get(object Object) ([]byte, error) {
+	location, err := url.Parse(object.URI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse object URI %s: %w", object.URI, err)
+	}
+
+	var data []byte
+	switch location.Scheme {
+	case "file":
+		data, err = os.ReadFile(filePath(location))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object file: %w", err)
+		}
+	case "http", "https":
+		data, err = download(object.URI)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported object URI scheme %s", location.Scheme)
+	}
+
+	if int64(len(data)) != object.Size {
+		return nil, fmt.Errorf("%w: %s has %d bytes, expected %d", ErrDigestMismatch, object.URI, len(data), object.Size)
+	}
+	if digest := Digest(data); digest != object.Digest {
+		return nil, fmt.Errorf("%w: %s hashes to %s, expected %s", ErrDigestMismatch, object.URI, digest, object.Digest)
+	}
+	return data, nil
+}
+
+// Digest returns the hex encoded SHA-256 of the content
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileURI turns an absolute path into a file URI, windows drive letters become file:///E:/...
+func fileURI(path string) string {
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
+
+func filePath(location *url.URL) string {
+	path := location.Path
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path)
+}
+
+func download(uri string) ([]byte, error) {
+	httpClient := http.Client{Timeout: 5 * time.Minute}
+	response, err := httpClient.Get(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download object: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download object %s: %s", uri, response.Status)
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download object: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,69 @@
+package tensor
+
+import "math"
+
+// float32ToHalf converts to IEEE 754 half precision, rounding to nearest even
+func float32ToHalf(value float32) uint16 {
+	bits := math.Float32bits(value)
+	sign := uint16(bits>>16) & 0x8000
+	exponent := int((bits>>23)&0xff) - 127 + 15
+	mantissa := bits & 0x7fffff
+
+	switch {
+	case (bits>>23)&0xff == 0xff:
+		// infinity keeps a zero mantissa, NaN keeps a non zero one
+		if mantissa != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exponent >= 0x1f:
+		return sign | 0x7c00
+	case exponent <= 0:
+		// subnormal half or zero
+		if exponent < -10 {
+			return sign
+		}
+		mantissa |= 0x800000
+		shift := uint32(14 - exponent)
+		half := uint16(mantissa >> shift)
+		remainder := mantissa & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if remainder > halfway || (remainder == halfway && half&1 == 1) {
+			half++
+		}
+		return sign | half
+	}
+
+	half := sign | uint16(exponent)<<10 | uint16(mantissa>>13)
+	remainder := mantissa & 0x1fff
+	if remainder > 0x1000 || (remainder == 0x1000 && half&1 == 1) {
+		// a carry into the exponent rounds up to the next power of two or infinity, both are correct
+		half++
+	}
+	return half
+}
+
+// halfToFloat32 converts from IEEE 754 half precision
+func halfToFloat32(half uint16) float32 {
+	sign := uint32(half&0x8000) << 16
+	exponent := uint32(half>>10) & 0x1f
+	mantissa := uint32(half & 0x3ff)
+
+	switch exponent {
+	case 0:
+		if mantissa == 0 {
+			return math.Float32frombits(sign)
+		}
+		// normalize the subnormal half
+		exponent = 127 - 15 + 1
+		for mantissa&0x400 == 0 {
+			mantissa <<= 1
+			exponent--
+		}
+		mantissa &= 0x3ff
+		return math.Float32frombits(sign | exponent<<23 | mantissa<<13)
+	case 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mantissa<<13)
+	}
+	return math.Float32frombits(sign | (exponent-15+127)<<23 | mantissa<<13)
+}
@@ -0,0 +1,417 @@
+// Package tensor defines the binary container used to upload model params instead of nested JSON.
+//
+// A container starts with the magic "FLTC", a version byte and a compression byte, the rest is the
+// (possibly compressed) body. The body holds a little-endian uint32 tensor count followed by every tensor:
+// uint16 name length, name, uint8 dtype, uint8 rank, rank uint32 dims and the little-endian data.
+package tensor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DType is the element type a tensor is stored with, tensors are always held as float32 in memory
+type DType uint8
+
+const (
+	Float32 DType = 1
+	Float16 DType = 2
+)
+
+// Compression is applied to the body of a container
+type Compression uint8
+
+const (
+	None Compression = 0
+	Gzip Compression = 1
+	Zstd Compression = 2
+)
+
+const (
+	magic   = "FLTC"
+	version = 1
+	// maxBodySize bounds the decompressed body so a small container can not exhaust memory
+	maxBodySize = 1 << 30
+)
+
+// ErrFormat is returned for data that is not a valid container
+var ErrFormat = errors.New("invalid tensor container")
+
+// Tensor is a named dense array in row-major order
+type Tensor struct {
+	Name  string
+	DType DType
+	Shape []int
+	Data  []float32
+}
+
+// Size returns the element count of a shape
+func Size(shape []int) int {
+	size := 1
+	for _, dim := range shape {
+		size *= dim
+	}
+	return size
+}
+
+func (d DType) byteSize() (int, error) {
+	switch d {
+	case Float32:
+		return 4, nil
+	case Float16:
+		return 2, nil
+	default:
+		return 0, fmt.Errorf("%w: unknown dtype %d", ErrFormat, d)
+	}
+}
+
+// ParseDType maps "float32" and "float16" to their DType
+func ParseDType(name string) (DType, error) {
+	switch name {
+	case "float32":
+		return Float32, nil
+	case "float16":
+		return Float16, nil
+	default:
+		return 0, fmt.Errorf("unknown dtype %s", name)
+	}
+}
+
+// ParseCompression maps "none", "gzip" and "zstd" to their Compression
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "", "none":
+		return None, nil
+	case "gzip":
+		return Gzip, nil
+	case "zstd":
+		return Zstd, nil
+	default:
+		return 0, fmt.Errorf("unknown compression %s", name)
+	}
+}
+
+// Encode writes the tensors into a container
+func Encode(tensors []Tensor, compression Compression) ([]byte, error) {
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint32(len(tensors)))
+	for _, t := range tensors {
+		if len(t.Name) > math.MaxUint16 {
+			return nil, fmt.Errorf("the tensor name %s is too long", t.Name)
+		}
+		if len(t.Shape) > math.MaxUint8 {
+			return nil, fmt.Errorf("tensor %s has too many dimensions", t.Name)
+		}
+		if Size(t.Shape) != len(t.Data) {
+			return nil, fmt.Errorf("tensor %s has %d values for shape %v", t.Name, len(t.Data), t.Shape)
+		}
+		if _, err := t.DType.byteSize(); err != nil {
+			return nil, err
+		}
+
+		binary.Write(&body, binary.LittleEndian, uint16(len(t.Name)))
+		body.WriteString(t.Name)
+		body.WriteByte(byte(t.DType))
+		body.WriteByte(byte(len(t.Shape)))
+		for _, dim := range t.Shape {
+			binary.Write(&body, binary.LittleEndian, uint32(dim))
+		}
+		for _, value := range t.Data {
+			if t.DType == Float16 {
+				binary.Write(&body, binary.LittleEndian, float32ToHalf(value))
+			} else {
+				binary.Write(&body, binary.LittleEndian, math.Float32bits(value))
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString(magic)
+	out.WriteByte(version)
+	out.WriteByte(byte(compression))
+	switch compression {
+	case None:
+		out.Write(body.Bytes())
+	case Gzip:
+		writer := gzip.NewWriter(&out)
+		if _, err := writer.Write(body.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to compress tensors: %w", err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress tensors: %w", err)
+		}
+	case Zstd:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress tensors: %w", err)
+		}
+		out.Write(encoder.EncodeAll(body.Bytes(), nil))
+		encoder.Close()
+	default:
+		return nil, fmt.Errorf("unknown compression %d", compression)
+	}
+	return out.Bytes(), nil
+}
+
+// IsContainer tells whether the data starts like a container, JSON params never do
+func IsContainer(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// Decode reads the tensors of a container
+func Decode(data []byte) ([]Tensor, error) {
+	if len(data) < len(magic)+2 || !IsContainer(data) {
+		return nil, fmt.Errorf("%w: missing header", ErrFormat)
+	}
+	if data[len(magic)] != version {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrFormat, data[len(magic)])
+	}
+	body, err := decompress(Compression(data[len(magic)+1]), data[len(magic)+2:])
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bytes.NewReader(body)
+	var count uint32
+	if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("%w: truncated tensor count", ErrFormat)
+	}
+	var tensors []Tensor
+	for i := uint32(0); i < count; i++ {
+		t, err := readTensor(reader)
+		if err != nil {
+			return nil, err
+		}
+		tensors = append(tensors, t)
+	}
+	if reader.Len() != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrFormat, reader.Len())
+	}
+	return tensors, nil
+}
+
+func decompress(compression Compression, data []byte) ([]byte, error) {
+	var reader io.Reader
+	switch compression {
+	case None:
+		return data, nil
+	case Gzip:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case Zstd:
+		decoder, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderMaxMemory(maxBodySize))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		defer decoder.Close()
+		reader = decoder
+	default:
+		return nil, fmt.Errorf("%w: unknown compression %d", ErrFormat, compression)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, maxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	if len(body) > maxBodySize {
+		return nil, fmt.Errorf("%w: the body exceeds %d bytes", ErrFormat, maxBodySize)
+	}
+	return body, nil
+}
+
+func readTensor(reader *bytes.Reader) (Tensor, error) {
+	var nameLength uint16
+	if err := binary.Read(reader, binary.LittleEndian, &nameLength); err != nil {
+		return Tensor{}, fmt.Errorf("%w: truncated tensor name", ErrFormat)
+	}
+	name := make([]byte, nameLength)
+	if _, err := io.ReadFull(reader, name); err != nil {
+		return Tensor{}, fmt.Errorf("%w: truncated tensor name", ErrFormat)
+	}
+	t := Tensor{Name: string(name)}
+
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return Tensor{}, fmt.Errorf("%w: truncated header of tensor %s", ErrFormat, t.Name)
+	}
+	t.DType = DType(header[0])
+	elementSize, err := t.DType.byteSize()
+	if err != nil {
+		return Tensor{}, err
+	}
+	size := 1
+	for i := 0; i < int(header[1]); i++ {
+		var dim uint32
+		if err := binary.Read(reader, binary.LittleEndian, &dim); err != nil {
+			return Tensor{}, fmt.Errorf("%w: truncated shape of tensor %s", ErrFormat, t.Name)
+		}
+		t.Shape = append(t.Shape, int(dim))
+		size *= int(dim)
+		if size*elementSize > reader.Len() {
+			return Tensor{}, fmt.Errorf("%w: truncated data of tensor %s", ErrFormat, t.Name)
+		}
+	}
+	if size*elementSize > reader.Len() {
+		return Tensor{}, fmt.Errorf("%w: truncated data of tensor %s", ErrFormat, t.Name)
+	}
+
+	raw := make([]byte, size*elementSize)
+	io.ReadFull(reader, raw)
+	t.Data = make([]float32, size)
+	for i := range t.Data {
+		if t.DType == Float16 {
+			t.Data[i] = halfToFloat32(binary.LittleEndian.Uint16(raw[2*i:]))
+		} else {
+			t.Data[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+		}
+	}
+	return t, nil
+}
+
+// FromParams converts nested JSON params into tensors sorted by name
+func FromParams(params map[string]interface{}, dtype DType) ([]Tensor, error) {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tensors := make([]Tensor, 0, len(names))
+	for _, name := range names {
+		shape, err := shapeOf(params[name])
+		if err != nil {
+			return nil, fmt.Errorf("tensor %s: %w", name, err)
+		}
+		t := Tensor{Name: name, DType: dtype, Shape: shape, Data: make([]float32, 0, Size(shape))}
+		t.Data, err = flatten(params[name], shape, t.Data)
+		if err != nil {
+			return nil, fmt.Errorf("tensor %s: %w", name, err)
+		}
+		tensors = append(tensors, t)
+	}
+	return tensors, nil
+}
+
+// shapeOf follows the first element of every level, flatten checks that the rest agree
+func shapeOf(value interface{}) ([]int, error) {
+	var shape []int
+	for {
+		switch v := value.(type) {
+		case float64:
+			return shape, nil
+		case []interface{}:
+			shape = append(shape, len(v))
+			if len(v) == 0 {
+				return shape, nil
+			}
+			value = v[0]
+		default:
+			return nil, fmt.Errorf("unsupported value of type %T", value)
+		}
+	}
+}
+
+func flatten(value interface{}, shape []int, data []float32) ([]float32, error) {
+	if len(shape) == 0 {
+		number, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("expected a number, got %T", value)
+		}
+		return append(data, float32(number)), nil
+	}
+	list, ok := value.([]interface{})
+	if !ok || len(list) != shape[0] {
+		return nil, fmt.Errorf("ragged array, expected %d values", shape[0])
+	}
+	var err error
+	for _, item := range list {
+		data, err = flatten(item, shape[1:], data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// ToParams converts tensors back into nested JSON params
+func ToParams(tensors []Tensor) map[string]interface{} {
+	params := make(map[string]interface{}, len(tensors))
+	for _, t := range tensors {
+		value, _ := nest(t.Data, t.Shape)
+		params[t.Name] = value
+	}
+	return params
+}
+
+func nest(data []float32, shape []int) (interface{}, []float32) {
+	if len(shape) == 0 {
+		return float64(data[0]), data[1:]
+	}
+	list := make([]interface{}, shape[0])
+	for i := range list {
+		list[i], data = nest(data, shape[1:])
+	}
+	return list, data
+}
+
+// WeightedMean averages tensor sets with the same names and shapes, the sums are kept in float64.
+// The result uses the dtype of the first set
+func WeightedMean(sets [][]Tensor, weights []float64) ([]Tensor, error) {
+	if len(sets) == 0 || len(sets) != len(weights) {
+		return nil, fmt.Errorf("expected one weight per tensor set")
+	}
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("the weights must add up to a positive total")
+	}
+
+	result := make([]Tensor, len(sets[0]))
+	for i, first := range sets[0] {
+		sums := make([]float64, len(first.Data))
+		for j, set := range sets {
+			if len(set) != len(sets[0]) {
+				return nil, fmt.Errorf("tensor set %d has %d tensors, expected %d", j, len(set), len(sets[0]))
+			}
+			t := set[i]
+			if t.Name != first.Name || !sameShape(t.Shape, first.Shape) {
+				return nil, fmt.Errorf("tensor set %d has %s%v where %s%v is expected", j, t.Name, t.Shape, first.Name, first.Shape)
+			}
+			for k, value := range t.Data {
+				sums[k] += float64(value) * weights[j]
+			}
+		}
+		data := make([]float32, len(sums))
+		for k, sum := range sums {
+			data[k] = float32(sum / total)
+		}
+		result[i] = Tensor{Name: first.Name, DType: first.DType, Shape: append([]int(nil), first.Shape...), Data: data}
+	}
+	return result, nil
+}
+
+func sameShape(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package tensor
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestContainerRoundTrip(t *testing.T) {
+	params := map[string]interface{}{
+		"conv.weight": []interface{}{
+			[]interface{}{0.5, -1.25, 3.0},
+			[]interface{}{0.0, 2.5, -0.75},
+		},
+		"fc.bias": []interface{}{0.125, -0.5},
+		"scale":   1.5,
+	}
+	tests := []struct {
+		name        string
+		dtype       DType
+		compression Compression
+	}{
+		{"float32", Float32, None},
+		{"float32 gzip", Float32, Gzip},
+		{"float32 zstd", Float32, Zstd},
+		{"float16", Float16, None},
+		{"float16 zstd", Float16, Zstd},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tensors, err := FromParams(params, test.dtype)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := Encode(tensors, test.compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsContainer(data) {
+				t.Fatal("the encoded data is not a container")
+			}
+			decoded, err := Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the values are exact in float16, so both dtypes give the params back
+			if got := ToParams(decoded); !reflect.DeepEqual(got, params) {
+				t.Fatalf("round trip gave %v, want %v", got, params)
+			}
+			for i, tensor := range decoded {
+				if tensor.Name != tensors[i].Name || tensor.DType != test.dtype || !reflect.DeepEqual(tensor.Shape, tensors[i].Shape) {
+					t.Fatalf("tensor %d = %s %d %v, want %s %d %v", i, tensor.Name, tensor.DType, tensor.Shape, tensors[i].Name, test.dtype, tensors[i].Shape)
+				}
+			}
+		})
+	}
+}
+
+func TestFloat16Rounding(t *testing.T) {
+	tests := []struct {
+		value float32
+		want  float32
+	}{
+		{0, 0},
+		{1, 1},
+		{-2.5, -2.5},
+		{65504, 65504},
+		{0.1, 0.099975586},
+		{1e6, float32(math.Inf(1))},
+		{-1e6, float32(math.Inf(-1))},
+	}
+	for _, test := range tests {
+		if got := halfToFloat32(float32ToHalf(test.value)); got != test.want {
+			t.Errorf("float16 of %v = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	valid, err := Encode([]Tensor{{Name: "w", DType: Float32, Shape: []int{2}, Data: []float32{1, 2}}}, None)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"json", []byte(`{"w": [1, 2]}`)},
+		{"unknown version", append([]byte(magic), 9, byte(None))},
+		{"unknown compression", append([]byte(magic), version, 9, 0, 0, 0, 0)},
+		{"truncated", valid[:len(valid)-3]},
+		{"trailing bytes", append(append([]byte(nil), valid...), 0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Decode(test.data)
+			if !errors.Is(err, ErrFormat) {
+				t.Fatalf("Decode() = %v, want ErrFormat", err)
+			}
+		})
+	}
+}
+
+func TestFromParamsRagged(t *testing.T) {
+	_, err := FromParams(map[string]interface{}{"w": []interface{}{[]interface{}{1.0, 2.0}, []interface{}{3.0}}}, Float32)
+	if err == nil {
+		t.Fatal("FromParams() = nil for ragged params, want an error")
+	}
+}
+
+func TestWeightedMean(t *testing.T) {
+	sets := [][]Tensor{
+		{{Name: "w", DType: Float32, Shape: []int{2}, Data: []float32{1, 2}}},
+		{{Name: "w", DType: Float32, Shape: []int{2}, Data: []float32{4, 8}}},
+	}
+	mean, err := WeightedMean(sets, []float64{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float32{2, 4}; !reflect.DeepEqual(mean[0].Data, want) {
+		t.Fatalf("WeightedMean() = %v, want %v", mean[0].Data, want)
+	}
+	sets[1][0].Shape = []int{1, 2}
+	if _, err := WeightedMean(sets, []float64{2, 1}); err == nil {
+		t.Fatal("WeightedMean() = nil for different shapes, want an error")
+	}
+}
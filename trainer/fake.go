@@ -0,0 +1,114 @@
+package trainer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FakeTrainer trains without python or data: it writes params of the shapes in Layers, or moves the initial params
+// a step towards the client, and reports a loss that falls with every training. It lets the rounds run in tests
+type FakeTrainer struct {
+	// Dir is where the params are written, as "fake_parameters_<clientIndex>.json"
+	Dir string
+	// Layers are the shapes of the layers of a fresh model, e.g. {"fc.weight": {10, 84}, "fc.bias": {10}}
+	Layers map[string][]int
+	// NumSamples is the sample count of every client, 1 when zero
+	NumSamples int
+
+	mutex  sync.Mutex
+	rounds map[int]int
+}
+
+// Train writes the params of the client and reports its fake metrics
+func (t *FakeTrainer) Train(ctx context.Context, initialParamsPath string, clientIndex int) (TrainResult, error) {
+	if err := ctx.Err(); err != nil {
+		return TrainResult{}, err
+	}
+	t.mutex.Lock()
+	if t.rounds == nil {
+		t.rounds = make(map[int]int)
+	}
+	t.rounds[clientIndex]++
+	round := t.rounds[clientIndex]
+	t.mutex.Unlock()
+
+	// every client pulls its params towards its own value, so the aggregate differs from each upload
+	target := float64(clientIndex+1) / 10
+	params := make(map[string]interface{})
+	if initialParamsPath != "" {
+		data, err := os.ReadFile(initialParamsPath)
+		if err != nil {
+			return TrainResult{}, fmt.Errorf("failed to read initial params: %w", err)
+		}
+		err = json.Unmarshal(data, &params)
+		if err != nil {
+			return TrainResult{}, fmt.Errorf("failed to unmarshal initial params: %w", err)
+		}
+		for name, value := range params {
+			params[name] = step(value, target)
+		}
+	} else {
+		for name, shape := range t.Layers {
+			params[name] = fill(shape, target)
+		}
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return TrainResult{}, fmt.Errorf("failed to marshal params: %w", err)
+	}
+	paramsPath := filepath.Join(t.Dir, fmt.Sprintf("fake_parameters_%d.json", clientIndex))
+	err = os.WriteFile(paramsPath, data, 0644)
+	if err != nil {
+		return TrainResult{}, fmt.Errorf("failed to write params: %w", err)
+	}
+
+	numSamples := t.NumSamples
+	if numSamples < 1 {
+		numSamples = 1
+	}
+	checksum, err := Checksum(paramsPath)
+	if err != nil {
+		return TrainResult{}, err
+	}
+	loss := 1 / float64(round+1)
+	return TrainResult{
+		ParamsPath:  paramsPath,
+		NumSamples:  numSamples,
+		LocalEpochs: 1,
+		Loss:        loss,
+		Accuracy:    1 - loss,
+		Metrics:     map[string]float64{"loss": loss, "accuracy": 1 - loss},
+		SHA256:      checksum,
+	}, nil
+}
+
+// fill builds nested arrays of the shape with every value set to v
+func fill(shape []int, v float64) interface{} {
+	if len(shape) == 0 {
+		return v
+	}
+	values := make([]interface{}, shape[0])
+	for i := range values {
+		values[i] = fill(shape[1:], v)
+	}
+	return values
+}
+
+// step moves every number of nested arrays half way to target
+func step(value interface{}, target float64) interface{} {
+	switch v := value.(type) {
+	case float64:
+		return v + (target-v)/2
+	case []interface{}:
+		for i := range v {
+			v[i] = step(v[i], target)
+		}
+		return v
+	}
+	return value
+}
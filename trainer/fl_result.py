@@ -0,0 +1,67 @@
+"""Reports the result of a local training to the orchestrator, the python side of trainer.ResultPrefix.
+
+Copy this file next to train.py and Load_Param_Train.py and call report once the params file is written:
+
+    from fl_result import report
+
+    report(client_index, "model_parameters_%d.json" % client_index, num_samples,
+           local_epochs=epochs, metrics={"loss": loss, "accuracy": accuracy})
+
+The orchestrator passes its data dir in FL_DATA_DIR, the params file has to be written inside it.
+Only the last FL_RESULT line on stdout counts, the rest of the output is for people.
+"""
+
+import hashlib
+import json
+import os
+import sys
+
+RESULT_PREFIX = "FL_RESULT "
+
+
+def data_dir():
+    """Returns the data dir of the orchestrator, the working directory when the script runs on its own."""
+    return os.environ.get("FL_DATA_DIR") or "."
+
+
+def sha256_of_file(path):
+    """Returns the hex encoded SHA-256 of a file."""
+    digest = hashlib.sha256()
+    with open(path, "rb") as f:
+        for block in iter(lambda: f.read(1 << 20), b""):
+            digest.update(block)
+    return digest.hexdigest()
+
+
+def report(client_index, params_path, num_samples, local_epochs=0, metrics=None):
+    """Prints the FL_RESULT line of a training.
+
+    params_path is the JSON params file the training wrote, relative paths are relative to the data dir.
+    num_samples weighs the params in the aggregation and must be at least 1. The metrics must be finite
+    numbers, a NaN or infinite loss means the training diverged and the orchestrator drops the result.
+    """
+    path = params_path if os.path.isabs(params_path) else os.path.join(data_dir(), params_path)
+    relative = os.path.relpath(os.path.realpath(path), os.path.realpath(data_dir()))
+    if relative == os.curdir or relative == os.pardir or relative.startswith(os.pardir + os.sep):
+        raise ValueError("the params %s are outside the data dir %s" % (params_path, data_dir()))
+    if int(num_samples) < 1:
+        raise ValueError("the training needs at least one sample, got %s" % num_samples)
+
+    result = {
+        "clientIndex": int(client_index),
+        "paramsPath": relative.replace(os.sep, "/"),
+        "numSamples": int(num_samples),
+        "localEpochs": int(local_epochs),
+        "metrics": {name: float(value) for name, value in (metrics or {}).items()},
+        "sha256": sha256_of_file(path),
+    }
+    # allow_nan=False fails here rather than sending a line the orchestrator cannot read
+    print(RESULT_PREFIX + json.dumps(result, allow_nan=False))
+    sys.stdout.flush()
+
+
+if __name__ == "__main__":
+    # python fl_result.py <client index> <params file> <samples> [<local epochs>] reports a training done elsewhere
+    if len(sys.argv) < 4:
+        sys.exit("usage: fl_result.py <client index> <params file> <samples> [<local epochs>]")
+    report(sys.argv[1], sys.argv[2], sys.argv[3], sys.argv[4] if len(sys.argv) > 4 else 0)
@@ -0,0 +1,85 @@
+package trainer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// TrainRequest is the body of the POST to the train endpoint of a worker
+type TrainRequest struct {
+	InitialParamsPath string `json:"initialParamsPath,omitempty"`
+	ClientIndex       int    `json:"clientIndex"`
+}
+
+// HTTPTrainer hands the training to a long-lived worker, which keeps the model and the data loaded between rounds.
+// It POSTs a TrainRequest as JSON to URL and expects a TrainResult with the checksum of the params as JSON,
+// any other status fails the training with the body of the response. The params paths are paths on the worker,
+// it has to share the data dir with the orchestrator
+type HTTPTrainer struct {
+	// URL is the train endpoint of the worker, e.g. "http://localhost:8090/train"
+	URL string
+	// Client sends the requests, http.DefaultClient when nil. The context of Train bounds each training
+	Client *http.Client
+}
+
+// Train asks the worker to train the client
+func (t *HTTPTrainer) Train(ctx context.Context, initialParamsPath string, clientIndex int) (TrainResult, error) {
+	body, err := json.Marshal(TrainRequest{InitialParamsPath: initialParamsPath, ClientIndex: clientIndex})
+	if err != nil {
+		return TrainResult{}, fmt.Errorf("failed to marshal train request: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return TrainResult{}, fmt.Errorf("failed to create train request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	httpClient := t.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return TrainResult{}, fmt.Errorf("failed to train client %d: %w", clientIndex, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return TrainResult{}, fmt.Errorf("failed to train client %d: worker answered %s: %s", clientIndex, response.Status, strings.TrimSpace(string(message)))
+	}
+
+	var result TrainResult
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return TrainResult{}, fmt.Errorf("failed to decode train result of client %d: %w", clientIndex, err)
+	}
+	return result, nil
+}
+
+// Handler serves the train endpoint of a worker with a Trainer, it is the Go side of the protocol of HTTPTrainer
+func Handler(t Trainer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "train requests are POSTed", http.StatusMethodNotAllowed)
+			return
+		}
+		var request TrainRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, "invalid train request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := t.Train(r.Context(), request.InitialParamsPath, request.ClientIndex)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
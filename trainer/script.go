@@ -0,0 +1,156 @@
+package trainer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ResultPrefix starts the line a training script prints to stdout to report its result, followed by the JSON
+// of a ScriptResult on the same line. fl_result.py next to this file prints it, the scripts call
+//
+//	from fl_result import report
+//	report(client_index, params_path, num_samples, local_epochs=epochs, metrics={"loss": loss, "accuracy": acc})
+//
+// once they wrote the params file inside FL_DATA_DIR. Only the last such line counts, the rest of the output is for people
+const ResultPrefix = "FL_RESULT "
+
+// ScriptResult is the result line of a training script
+type ScriptResult struct {
+	// ClientIndex echoes the index the script was called with
+	ClientIndex int `json:"clientIndex"`
+	// ParamsPath is the params file the script wrote, relative paths are relative to the data dir. The file must be
+	// inside the data dir
+	ParamsPath  string             `json:"paramsPath"`
+	NumSamples  int                `json:"numSamples"`
+	LocalEpochs int                `json:"localEpochs"`
+	Metrics     map[string]float64 `json:"metrics"`
+	// SHA256 is the hex encoded checksum of the params file
+	SHA256 string `json:"sha256"`
+}
+
+// ScriptTrainer runs the python training scripts of the profile as a subprocess per training.
+// TrainScript is called with the client index and trains a fresh model, LoadTrainScript with the
+// initial params file and the client index. The scripts get the data dir in FL_DATA_DIR and
+// report their result with a ResultPrefix line, a script that prints none fails the training
+type ScriptTrainer struct {
+	Python          string
+	TrainScript     string
+	LoadTrainScript string
+	DataDir         string
+	// Logger receives the output of the scripts, nothing is logged when nil
+	Logger *log.Logger
+}
+
+// Train runs the training script of the client and reads its result line
+func (t *ScriptTrainer) Train(ctx context.Context, initialParamsPath string, clientIndex int) (TrainResult, error) {
+	script := t.TrainScript
+	args := []string{strconv.Itoa(clientIndex)}
+	if initialParamsPath != "" {
+		script = t.LoadTrainScript
+		args = []string{initialParamsPath, strconv.Itoa(clientIndex)}
+		t.logf("load model params: %s", initialParamsPath)
+	}
+	if script == "" {
+		return TrainResult{}, fmt.Errorf("failed to train client %d: no training script is set", clientIndex)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.Python, append([]string{script}, args...)...)
+	cmd.Env = append(os.Environ(), "FL_DATA_DIR="+t.DataDir)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	t.logf("Output from Python: %s%s", stdout.String(), stderr.String())
+	if err != nil {
+		return TrainResult{}, fmt.Errorf("failed to train client %d with %s: %w", clientIndex, script, err)
+	}
+
+	result, err := parseScriptResult(stdout.Bytes())
+	if err != nil {
+		return TrainResult{}, fmt.Errorf("failed to train client %d with %s: %w", clientIndex, script, err)
+	}
+	if result.ClientIndex != clientIndex {
+		return TrainResult{}, fmt.Errorf("failed to train client %d with %s: %w: the result is of client %d", clientIndex, script, ErrInvalidResult, result.ClientIndex)
+	}
+	paramsPath, err := t.paramsPath(result.ParamsPath)
+	if err != nil {
+		return TrainResult{}, fmt.Errorf("failed to train client %d with %s: %w", clientIndex, script, err)
+	}
+	return TrainResult{
+		ParamsPath:  paramsPath,
+		NumSamples:  result.NumSamples,
+		LocalEpochs: result.LocalEpochs,
+		Loss:        result.Metrics["loss"],
+		Accuracy:    result.Metrics["accuracy"],
+		Metrics:     result.Metrics,
+		SHA256:      result.SHA256,
+	}, nil
+}
+
+// paramsPath resolves the params path of a result against the data dir, a script may not point outside of it
+func (t *ScriptTrainer) paramsPath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("%w: no params path", ErrInvalidResult)
+	}
+	dataDir, err := filepath.Abs(t.DataDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the data dir: %w", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dataDir, path)
+	}
+	// symbolic links are followed, so a link in the data dir cannot lead out of it
+	realDir, err := filepath.EvalSymlinks(dataDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the data dir: %w", err)
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidResult, err)
+	}
+	relative, err := filepath.Rel(realDir, realPath)
+	if err != nil || relative == "." || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: the params %s are outside the data dir %s", ErrInvalidResult, path, t.DataDir)
+	}
+	return realPath, nil
+}
+
+// logf reports to the logger, if there is one
+func (t *ScriptTrainer) logf(format string, args ...interface{}) {
+	if t.Logger != nil {
+		t.Logger.Printf(format, args...)
+	}
+}
+
+// parseScriptResult reads the last result line of the output of a training script
+func parseScriptResult(output []byte) (*ScriptResult, error) {
+	var line string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if text := strings.TrimSpace(scanner.Text()); strings.HasPrefix(text, ResultPrefix) {
+			line = strings.TrimPrefix(text, ResultPrefix)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the output: %w", err)
+	}
+	if line == "" {
+		return nil, fmt.Errorf("%w: the script printed no %s line", ErrInvalidResult, strings.TrimSpace(ResultPrefix))
+	}
+	var result ScriptResult
+	err := json.Unmarshal([]byte(line), &result)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResult, err)
+	}
+	return &result, nil
+}
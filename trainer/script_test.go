@@ -0,0 +1,116 @@
+package trainer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseScriptResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    *ScriptResult
+		wantErr bool
+	}{
+		{
+			name:   "single line",
+			output: `FL_RESULT {"clientIndex": 1, "paramsPath": "p.json", "numSamples": 10, "localEpochs": 2, "sha256": "ab"}`,
+			want:   &ScriptResult{ClientIndex: 1, ParamsPath: "p.json", NumSamples: 10, LocalEpochs: 2, SHA256: "ab"},
+		},
+		{
+			name:   "last line counts",
+			output: "epoch 1 loss 0.9\nFL_RESULT {\"clientIndex\": 1, \"numSamples\": 1}\nepoch 2 loss 0.5\n  FL_RESULT {\"clientIndex\": 2, \"numSamples\": 5}  \ndone\n",
+			want:   &ScriptResult{ClientIndex: 2, NumSamples: 5},
+		},
+		{
+			name:   "metrics",
+			output: `FL_RESULT {"clientIndex": 0, "metrics": {"loss": 0.25, "accuracy": 0.75}}`,
+			want:   &ScriptResult{Metrics: map[string]float64{"loss": 0.25, "accuracy": 0.75}},
+		},
+		{name: "no result line", output: "training done\nparams saved\n", wantErr: true},
+		{name: "empty output", output: "", wantErr: true},
+		{name: "prefix inside a line", output: `log: FL_RESULT {"clientIndex": 1}`, wantErr: true},
+		{name: "invalid json", output: `FL_RESULT {"clientIndex": 1,`, wantErr: true},
+		{name: "wrong type", output: `FL_RESULT {"numSamples": "ten"}`, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseScriptResult([]byte(test.output))
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalidResult) {
+					t.Fatalf("parseScriptResult() = %v, want ErrInvalidResult", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseScriptResult() = %v", err)
+			}
+			if got.ClientIndex != test.want.ClientIndex || got.ParamsPath != test.want.ParamsPath || got.NumSamples != test.want.NumSamples ||
+				got.LocalEpochs != test.want.LocalEpochs || got.SHA256 != test.want.SHA256 || len(got.Metrics) != len(test.want.Metrics) {
+				t.Fatalf("parseScriptResult() = %+v, want %+v", got, test.want)
+			}
+			for name, value := range test.want.Metrics {
+				if got.Metrics[name] != value {
+					t.Fatalf("metric %s = %v, want %v", name, got.Metrics[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestParamsPath(t *testing.T) {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "data")
+	err := os.Mkdir(dataDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(dataDir, "params.json"), filepath.Join(dir, "outside.json")} {
+		err = os.WriteFile(path, []byte("{}"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	linked := os.Symlink(filepath.Join(dir, "outside.json"), filepath.Join(dataDir, "link.json")) == nil
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"relative", "params.json", false},
+		{"absolute inside", filepath.Join(dataDir, "params.json"), false},
+		{"relative outside", "../outside.json", true},
+		{"absolute outside", filepath.Join(dir, "outside.json"), true},
+		{"data dir itself", ".", true},
+		{"missing", "missing.json", true},
+		{"empty", "", true},
+	}
+	if linked {
+		tests = append(tests, struct {
+			name    string
+			path    string
+			wantErr bool
+		}{"link outside", "link.json", true})
+	}
+	trainer := &ScriptTrainer{DataDir: dataDir}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, err := trainer.paramsPath(test.path)
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalidResult) {
+					t.Fatalf("paramsPath(%q) = %q, %v, want ErrInvalidResult", test.path, path, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("paramsPath(%q) = %v", test.path, err)
+			}
+			if filepath.Base(path) != "params.json" || !filepath.IsAbs(path) {
+				t.Fatalf("paramsPath(%q) = %q, want the absolute path of params.json", test.path, path)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Package trainer runs the local training of the clients of a round. The orchestrator only sees the Trainer interface,
+// the training itself happens in the python scripts of the profile, in a long-lived worker reached over HTTP
+// or, in tests, in the pure Go FakeTrainer
+package trainer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// TrainResult is what a client reports about its local training
+type TrainResult struct {
+	// ParamsPath is the JSON params file the client wrote
+	ParamsPath string `json:"paramsPath"`
+	// NumSamples weighs the params in the aggregation, it is at least 1
+	NumSamples  int `json:"numSamples"`
+	LocalEpochs int `json:"localEpochs,omitempty"`
+	// Loss and Accuracy are the training metrics of the last epoch, zero when the client does not report them
+	Loss     float64 `json:"loss,omitempty"`
+	Accuracy float64 `json:"accuracy,omitempty"`
+	// Metrics holds every metric the client reported, including the loss and the accuracy
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// SHA256 is the hex encoded checksum of the params file
+	SHA256 string `json:"sha256"`
+}
+
+// Trainer trains the client at clientIndex, whose index also selects its part of the data.
+// initialParamsPath is the aggregated params file the client starts from, empty for a fresh model.
+// The orchestrator validates the result, a trainer only reports what the training wrote
+type Trainer interface {
+	Train(ctx context.Context, initialParamsPath string, clientIndex int) (TrainResult, error)
+}
+
+// ErrInvalidResult is returned for a training whose result is missing or does not match the params it names
+var ErrInvalidResult = errors.New("invalid train result")
+
+// Validate checks a result before its params are uploaded: the params file exists and matches the checksum,
+// the client trained on samples and its metrics are numbers, a NaN or infinite loss means the training diverged
+func (r TrainResult) Validate() error {
+	if r.ParamsPath == "" {
+		return fmt.Errorf("%w: no params path", ErrInvalidResult)
+	}
+	if r.NumSamples < 1 {
+		return fmt.Errorf("%w: %d samples", ErrInvalidResult, r.NumSamples)
+	}
+	metrics := map[string]float64{"loss": r.Loss, "accuracy": r.Accuracy}
+	for name, value := range r.Metrics {
+		metrics[name] = value
+	}
+	for name, value := range metrics {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("%w: %s is %v", ErrInvalidResult, name, value)
+		}
+	}
+	if r.SHA256 == "" {
+		return fmt.Errorf("%w: no checksum of %s", ErrInvalidResult, r.ParamsPath)
+	}
+	checksum, err := Checksum(r.ParamsPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidResult, err)
+	}
+	if !strings.EqualFold(checksum, r.SHA256) {
+		return fmt.Errorf("%w: checksum of %s is %s, the result reports %s", ErrInvalidResult, r.ParamsPath, checksum, r.SHA256)
+	}
+	return nil
+}
+
+// Checksum is the hex encoded SHA-256 of a params file
+func Checksum(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read params: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
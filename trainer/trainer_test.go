@@ -0,0 +1,53 @@
+package trainer
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	paramsPath := filepath.Join(dir, "params.json")
+	err := os.WriteFile(paramsPath, []byte(`{"fc.bias": [0.1, 0.2]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := Checksum(paramsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := TrainResult{ParamsPath: paramsPath, NumSamples: 10, Loss: 0.5, Accuracy: 0.8, SHA256: checksum}
+
+	tests := []struct {
+		name    string
+		change  func(r *TrainResult)
+		wantErr bool
+	}{
+		{"valid", func(r *TrainResult) {}, false},
+		{"upper case checksum", func(r *TrainResult) { r.SHA256 = strings.ToUpper(r.SHA256) }, false},
+		{"no params path", func(r *TrainResult) { r.ParamsPath = "" }, true},
+		{"missing params file", func(r *TrainResult) { r.ParamsPath = filepath.Join(dir, "missing.json") }, true},
+		{"zero samples", func(r *TrainResult) { r.NumSamples = 0 }, true},
+		{"nan loss", func(r *TrainResult) { r.Loss = math.NaN() }, true},
+		{"infinite metric", func(r *TrainResult) { r.Metrics = map[string]float64{"f1": math.Inf(1)} }, true},
+		{"no checksum", func(r *TrainResult) { r.SHA256 = "" }, true},
+		{"wrong checksum", func(r *TrainResult) { r.SHA256 = checksum[:len(checksum)-1] + "x" }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := valid
+			test.change(&result)
+			err := result.Validate()
+			if test.wantErr && !errors.Is(err, ErrInvalidResult) {
+				t.Fatalf("Validate() = %v, want ErrInvalidResult", err)
+			}
+			if !test.wantErr && err != nil {
+				t.Fatalf("Validate() = %v, want nil", err)
+			}
+		})
+	}
+}